@@ -1,12 +1,21 @@
 package main
 
 import (
-	"fmt"
+	"context"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
 
 	"github.com/khaledibrahim1015/goFlow-cicd/internal/config"
+	"github.com/khaledibrahim1015/goFlow-cicd/internal/deployments"
+	"github.com/khaledibrahim1015/goFlow-cicd/internal/freeze"
+	"github.com/khaledibrahim1015/goFlow-cicd/internal/git"
 	"github.com/khaledibrahim1015/goFlow-cicd/internal/handlers"
+	"github.com/khaledibrahim1015/goFlow-cicd/internal/scheduler"
 	"github.com/khaledibrahim1015/goFlow-cicd/internal/server"
 	"github.com/khaledibrahim1015/goFlow-cicd/internal/status"
+	"github.com/khaledibrahim1015/goFlow-cicd/internal/store"
 	"github.com/sirupsen/logrus"
 )
 
@@ -17,15 +26,128 @@ func main() {
 		logrus.Fatalf("Failed to load config: %v", err)
 	}
 
+	st, err := store.New(cfg.StateDir)
+	if err != nil {
+		logrus.Fatalf("Failed to open state directory: %v", err)
+	}
+	if err := status.Restore(st); err != nil {
+		logrus.Fatalf("Failed to restore run statuses: %v", err)
+	}
+	if err := deployments.Restore(st); err != nil {
+		logrus.Fatalf("Failed to restore deployments: %v", err)
+	}
+	if err := freeze.Restore(st); err != nil {
+		logrus.Fatalf("Failed to restore deploy locks: %v", err)
+	}
+	poller, err := git.NewPoller(cfg, st)
+	if err != nil {
+		logrus.Fatalf("Failed to start repository polling: %v", err)
+	}
+	// Polling and schedules stop starting runs once a shutdown signal arrives
+	background, stopBackground := context.WithCancel(context.Background())
+	poller.Start(background)
+	scheduler.New(cfg).Start(background)
+
+	serv := server.NewHttpServer(cfg.Server.Addr)
+	if cfg.Server.IdleTimeout != "" {
+		serv.IdleTimeout, _ = time.ParseDuration(cfg.Server.IdleTimeout)
+	}
+	if cfg.Server.MaxRequestsPerConn > 0 {
+		serv.MaxRequestsPerConn = cfg.Server.MaxRequestsPerConn
+	}
+	if cfg.Server.ReadHeaderTimeout != "" {
+		serv.ReadHeaderTimeout, _ = time.ParseDuration(cfg.Server.ReadHeaderTimeout)
+	}
+	if cfg.Server.ReadTimeout != "" {
+		serv.ReadTimeout, _ = time.ParseDuration(cfg.Server.ReadTimeout)
+	}
+	if cfg.Server.MaxBodySize > 0 {
+		serv.MaxBodySize = cfg.Server.MaxBodySize
+	}
+	if tlsCfg := cfg.Server.TLS; tlsCfg != nil {
+		serv.TLSConfig, err = server.NewTLSConfig(tlsCfg.CertFile, tlsCfg.KeyFile, tlsCfg.ClientCAFile)
+		if err != nil {
+			logrus.Fatalf("Failed to set up TLS: %v", err)
+		}
+	}
+	serv.Use(server.RequestID, server.AccessLog, server.Recovery, server.Compress)
+	if len(cfg.Server.CORSOrigins) > 0 {
+		serv.Use(server.CORS(cfg.Server.CORSOrigins...))
+	}
+
 	prdctrl := handlers.NewProductController()
-	serv := server.NewHttpServer(":8080")
 	serv.GET("/", prdctrl.GetAllProducts)
 	serv.POST("/webhook", func(ctx *server.HttpContext) {
 		handlers.WebHookHandlerWithConfig(ctx, cfg)
 	})
 	serv.GET("/status", status.StatusHandler)
+	serv.GET("/status/:id", status.RunStatusHandler)
 
-	if err := serv.Start(); err != nil {
-		fmt.Printf("Server failed: %v\n", err)
+	runsctrl := handlers.NewRunsController(cfg)
+	apiAuth := []server.MiddlewareFunc{handlers.APIAuth(cfg)}
+	if tlsCfg := cfg.Server.TLS; tlsCfg != nil && tlsCfg.ClientCAFile != "" {
+		apiAuth = append([]server.MiddlewareFunc{server.RequireClientCert(tlsCfg.ClientNames...)}, apiAuth...)
+	}
+	runs := serv.Group("/runs", apiAuth...)
+	runs.POST("", runsctrl.TriggerRun)
+	runs.POST("/:id/rerun", runsctrl.RerunRun)
+	runs.POST("/:id/cancel", runsctrl.CancelRun)
+	runs.POST("/:id/promote", runsctrl.PromoteRun)
+	runs.POST("/:id/approve", runsctrl.ApproveRun)
+
+	deploysctrl := handlers.NewDeploymentsController(cfg)
+	deploys := serv.Group("/deployments", apiAuth...)
+	deploys.GET("", deploysctrl.List)
+	deploys.POST("/:id/rollback", deploysctrl.Rollback)
+	envs := serv.Group("/environments", apiAuth...)
+	envs.GET("/:name", deploysctrl.Environment)
+	envs.POST("/:name/lock", deploysctrl.Lock)
+	envs.DELETE("/:name/lock", deploysctrl.Unlock)
+
+	// Build artifacts for download, and the dashboard when configured
+	serv.Static("/artifacts", cfg.Build.OutputPath, apiAuth...)
+	if cfg.Server.DashboardDir != "" {
+		serv.Static("/ui", cfg.Server.DashboardDir)
+	}
+
+	if err := git.ResumeQueued(cfg, st); err != nil {
+		logrus.Errorf("Failed to resume queued runs: %v", err)
+	}
+
+	go func() {
+		if err := serv.Start(); err != nil && err != server.ErrServerClosed {
+			logrus.Fatalf("Server failed: %v", err)
+		}
+	}()
+
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGINT, syscall.SIGTERM)
+	sig := <-signals
+	stopBackground()
+	shutdown(serv, st, shutdownTimeout(cfg), sig)
+}
+
+const defaultShutdownTimeout = 60 * time.Second
+
+func shutdownTimeout(cfg *config.PipelineConfig) time.Duration {
+	if timeout, err := time.ParseDuration(cfg.Server.ShutdownTimeout); err == nil && timeout > 0 {
+		return timeout
+	}
+	return defaultShutdownTimeout
+}
+
+// shutdown stops the HTTP server and drains running pipelines within timeout,
+// saving whatever could not finish so it resumes on the next start
+func shutdown(serv *server.Server, st *store.Store, timeout time.Duration, sig os.Signal) {
+	logrus.Infof("Received %s, shutting down (timeout %s)...", sig, timeout)
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	if err := serv.Shutdown(ctx); err != nil {
+		logrus.Warnf("HTTP server did not shut down cleanly: %v", err)
+	}
+	if err := git.Drain(ctx, st); err != nil {
+		logrus.Errorf("Failed to save pipeline state: %v", err)
 	}
+	logrus.Info("Shutdown complete")
 }
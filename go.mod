@@ -3,7 +3,11 @@ module github.com/khaledibrahim1015/goFlow-cicd
 go 1.24.0
 
 require (
-	github.com/sirupsen/logrus v1.9.3 // indirect
-	golang.org/x/sys v0.0.0-20220715151400-c0bba94af5f8 // indirect
-	gopkg.in/yaml.v3 v3.0.1 // indirect
+	github.com/pkg/sftp v1.13.9
+	github.com/sirupsen/logrus v1.9.3
+	golang.org/x/crypto v0.38.0
+	golang.org/x/sys v0.33.0
+	gopkg.in/yaml.v3 v3.0.1
 )
+
+require github.com/kr/fs v0.1.0 // indirect
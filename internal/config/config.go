@@ -4,10 +4,13 @@ import (
 	"encoding/json"
 	"flag"
 	"fmt"
+	"net/url"
 	"os"
 	"path/filepath"
 	"strings"
+	"time"
 
+	"github.com/khaledibrahim1015/goFlow-cicd/pkg/cron"
 	"github.com/sirupsen/logrus"
 	"gopkg.in/yaml.v3"
 )
@@ -17,6 +20,61 @@ type RepositoryConfig struct {
 	URL    string `json:"url" yaml:"url"`
 	Branch string `json:"branch" yaml:"branch"`
 	Secret string `json:"secret" yaml:"secret"`
+	// Commit status reporting (optional)
+	Provider string `json:"provider,omitempty" yaml:"provider,omitempty"` // "github", "gitlab"; inferred from url when empty
+	Token    string `json:"token,omitempty" yaml:"token,omitempty"`       // API token used to post commit statuses
+	APIURL   string `json:"api_url,omitempty" yaml:"api_url,omitempty"`   // e.g., "https://api.github.com", "https://gitlab.com/api/v4"
+	// Polling for repositories that cannot send webhooks (optional)
+	PollInterval string `json:"poll_interval,omitempty" yaml:"poll_interval,omitempty"` // e.g., "1m", "30s"
+	// Periodic runs of the configured branch (optional)
+	Schedules []ScheduleConfig `json:"schedules,omitempty" yaml:"schedules,omitempty"`
+}
+
+// ScheduleConfig triggers the pipeline on a cron schedule
+type ScheduleConfig struct {
+	Cron     string `json:"cron" yaml:"cron"`                             // standard 5-field expression, e.g., "0 2 * * *"
+	Timezone string `json:"timezone,omitempty" yaml:"timezone,omitempty"` // e.g., "Europe/Berlin", defaults to UTC
+}
+
+// APIConfig protects the run management endpoints
+type APIConfig struct {
+	Tokens []APIToken `json:"tokens" yaml:"tokens"`
+}
+
+// APIToken is a bearer token identifying an API user
+type APIToken struct {
+	User  string `json:"user" yaml:"user"`
+	Token string `json:"token" yaml:"token"`
+}
+
+// ServerConfig defines the built-in HTTP server
+type ServerConfig struct {
+	Addr      string `json:"addr,omitempty" yaml:"addr,omitempty"`             // listen address, defaults to ":8080"
+	PublicURL string `json:"public_url,omitempty" yaml:"public_url,omitempty"` // e.g., "https://goflow.example.com", used for links to runs
+	// Persistent connections
+	IdleTimeout        string `json:"idle_timeout,omitempty" yaml:"idle_timeout,omitempty"`                   // e.g., "60s"
+	MaxRequestsPerConn int    `json:"max_requests_per_conn,omitempty" yaml:"max_requests_per_conn,omitempty"` // 0 keeps the server default
+	// Request limits
+	ReadHeaderTimeout string `json:"read_header_timeout,omitempty" yaml:"read_header_timeout,omitempty"` // e.g., "10s"
+	ReadTimeout       string `json:"read_timeout,omitempty" yaml:"read_timeout,omitempty"`               // e.g., "30s", time allowed for the body
+	MaxBodySize       int64  `json:"max_body_size,omitempty" yaml:"max_body_size,omitempty"`             // bytes, 0 keeps the server default
+	// Browser access
+	CORSOrigins []string `json:"cors_origins,omitempty" yaml:"cors_origins,omitempty"` // e.g., ["https://dashboard.example.com"], "*" for any
+	// How long shutdown waits for requests and running pipelines, e.g., "5m"
+	ShutdownTimeout string `json:"shutdown_timeout,omitempty" yaml:"shutdown_timeout,omitempty"`
+	// Directory with the web dashboard files, served at /ui/ (optional)
+	DashboardDir string `json:"dashboard_dir,omitempty" yaml:"dashboard_dir,omitempty"`
+	// HTTPS (optional)
+	TLS *TLSConfig `json:"tls,omitempty" yaml:"tls,omitempty"`
+}
+
+// TLSConfig enables HTTPS, and client certificates for the API endpoints
+type TLSConfig struct {
+	CertFile string `json:"cert_file" yaml:"cert_file"` // PEM, reloaded when it changes
+	KeyFile  string `json:"key_file" yaml:"key_file"`
+	// When set, the API endpoints require a client certificate signed by this CA
+	ClientCAFile string   `json:"client_ca_file,omitempty" yaml:"client_ca_file,omitempty"`
+	ClientNames  []string `json:"client_names,omitempty" yaml:"client_names,omitempty"` // allowed certificate CN/DNS names, any when empty
 }
 
 // BuildConfig defines the build step
@@ -35,12 +93,31 @@ type TestConfig struct {
 	Version    string `json:"version" yaml:"version"`
 }
 type DeployConfig struct {
-	Method string `json:"method" yaml:"method"` // "ssh", "docker", "k8s" , etc
+	Method string `json:"method" yaml:"method"` // "ssh", "docker", "kubernetes" (or "k8s"), "local", "http_upload"
 	// Defferent methods configurations
-	SSH            *SSHConfig    `json:"ssh,omitempty" yaml:"ssh,omitempty"`
-	Docker         *DockerConfig `json:"docker,omitempty" yaml:"docker,omitempty"`
-	RollbackScript string        `json:"rollback_script" yaml:"rollback_script"`
-	PostDeployCmds []string      `json:"post_deploy_cmds" yaml:"post_deploy_cmds"`
+	SSH            *SSHConfig        `json:"ssh,omitempty" yaml:"ssh,omitempty"`
+	Docker         *DockerConfig     `json:"docker,omitempty" yaml:"docker,omitempty"` // for kubernetes, builds and pushes the image to roll out
+	Kubernetes     *KubernetesConfig `json:"kubernetes,omitempty" yaml:"kubernetes,omitempty"`
+	Local          *LocalConfig      `json:"local,omitempty" yaml:"local,omitempty"`
+	HTTPUpload     *HTTPUploadConfig `json:"http_upload,omitempty" yaml:"http_upload,omitempty"`
+	RollbackScript string            `json:"rollback_script" yaml:"rollback_script"` // GOFLOW_UPDATED_HOSTS lists the ssh hosts the deploy changed
+	PostDeployCmds []string          `json:"post_deploy_cmds" yaml:"post_deploy_cmds"`
+	// Checked after the deploy; the deploy fails and is rolled back when it doesn't pass
+	HealthCheck *HealthCheckConfig `json:"health_check,omitempty" yaml:"health_check,omitempty"`
+}
+
+// HealthCheckConfig probes the deployed application with exactly one of URL, TCP
+// or Command. For ssh deploys each host is checked, "{host}" in URL and TCP is
+// replaced with its name.
+type HealthCheckConfig struct {
+	URL          string `json:"url,omitempty" yaml:"url,omitempty"`                     // GET, e.g. "http://{host}:8080/healthz"
+	ExpectStatus int    `json:"expect_status,omitempty" yaml:"expect_status,omitempty"` // defaults to 200
+	ExpectBody   string `json:"expect_body,omitempty" yaml:"expect_body,omitempty"`     // must appear in the response body
+	TCP          string `json:"tcp,omitempty" yaml:"tcp,omitempty"`                     // "host:port" that must accept connections, e.g. "{host}:5432"
+	Command      string `json:"command,omitempty" yaml:"command,omitempty"`             // runs on the deploy host for ssh, locally otherwise
+	Retries      int    `json:"retries,omitempty" yaml:"retries,omitempty"`             // attempts, defaults to 5
+	Interval     string `json:"interval,omitempty" yaml:"interval,omitempty"`           // between attempts, defaults to "5s"
+	Timeout      string `json:"timeout,omitempty" yaml:"timeout,omitempty"`             // per attempt, defaults to "10s"
 }
 
 // SSHConfig for ssh deployment
@@ -49,7 +126,52 @@ type SSHConfig struct {
 	RemoteHost   string `json:"remote_host" yaml:"remote_host"`
 	RemotePath   string `json:"remote_path" yaml:"remote_path"`
 	KeyPath      string `json:"key_path" yaml:"key_path"`
-	RsyncOptions string `json:"rsync_options,omitempty"` // Add rsync options field
+	RsyncOptions string `json:"rsync_options,omitempty"` // rejected by validate, files are synced over SFTP
+	// When set, each deploy goes to remote_path/releases/<timestamp-sha> and
+	// remote_path/current is switched to it; this many releases are kept, at least 2
+	KeepReleases int `json:"keep_releases,omitempty" yaml:"keep_releases,omitempty"`
+	// More hosts to deploy to, each either a host name or the name of one of host_groups
+	Hosts      []string            `json:"hosts,omitempty" yaml:"hosts,omitempty"`
+	HostGroups map[string][]string `json:"host_groups,omitempty" yaml:"host_groups,omitempty"` // e.g. {"web": ["web1", "web2"]}
+	Rolling    *RollingConfig      `json:"rolling,omitempty" yaml:"rolling,omitempty"`
+	Port       int                 `json:"port,omitempty" yaml:"port,omitempty"` // defaults to 22, hosts may also be given as "host:port"
+	// Host keys are verified against known_hosts (default ~/.ssh/known_hosts) unless insecure_ignore_host_key is set
+	KnownHosts            string `json:"known_hosts,omitempty" yaml:"known_hosts,omitempty"`
+	InsecureIgnoreHostKey bool   `json:"insecure_ignore_host_key,omitempty" yaml:"insecure_ignore_host_key,omitempty"`
+	UseAgent              bool   `json:"use_agent,omitempty" yaml:"use_agent,omitempty"` // also offer the keys of SSH_AUTH_SOCK, always done without key_path
+}
+
+// RollingConfig controls how many hosts are updated at once. A failure stops
+// the deploy and rolls back every host updated so far.
+type RollingConfig struct {
+	BatchSize      int    `json:"batch_size,omitempty" yaml:"batch_size,omitempty"`           // hosts updated together, defaults to 1
+	MaxUnavailable int    `json:"max_unavailable,omitempty" yaml:"max_unavailable,omitempty"` // hosts out of service at once, caps batch_size
+	Pause          string `json:"pause,omitempty" yaml:"pause,omitempty"`                     // wait between batches, e.g. "30s"
+}
+
+// Targets returns the hosts to deploy to in order, with host groups expanded
+// and duplicates removed
+func (s *SSHConfig) Targets() []string {
+	var targets []string
+	seen := make(map[string]bool)
+	add := func(host string) {
+		if host != "" && !seen[host] {
+			seen[host] = true
+			targets = append(targets, host)
+		}
+	}
+	add(s.RemoteHost)
+	for _, name := range s.Hosts {
+		group, isGroup := s.HostGroups[name]
+		if !isGroup {
+			add(name)
+			continue
+		}
+		for _, host := range group {
+			add(host)
+		}
+	}
+	return targets
 }
 
 // DockerConfig for Docker deployments
@@ -59,6 +181,49 @@ type DockerConfig struct {
 	Username    string `json:"username" yaml:"username"`
 	Password    string `json:"password" yaml:"password"`
 	ComposeFile string `json:"compose_file" yaml:"compose_file"`
+	// Image build, relative to the repository root
+	Dockerfile string            `json:"dockerfile,omitempty" yaml:"dockerfile,omitempty"` // defaults to "Dockerfile"
+	Context    string            `json:"context,omitempty" yaml:"context,omitempty"`       // defaults to "."
+	BuildArgs  map[string]string `json:"build_args,omitempty" yaml:"build_args,omitempty"` // GIT_COMMIT and GIT_REF are always passed
+	Tags       []string          `json:"tags,omitempty" yaml:"tags,omitempty"`             // extra tags, e.g. ["latest"]; commit, branch and tag names are added
+	SkipPush   bool              `json:"skip_push,omitempty" yaml:"skip_push,omitempty"`   // keep the image local, e.g. for compose on this host
+	CLI        string            `json:"cli,omitempty" yaml:"cli,omitempty"`               // container CLI, defaults to "docker"
+}
+
+// KubernetesConfig for Kubernetes deployments. Manifests are Go templates
+// rendered with .Image, .Tag, .Commit, .Ref, .Namespace and the run variables in .Env.
+type KubernetesConfig struct {
+	Manifests  []string `json:"manifests,omitempty" yaml:"manifests,omitempty"`   // files or directories in the repository
+	Kustomize  string   `json:"kustomize,omitempty" yaml:"kustomize,omitempty"`   // overlay directory, instead of manifests
+	Image      string   `json:"image,omitempty" yaml:"image,omitempty"`           // tagged with the commit; not needed when deploy.docker builds it
+	Kubeconfig string   `json:"kubeconfig,omitempty" yaml:"kubeconfig,omitempty"` // defaults to kubectl's own lookup
+	Context    string   `json:"context,omitempty" yaml:"context,omitempty"`
+	Namespace  string   `json:"namespace,omitempty" yaml:"namespace,omitempty"`
+	// Workloads to wait for, e.g. ["deployment/api"]; defaults to the applied deployments, statefulsets and daemonsets
+	Rollouts       []string `json:"rollouts,omitempty" yaml:"rollouts,omitempty"`
+	RolloutTimeout string   `json:"rollout_timeout,omitempty" yaml:"rollout_timeout,omitempty"` // e.g. "5m", the default
+	Kubectl        string   `json:"kubectl,omitempty" yaml:"kubectl,omitempty"`                 // defaults to "kubectl"
+}
+
+// LocalConfig for deploys to a directory of this host, e.g. a shared mount.
+// The build output is copied next to path and swapped in with a rename; the
+// replaced directory is kept as "<path>.previous" for rollback.
+type LocalConfig struct {
+	Path string `json:"path" yaml:"path"`
+}
+
+// HTTPUploadConfig for uploads to an artifact repository (Nexus, Artifactory or
+// any server taking raw uploads). Every file of the build output is sent to url
+// followed by its relative path, with X-Checksum-Sha1, -Sha256 and -Md5 headers.
+// Credentials and header values may reference run variables and secrets as "$VAR".
+type HTTPUploadConfig struct {
+	URL      string            `json:"url" yaml:"url"`                               // "{commit}" and "{ref}" are replaced, e.g. "https://nexus.example.com/repository/raw/app/{commit}"
+	Method   string            `json:"method,omitempty" yaml:"method,omitempty"`     // "PUT" (the default) or "POST", the file is the request body
+	Username string            `json:"username,omitempty" yaml:"username,omitempty"` // basic auth
+	Password string            `json:"password,omitempty" yaml:"password,omitempty"` // e.g. "$NEXUS_PASSWORD"
+	Token    string            `json:"token,omitempty" yaml:"token,omitempty"`       // bearer token, instead of basic auth
+	Headers  map[string]string `json:"headers,omitempty" yaml:"headers,omitempty"`   // extra request headers
+	Timeout  string            `json:"timeout,omitempty" yaml:"timeout,omitempty"`   // per file, defaults to "5m"
 }
 
 // PipelineConfig holds the full configuration
@@ -67,6 +232,117 @@ type PipelineConfig struct {
 	Build        BuildConfig        `json:"build" yaml:"build"`
 	Test         TestConfig         `json:"test" yaml:"test"`
 	Deploy       DeployConfig       `json:"deploy" yaml:"deploy"`
+	Server       ServerConfig       `json:"server" yaml:"server"`
+	API          APIConfig          `json:"api" yaml:"api"`
+	StateDir     string             `json:"state_dir,omitempty" yaml:"state_dir,omitempty"`       // where goFlow keeps state across restarts
+	CleanupCmds  []string           `json:"cleanup_cmds,omitempty" yaml:"cleanup_cmds,omitempty"` // run in the checkout when a run is cancelled
+	// Deploy targets in promotion order, e.g. dev, staging, prod. Runs deploy to
+	// the first one unless they name another.
+	Environments []EnvironmentConfig `json:"environments,omitempty" yaml:"environments,omitempty"`
+}
+
+// EnvironmentConfig is a named deploy target
+type EnvironmentConfig struct {
+	Name      string            `json:"name" yaml:"name"`
+	Deploy    DeployConfig      `json:"deploy,omitempty" yaml:"deploy,omitempty"`       // replaces the top-level deploy when its method is set
+	Secrets   map[string]string `json:"secrets,omitempty" yaml:"secrets,omitempty"`     // environment variables added for the deploy stage only
+	Protected bool              `json:"protected,omitempty" yaml:"protected,omitempty"` // deploys wait for POST /runs/:id/approve
+	Approvers []string          `json:"approvers,omitempty" yaml:"approvers,omitempty"` // API users allowed to approve, required when protected; never the user who triggered the run
+	// Periods without deploys; builds and tests still run
+	Freezes []FreezeWindow `json:"freezes,omitempty" yaml:"freezes,omitempty"`
+	// What runs do during a freeze or deploy lock: "skip" (the default) finishes
+	// without deploying, "wait" holds the deploy until it ends
+	OnFreeze string `json:"on_freeze,omitempty" yaml:"on_freeze,omitempty"`
+}
+
+// FreezeWindow is a period without deploys: from start to end, or for
+// duration from every time cron matches
+type FreezeWindow struct {
+	Name     string `json:"name,omitempty" yaml:"name,omitempty"`         // shown in the run status, e.g. "year-end"
+	Start    string `json:"start,omitempty" yaml:"start,omitempty"`       // RFC 3339 time or date, e.g. "2026-12-20"
+	End      string `json:"end,omitempty" yaml:"end,omitempty"`           // excluded, a date means its midnight
+	Cron     string `json:"cron,omitempty" yaml:"cron,omitempty"`         // e.g. "0 16 * * fri"
+	Duration string `json:"duration,omitempty" yaml:"duration,omitempty"` // with cron, e.g. "64h" for the weekend
+	Timezone string `json:"timezone,omitempty" yaml:"timezone,omitempty"` // of dates and cron, defaults to UTC
+}
+
+// ActiveAt reports whether t falls in the window, and when the window ends
+func (f *FreezeWindow) ActiveAt(t time.Time) (time.Time, bool) {
+	loc, err := time.LoadLocation(f.Timezone)
+	if err != nil {
+		return time.Time{}, false
+	}
+	t = t.In(loc)
+	if f.Cron == "" {
+		start, errStart := parseFreezeTime(f.Start, loc)
+		end, errEnd := parseFreezeTime(f.End, loc)
+		if errStart != nil || errEnd != nil {
+			return time.Time{}, false
+		}
+		return end, !t.Before(start) && t.Before(end)
+	}
+
+	schedule, err := cron.Parse(f.Cron)
+	duration, errDuration := time.ParseDuration(f.Duration)
+	if err != nil || errDuration != nil || duration <= 0 {
+		return time.Time{}, false
+	}
+	// The first match within duration before t, then the matches extending it
+	start := schedule.Next(t.Add(-duration - time.Minute))
+	if start.IsZero() || start.After(t) {
+		return time.Time{}, false
+	}
+	end := start.Add(duration)
+	for next, i := schedule.Next(start), 0; !next.IsZero() && !next.After(end) && i < 1000; next, i = schedule.Next(next), i+1 {
+		end = next.Add(duration)
+	}
+	return end, t.Before(end)
+}
+
+func parseFreezeTime(value string, loc *time.Location) (time.Time, error) {
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t, nil
+	}
+	return time.ParseInLocation("2006-01-02", value, loc)
+}
+
+// Environment returns the environment with the given name, or nil
+func (cfg *PipelineConfig) Environment(name string) *EnvironmentConfig {
+	for i := range cfg.Environments {
+		if cfg.Environments[i].Name == name {
+			return &cfg.Environments[i]
+		}
+	}
+	return nil
+}
+
+// NextEnvironment returns the environment a run in name is promoted to, "" for the last one
+func (cfg *PipelineConfig) NextEnvironment(name string) string {
+	for i := range cfg.Environments {
+		if cfg.Environments[i].Name == name && i+1 < len(cfg.Environments) {
+			return cfg.Environments[i+1].Name
+		}
+	}
+	return ""
+}
+
+// ForEnvironment returns a copy of cfg that deploys the way the environment does
+func (cfg *PipelineConfig) ForEnvironment(env *EnvironmentConfig) *PipelineConfig {
+	envCfg := *cfg
+	if env != nil && env.Deploy.Method != "" {
+		envCfg.Deploy = env.Deploy
+	}
+	return &envCfg
+}
+
+// Repository returns the configured repository with the given url, or nil
+func (cfg *PipelineConfig) Repository(url string) *RepositoryConfig {
+	for i := range cfg.Repositories {
+		if cfg.Repositories[i].URL == url {
+			return &cfg.Repositories[i]
+		}
+	}
+	return nil
 }
 
 // func LOadV2
@@ -155,6 +431,29 @@ func validate(cfg *PipelineConfig) error {
 		if repo.URL == "" || repo.Branch == "" || repo.Secret == "" {
 			return fmt.Errorf("repository %d: url, branch, and secret required", i)
 		}
+		if repo.Provider != "" && repo.Provider != "github" && repo.Provider != "gitlab" {
+			return fmt.Errorf("repository %d: unsupported provider: %s", i, repo.Provider)
+		}
+		if repo.PollInterval != "" {
+			interval, err := time.ParseDuration(repo.PollInterval)
+			if err != nil || interval <= 0 {
+				return fmt.Errorf("repository %d: invalid poll_interval %q", i, repo.PollInterval)
+			}
+		}
+		for j, schedule := range repo.Schedules {
+			if _, err := cron.Parse(schedule.Cron); err != nil {
+				return fmt.Errorf("repository %d: schedule %d: %v", i, j, err)
+			}
+			if _, err := time.LoadLocation(schedule.Timezone); err != nil {
+				return fmt.Errorf("repository %d: schedule %d: invalid timezone %q", i, j, schedule.Timezone)
+			}
+		}
+	}
+
+	for i, token := range cfg.API.Tokens {
+		if token.User == "" || token.Token == "" {
+			return fmt.Errorf("api token %d: user and token required", i)
+		}
 	}
 
 	if cfg.Build.Type == "" {
@@ -170,24 +469,204 @@ func validate(cfg *PipelineConfig) error {
 	if cfg.Test.Type != "dotnet" && cfg.Test.Type != "java" {
 		return fmt.Errorf("unsupported test type: %s", cfg.Test.Type)
 	}
-	if cfg.Deploy.Method != "" {
-		switch cfg.Deploy.Method {
+	if err := validateDeploy(&cfg.Deploy); err != nil {
+		return err
+	}
+	seen := make(map[string]bool)
+	for i, env := range cfg.Environments {
+		if env.Name == "" {
+			return fmt.Errorf("environment %d: name required", i)
+		}
+		if seen[env.Name] {
+			return fmt.Errorf("environment %q is defined twice", env.Name)
+		}
+		seen[env.Name] = true
+		if err := validateDeploy(&env.Deploy); err != nil {
+			return fmt.Errorf("environment %q: %v", env.Name, err)
+		}
+		if env.Protected && len(env.Approvers) == 0 {
+			return fmt.Errorf("environment %q: protected requires approvers", env.Name)
+		}
+		if env.OnFreeze != "" && env.OnFreeze != "skip" && env.OnFreeze != "wait" {
+			return fmt.Errorf("environment %q: on_freeze must be skip or wait, got %q", env.Name, env.OnFreeze)
+		}
+		for j, freeze := range env.Freezes {
+			if err := validateFreeze(&freeze); err != nil {
+				return fmt.Errorf("environment %q: freeze %d: %v", env.Name, j, err)
+			}
+		}
+	}
+	if cfg.Server.Addr == "" {
+		cfg.Server.Addr = ":8080"
+	}
+	for name, value := range map[string]string{
+		"idle_timeout":        cfg.Server.IdleTimeout,
+		"read_header_timeout": cfg.Server.ReadHeaderTimeout,
+		"read_timeout":        cfg.Server.ReadTimeout,
+		"shutdown_timeout":    cfg.Server.ShutdownTimeout,
+	} {
+		if value == "" {
+			continue
+		}
+		if _, err := time.ParseDuration(value); err != nil {
+			return fmt.Errorf("server: invalid %s %q", name, value)
+		}
+	}
+	if tlsCfg := cfg.Server.TLS; tlsCfg != nil {
+		if tlsCfg.CertFile == "" || tlsCfg.KeyFile == "" {
+			return fmt.Errorf("server: tls requires cert_file and key_file")
+		}
+		if len(tlsCfg.ClientNames) > 0 && tlsCfg.ClientCAFile == "" {
+			return fmt.Errorf("server: tls client_names requires client_ca_file")
+		}
+	}
+	if cfg.StateDir == "" {
+		cfg.StateDir = filepath.Join(os.Getenv("HOME"), ".goflow")
+	}
+	// Validate output_path exists or can be created (optional)
+	if err := os.MkdirAll(cfg.Build.OutputPath, 0755); err != nil {
+		return fmt.Errorf("invalid output_path %s: %v", cfg.Build.OutputPath, err)
+	}
+	return nil
+}
+
+// validateFreeze checks that the window has either start and end, or cron and duration
+func validateFreeze(f *FreezeWindow) error {
+	loc, err := time.LoadLocation(f.Timezone)
+	if err != nil {
+		return fmt.Errorf("invalid timezone %q", f.Timezone)
+	}
+	if f.Cron != "" {
+		if f.Start != "" || f.End != "" {
+			return fmt.Errorf("use either cron or start and end, not both")
+		}
+		if _, err := cron.Parse(f.Cron); err != nil {
+			return err
+		}
+		if d, err := time.ParseDuration(f.Duration); err != nil || d <= 0 {
+			return fmt.Errorf("cron requires a positive duration, got %q", f.Duration)
+		}
+		return nil
+	}
+	start, err := parseFreezeTime(f.Start, loc)
+	if err != nil {
+		return fmt.Errorf("invalid start %q", f.Start)
+	}
+	end, err := parseFreezeTime(f.End, loc)
+	if err != nil {
+		return fmt.Errorf("invalid end %q", f.End)
+	}
+	if !end.After(start) {
+		return fmt.Errorf("end %q is not after start %q", f.End, f.Start)
+	}
+	return nil
+}
+
+// validateDeploy checks the settings of the configured deploy method
+func validateDeploy(deploy *DeployConfig) error {
+	if deploy.Method != "" {
+		switch deploy.Method {
 		case "ssh":
-			if cfg.Deploy.SSH == nil || cfg.Deploy.SSH.RemoteUser == "" || cfg.Deploy.SSH.RemoteHost == "" || cfg.Deploy.SSH.RemotePath == "" {
-				return fmt.Errorf("ssh deployment requires remote_user, remote_host, and remote_path")
+			sshCfg := deploy.SSH
+			if sshCfg == nil || sshCfg.RemoteUser == "" || len(sshCfg.Targets()) == 0 || sshCfg.RemotePath == "" {
+				return fmt.Errorf("ssh deployment requires remote_user, remote_host or hosts, and remote_path")
+			}
+			if sshCfg.RsyncOptions != "" {
+				return fmt.Errorf("ssh: rsync_options is no longer supported, files are synced over SFTP like rsync -a; " +
+					"remove it, and use keep_releases to hard-link unchanged files like --link-dest")
+			}
+			// Hosts updated before a failing one can only be rolled back from a release or by a script
+			if len(sshCfg.Targets()) > 1 && sshCfg.KeepReleases == 0 && deploy.RollbackScript == "" {
+				return fmt.Errorf("ssh: deploying to several hosts requires keep_releases or rollback_script, to roll back the hosts updated before a failure")
+			}
+			// One release would be the current one, pruning would leave nothing to roll back to
+			if sshCfg.KeepReleases < 0 || sshCfg.KeepReleases == 1 {
+				return fmt.Errorf("ssh: keep_releases must be 0 to deploy in place, or at least 2, got %d", sshCfg.KeepReleases)
+			}
+			for name, group := range sshCfg.HostGroups {
+				if len(group) == 0 {
+					return fmt.Errorf("ssh: host group %q is empty", name)
+				}
+			}
+			if rolling := sshCfg.Rolling; rolling != nil {
+				if rolling.BatchSize < 0 || rolling.MaxUnavailable < 0 {
+					return fmt.Errorf("ssh: rolling batch_size and max_unavailable must not be negative")
+				}
+				if rolling.Pause != "" {
+					if d, err := time.ParseDuration(rolling.Pause); err != nil || d < 0 {
+						return fmt.Errorf("ssh: invalid rolling pause %q", rolling.Pause)
+					}
+				}
 			}
 		case "docker":
-			if cfg.Deploy.Docker == nil || cfg.Deploy.Docker.Image == "" {
+			if deploy.Docker == nil || deploy.Docker.Image == "" {
 				return fmt.Errorf("docker deployment requires image")
 			}
+		case "kubernetes", "k8s":
+			k8s := deploy.Kubernetes
+			if k8s == nil || (len(k8s.Manifests) == 0 && k8s.Kustomize == "") {
+				return fmt.Errorf("kubernetes deployment requires manifests or kustomize")
+			}
+			if len(k8s.Manifests) > 0 && k8s.Kustomize != "" {
+				return fmt.Errorf("kubernetes: use either manifests or kustomize, not both")
+			}
+			if k8s.Image == "" && (deploy.Docker == nil || deploy.Docker.Image == "") {
+				return fmt.Errorf("kubernetes deployment requires image, or docker to build one")
+			}
+			if k8s.RolloutTimeout != "" {
+				if _, err := time.ParseDuration(k8s.RolloutTimeout); err != nil {
+					return fmt.Errorf("kubernetes: invalid rollout_timeout %q", k8s.RolloutTimeout)
+				}
+			}
+		case "local":
+			if deploy.Local == nil || deploy.Local.Path == "" {
+				return fmt.Errorf("local deployment requires path")
+			}
+		case "http_upload":
+			upload := deploy.HTTPUpload
+			if upload == nil || upload.URL == "" {
+				return fmt.Errorf("http_upload deployment requires url")
+			}
+			if u, err := url.Parse(upload.URL); err != nil || (u.Scheme != "http" && u.Scheme != "https") {
+				return fmt.Errorf("http_upload: invalid url %q", upload.URL)
+			}
+			if method := strings.ToUpper(upload.Method); method != "" && method != "PUT" && method != "POST" {
+				return fmt.Errorf("http_upload: method must be PUT or POST, got %q", upload.Method)
+			}
+			if upload.Token != "" && upload.Username != "" {
+				return fmt.Errorf("http_upload: use either token or username, not both")
+			}
+			if upload.Timeout != "" {
+				if _, err := time.ParseDuration(upload.Timeout); err != nil {
+					return fmt.Errorf("http_upload: invalid timeout %q", upload.Timeout)
+				}
+			}
 
 		default:
-			return fmt.Errorf("unsupported deploy method: %s", cfg.Deploy.Method)
+			return fmt.Errorf("unsupported deploy method: %s", deploy.Method)
 		}
 	}
-	// Validate output_path exists or can be created (optional)
-	if err := os.MkdirAll(cfg.Build.OutputPath, 0755); err != nil {
-		return fmt.Errorf("invalid output_path %s: %v", cfg.Build.OutputPath, err)
+	if hc := deploy.HealthCheck; hc != nil {
+		probes := 0
+		for _, probe := range []string{hc.URL, hc.TCP, hc.Command} {
+			if probe != "" {
+				probes++
+			}
+		}
+		if probes != 1 {
+			return fmt.Errorf("health_check requires exactly one of url, tcp or command")
+		}
+		if hc.Retries < 0 {
+			return fmt.Errorf("health_check: invalid retries %d", hc.Retries)
+		}
+		for name, value := range map[string]string{"interval": hc.Interval, "timeout": hc.Timeout} {
+			if value == "" {
+				continue
+			}
+			if d, err := time.ParseDuration(value); err != nil || d <= 0 {
+				return fmt.Errorf("health_check: invalid %s %q", name, value)
+			}
+		}
 	}
 	return nil
 }
@@ -0,0 +1,59 @@
+package config
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestValidateDeployKeepReleases(t *testing.T) {
+	for keep, want := range map[int]string{
+		-1: "keep_releases",
+		1:  "keep_releases",
+		0:  "",
+		2:  "",
+	} {
+		deploy := &DeployConfig{Method: "ssh", SSH: &SSHConfig{
+			RemoteUser: "deploy", RemoteHost: "web1", RemotePath: "/srv/app", KeepReleases: keep,
+		}}
+		err := validateDeploy(deploy)
+		if want == "" && err != nil {
+			t.Errorf("keep_releases %d: %v", keep, err)
+		}
+		if want != "" && (err == nil || !strings.Contains(err.Error(), want)) {
+			t.Errorf("keep_releases %d: err = %v", keep, err)
+		}
+	}
+}
+
+func TestValidateProtectedRequiresApprovers(t *testing.T) {
+	cfg := &PipelineConfig{
+		Repositories: []RepositoryConfig{{URL: "https://github.com/acme/app.git", Branch: "main", Secret: "s"}},
+		Build:        BuildConfig{Type: "dotnet", OutputPath: t.TempDir()},
+		Test:         TestConfig{Type: "dotnet"},
+		Environments: []EnvironmentConfig{{Name: "prod", Protected: true}},
+	}
+	if err := validate(cfg); err == nil || !strings.Contains(err.Error(), "approvers") {
+		t.Errorf("protected without approvers: err = %v", err)
+	}
+	cfg.Environments[0].Approvers = []string{"alice"}
+	if err := validate(cfg); err != nil {
+		t.Errorf("protected with approvers: %v", err)
+	}
+}
+
+func TestValidateDeployMultiHostRollback(t *testing.T) {
+	deploy := &DeployConfig{Method: "ssh", SSH: &SSHConfig{
+		RemoteUser: "deploy", Hosts: []string{"web1", "web2"}, RemotePath: "/srv/app",
+	}}
+	if err := validateDeploy(deploy); err == nil || !strings.Contains(err.Error(), "rollback_script") {
+		t.Errorf("without a way to roll back: err = %v", err)
+	}
+	deploy.RollbackScript = "scripts/rollback.sh"
+	if err := validateDeploy(deploy); err != nil {
+		t.Errorf("with rollback_script: %v", err)
+	}
+	deploy.RollbackScript, deploy.SSH.KeepReleases = "", 2
+	if err := validateDeploy(deploy); err != nil {
+		t.Errorf("with keep_releases: %v", err)
+	}
+}
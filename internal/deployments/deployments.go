@@ -0,0 +1,225 @@
+package deployments
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/khaledibrahim1015/goFlow-cicd/internal/store"
+	"github.com/sirupsen/logrus"
+)
+
+// Deployment is the record of what a run deployed, and where
+type Deployment struct {
+	ID           string     `json:"id"` // the run that deployed
+	Repository   string     `json:"repository,omitempty"`
+	Environment  string     `json:"environment,omitempty"`
+	Ref          string     `json:"ref,omitempty"`
+	Commit       string     `json:"commit,omitempty"`
+	Method       string     `json:"method"`
+	Path         string     `json:"path,omitempty"`  // remote base directory, local directory or upload URL
+	Hosts        []Host     `json:"hosts,omitempty"` // ssh deploys, in deploy order
+	Status       string     `json:"status"`          // "deployed", "failed", "rolled_back"
+	Error        string     `json:"error,omitempty"`
+	DeployedAt   time.Time  `json:"deployed_at"`
+	DeployedBy   string     `json:"deployed_by,omitempty"` // user of manual runs, else the trigger, e.g. "webhook"
+	ApprovedBy   string     `json:"approved_by,omitempty"`
+	RolledBackBy string     `json:"rolled_back_by,omitempty"`
+	RolledBackAt *time.Time `json:"rolled_back_at,omitempty"`
+	// "sha256:<hex>" over the paths and contents of the build output
+	ArtifactChecksum string `json:"artifact_checksum,omitempty"`
+	// Commit that was live in the environment before, and the commits since,
+	// newest first; empty when the history could not be fetched
+	PreviousCommit string   `json:"previous_commit,omitempty"`
+	Commits        []Commit `json:"commits,omitempty"`
+}
+
+// Commit is one commit of a deployment's range
+type Commit struct {
+	SHA     string    `json:"sha"`
+	Author  string    `json:"author"`
+	Date    time.Time `json:"date"`
+	Subject string    `json:"subject"`
+}
+
+// Host is what a deployment did on one host
+type Host struct {
+	Host     string `json:"host"`
+	Status   string `json:"status"`             // "pending", "deploying", "deployed", "failed", "rolled_back", "skipped"
+	Release  string `json:"release,omitempty"`  // e.g. "20261018120000-abcdef012345", releases layout only
+	Previous string `json:"previous,omitempty"` // release that was current before
+	Error    string `json:"error,omitempty"`
+}
+
+const deploymentsState = "deployments"
+
+var (
+	deployments = make(map[string]Deployment)
+	mu          sync.Mutex
+	st          *store.Store // set by Restore, every change is saved right away
+)
+
+// Restore loads the saved deployments and keeps saving changes to st
+func Restore(s *store.Store) error {
+	saved := make(map[string]Deployment)
+	if err := s.Load(deploymentsState, &saved); err != nil {
+		return err
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	for id, d := range saved {
+		deployments[id] = d
+	}
+	st = s
+	return nil
+}
+
+// Record adds or replaces the deployment of a run
+func Record(d Deployment) {
+	mu.Lock()
+	defer mu.Unlock()
+	deployments[d.ID] = d
+	saveLocked()
+}
+
+// Get returns the deployment of a run
+func Get(id string) (Deployment, bool) {
+	mu.Lock()
+	defer mu.Unlock()
+	d, ok := deployments[id]
+	return d, ok
+}
+
+// Filter selects deployments, empty fields match everything
+type Filter struct {
+	Repository  string
+	Environment string
+	Host        string // deployments that updated the host
+	Status      string
+}
+
+func (f Filter) matches(d Deployment) bool {
+	if (f.Repository != "" && d.Repository != f.Repository) ||
+		(f.Environment != "" && d.Environment != f.Environment) ||
+		(f.Status != "" && d.Status != f.Status) {
+		return false
+	}
+	return f.Host == "" || slices.ContainsFunc(d.Hosts, func(h Host) bool { return h.Host == f.Host })
+}
+
+// List returns the deployments matching f, newest first
+func List(f Filter) []Deployment {
+	mu.Lock()
+	defer mu.Unlock()
+	var list []Deployment
+	for _, d := range deployments {
+		if f.matches(d) {
+			list = append(list, d)
+		}
+	}
+	slices.SortFunc(list, func(a, b Deployment) int { return b.DeployedAt.Compare(a.DeployedAt) })
+	return list
+}
+
+// Live is what one repository has deployed to an environment
+type Live struct {
+	Repository string      `json:"repository"`
+	Current    *Deployment `json:"current"`            // newest successful deployment, nil when none
+	Previous   *Deployment `json:"previous,omitempty"` // the one live before it
+	Hosts      []LiveHost  `json:"hosts,omitempty"`    // ssh deploys
+	Changes    *Changes    `json:"changes,omitempty"`  // from previous to current
+}
+
+// LiveHost is the deployment running on a host
+type LiveHost struct {
+	Host         string    `json:"host"`
+	Commit       string    `json:"commit"`
+	Release      string    `json:"release,omitempty"`
+	DeploymentID string    `json:"deployment_id"`
+	DeployedAt   time.Time `json:"deployed_at"`
+}
+
+// Changes is the commit range between two deployments
+type Changes struct {
+	From    string   `json:"from"`
+	To      string   `json:"to"`
+	Commits []Commit `json:"commits,omitempty"` // newest first, when known
+}
+
+// Current returns the newest successful deployment of the repository to the
+// environment, nil when there is none
+func Current(repository, environment string) *Deployment {
+	return LiveIn(repository, environment).Current
+}
+
+// LiveIn returns what the repository has deployed to the environment: the
+// current and previous deployments, and for every host the newest deployment
+// that is still in place there
+func LiveIn(repository, environment string) Live {
+	live := Live{Repository: repository}
+	seen := make(map[string]bool)
+	for _, d := range List(Filter{Repository: repository, Environment: environment}) {
+		for _, h := range d.Hosts {
+			if h.Status != "deployed" || seen[h.Host] {
+				continue
+			}
+			seen[h.Host] = true
+			live.Hosts = append(live.Hosts, LiveHost{
+				Host: h.Host, Commit: d.Commit, Release: h.Release, DeploymentID: d.ID, DeployedAt: d.DeployedAt,
+			})
+		}
+		if d.Status != "deployed" {
+			continue
+		}
+		switch {
+		case live.Current == nil:
+			live.Current = &d
+		case live.Previous == nil:
+			live.Previous = &d
+		}
+	}
+	slices.SortFunc(live.Hosts, func(a, b LiveHost) int { return strings.Compare(a.Host, b.Host) })
+
+	if live.Current != nil && live.Previous != nil {
+		live.Changes = &Changes{From: live.Previous.Commit, To: live.Current.Commit}
+		// The range recorded at deploy time is only right when nothing was rolled back since
+		if live.Current.PreviousCommit == live.Previous.Commit {
+			live.Changes.Commits = live.Current.Commits
+		}
+	}
+	return live
+}
+
+// MarkRolledBack records that the deployment was rolled back by user
+func MarkRolledBack(id, user string) error {
+	mu.Lock()
+	defer mu.Unlock()
+	d, ok := deployments[id]
+	if !ok {
+		return fmt.Errorf("deployment %s not found", id)
+	}
+	now := time.Now().UTC()
+	d.Status = "rolled_back"
+	d.Hosts = slices.Clone(d.Hosts)
+	for i := range d.Hosts {
+		if d.Hosts[i].Status == "deployed" {
+			d.Hosts[i].Status = "rolled_back"
+		}
+	}
+	d.RolledBackBy = user
+	d.RolledBackAt = &now
+	deployments[id] = d
+	saveLocked()
+	return nil
+}
+
+func saveLocked() {
+	if st == nil {
+		return
+	}
+	if err := st.Save(deploymentsState, deployments); err != nil {
+		logrus.Errorf("Failed to save deployments: %v", err)
+	}
+}
@@ -0,0 +1,48 @@
+package deployments
+
+import (
+	"testing"
+	"time"
+)
+
+func TestLiveIn(t *testing.T) {
+	deployments = make(map[string]Deployment)
+	repo := "https://github.com/acme/api"
+	at := time.Date(2026, 10, 1, 12, 0, 0, 0, time.UTC)
+	host := func(name, status string) Host { return Host{Host: name, Status: status} }
+
+	Record(Deployment{ID: "r1", Repository: repo, Environment: "prod", Commit: "c1", Status: "deployed",
+		DeployedAt: at, Hosts: []Host{host("web1", "deployed"), host("web2", "deployed")}})
+	Record(Deployment{ID: "r2", Repository: repo, Environment: "prod", Commit: "c2", Status: "deployed",
+		DeployedAt: at.Add(time.Hour), Hosts: []Host{host("web1", "deployed"), host("web2", "deployed")},
+		PreviousCommit: "c1", Commits: []Commit{{SHA: "c2"}}})
+	// Failed half-way: web1 got c3 and kept it, web2 was never updated
+	Record(Deployment{ID: "r3", Repository: repo, Environment: "prod", Commit: "c3", Status: "failed",
+		DeployedAt: at.Add(2 * time.Hour), Hosts: []Host{host("web1", "deployed"), host("web2", "skipped")}})
+	Record(Deployment{ID: "r4", Repository: repo, Environment: "staging", Commit: "c4", Status: "deployed",
+		DeployedAt: at.Add(3 * time.Hour)})
+
+	live := LiveIn(repo, "prod")
+	if live.Current == nil || live.Current.ID != "r2" || live.Previous == nil || live.Previous.ID != "r1" {
+		t.Fatalf("current = %+v, previous = %+v", live.Current, live.Previous)
+	}
+	if len(live.Hosts) != 2 || live.Hosts[0].Commit != "c3" || live.Hosts[1].Commit != "c2" {
+		t.Errorf("hosts = %+v", live.Hosts)
+	}
+	if live.Changes == nil || live.Changes.From != "c1" || live.Changes.To != "c2" || len(live.Changes.Commits) != 1 {
+		t.Errorf("changes = %+v", live.Changes)
+	}
+
+	// After rolling r2 back, r1 is current again
+	if err := MarkRolledBack("r2", "alice"); err != nil {
+		t.Fatal(err)
+	}
+	if current := Current(repo, "prod"); current == nil || current.ID != "r1" {
+		t.Errorf("current after rollback = %+v", current)
+	}
+
+	list := List(Filter{Environment: "prod", Host: "web2"})
+	if len(list) != 3 || list[0].ID != "r3" || list[2].ID != "r1" {
+		t.Errorf("list = %+v", list)
+	}
+}
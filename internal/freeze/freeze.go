@@ -0,0 +1,125 @@
+package freeze
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/khaledibrahim1015/goFlow-cicd/internal/config"
+	"github.com/khaledibrahim1015/goFlow-cicd/internal/store"
+	"github.com/sirupsen/logrus"
+)
+
+// ErrLocked is returned when taking the deploy lock of an environment that is already locked
+var ErrLocked = errors.New("environment is already locked")
+
+// Lock stops deploys to an environment until it is released, e.g. during an incident
+type Lock struct {
+	Environment string    `json:"environment"`
+	Reason      string    `json:"reason"`
+	LockedBy    string    `json:"locked_by"`
+	LockedAt    time.Time `json:"locked_at"`
+}
+
+// Block is why deploys to an environment can't happen right now
+type Block struct {
+	Reason string     `json:"reason"`          // e.g. `deploy lock by alice: incident 42` or `freeze "year-end"`
+	Until  *time.Time `json:"until,omitempty"` // end of the freeze window, nil for locks
+	Lock   *Lock      `json:"lock,omitempty"`
+}
+
+const locksState = "deploy-locks"
+
+var (
+	locks   = make(map[string]Lock)
+	changed = make(chan struct{}) // closed and replaced on every lock change
+	mu      sync.Mutex
+	st      *store.Store // set by Restore, every change is saved right away
+)
+
+// Restore loads the saved locks and keeps saving changes to st
+func Restore(s *store.Store) error {
+	saved := make(map[string]Lock)
+	if err := s.Load(locksState, &saved); err != nil {
+		return err
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	for env, l := range saved {
+		locks[env] = l
+	}
+	st = s
+	return nil
+}
+
+// Acquire locks deploys to the environment. When it is already locked the
+// existing lock is returned with ErrLocked.
+func Acquire(environment, user, reason string) (Lock, error) {
+	mu.Lock()
+	defer mu.Unlock()
+	if l, ok := locks[environment]; ok {
+		return l, ErrLocked
+	}
+	l := Lock{Environment: environment, Reason: reason, LockedBy: user, LockedAt: time.Now().UTC()}
+	locks[environment] = l
+	changedLocked()
+	return l, nil
+}
+
+// Release unlocks the environment, returning the lock that was held
+func Release(environment string) (Lock, bool) {
+	mu.Lock()
+	defer mu.Unlock()
+	l, ok := locks[environment]
+	if ok {
+		delete(locks, environment)
+		changedLocked()
+	}
+	return l, ok
+}
+
+// Get returns the lock of the environment
+func Get(environment string) (Lock, bool) {
+	mu.Lock()
+	defer mu.Unlock()
+	l, ok := locks[environment]
+	return l, ok
+}
+
+// Changed returns a channel closed on the next lock change
+func Changed() <-chan struct{} {
+	mu.Lock()
+	defer mu.Unlock()
+	return changed
+}
+
+// Check reports whether deploys to the environment are blocked at t, by its
+// lock first, then by its freeze windows
+func Check(env *config.EnvironmentConfig, t time.Time) (Block, bool) {
+	if l, ok := Get(env.Name); ok {
+		return Block{Reason: fmt.Sprintf("deploy lock by %s: %s", l.LockedBy, l.Reason), Lock: &l}, true
+	}
+	for i := range env.Freezes {
+		window := &env.Freezes[i]
+		if until, active := window.ActiveAt(t); active {
+			reason := "freeze"
+			if window.Name != "" {
+				reason = fmt.Sprintf("freeze %q", window.Name)
+			}
+			return Block{Reason: fmt.Sprintf("%s until %s", reason, until.Format(time.RFC3339)), Until: &until}, true
+		}
+	}
+	return Block{}, false
+}
+
+func changedLocked() {
+	close(changed)
+	changed = make(chan struct{})
+	if st == nil {
+		return
+	}
+	if err := st.Save(locksState, locks); err != nil {
+		logrus.Errorf("Failed to save deploy locks: %v", err)
+	}
+}
@@ -0,0 +1,62 @@
+package freeze
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/khaledibrahim1015/goFlow-cicd/internal/config"
+)
+
+func TestCheck(t *testing.T) {
+	env := &config.EnvironmentConfig{Name: "prod", Freezes: []config.FreezeWindow{
+		{Name: "year-end", Start: "2026-12-22", End: "2027-01-04", Timezone: "Europe/Berlin"},
+		{Name: "weekend", Cron: "0 16 * * fri", Duration: "64h"}, // Friday 16:00 to Monday 08:00 UTC
+	}}
+	cases := []struct {
+		at     string
+		reason string // empty when deploys are allowed
+	}{
+		{"2026-12-21T22:59:00Z", ""},
+		{"2026-12-21T23:00:00Z", `freeze "year-end" until 2027-01-04T00:00:00+01:00`},
+		{"2026-10-23T15:59:00Z", ""}, // Friday
+		{"2026-10-23T16:00:00Z", `freeze "weekend" until 2026-10-26T08:00:00Z`},
+		{"2026-10-26T07:59:00Z", `freeze "weekend" until 2026-10-26T08:00:00Z`},
+		{"2026-10-26T08:00:00Z", ""},
+	}
+	for _, c := range cases {
+		at, _ := time.Parse(time.RFC3339, c.at)
+		block, blocked := Check(env, at)
+		if blocked != (c.reason != "") || block.Reason != c.reason {
+			t.Errorf("%s: blocked = %v, %q; want %q", c.at, blocked, block.Reason, c.reason)
+		}
+	}
+}
+
+func TestLock(t *testing.T) {
+	env := &config.EnvironmentConfig{Name: "staging"}
+	changed := Changed()
+	if _, err := Acquire("staging", "alice", "incident 42"); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case <-changed:
+	default:
+		t.Error("Acquire did not signal the change")
+	}
+	if lock, err := Acquire("staging", "bob", "deploying by hand"); !errors.Is(err, ErrLocked) || lock.LockedBy != "alice" {
+		t.Errorf("second Acquire = %+v, %v", lock, err)
+	}
+	block, blocked := Check(env, time.Now())
+	if !blocked || block.Lock == nil || !strings.Contains(block.Reason, "incident 42") {
+		t.Errorf("Check = %+v, %v", block, blocked)
+	}
+
+	if _, released := Release("staging"); !released {
+		t.Fatal("Release found no lock")
+	}
+	if _, blocked := Check(env, time.Now()); blocked {
+		t.Error("still blocked after Release")
+	}
+}
@@ -0,0 +1,171 @@
+package git
+
+import (
+	"context"
+	"slices"
+	"time"
+
+	"github.com/khaledibrahim1015/goFlow-cicd/internal/config"
+	"github.com/khaledibrahim1015/goFlow-cicd/internal/status"
+	"github.com/khaledibrahim1015/goFlow-cicd/internal/store"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	queuedRunsState = "queued-runs"
+	// interruptGrace is how long interrupted runs get to stop their commands and record it
+	interruptGrace = 15 * time.Second
+)
+
+// QueuedRun is a run kept across a restart of goFlow
+type QueuedRun struct {
+	RunID        string            `json:"run_id"`
+	Repository   string            `json:"repository"`
+	Ref          string            `json:"ref"`
+	SHA          string            `json:"sha,omitempty"`
+	Trigger      string            `json:"trigger"`
+	Env          map[string]string `json:"env,omitempty"`
+	TriggeredBy  string            `json:"triggered_by,omitempty"`
+	RerunOf      string            `json:"rerun_of,omitempty"`
+	Environment  string            `json:"environment,omitempty"`
+	PromotedFrom string            `json:"promoted_from,omitempty"`
+}
+
+var (
+	draining bool        // guarded by activeRunsMu
+	queued   []QueuedRun // guarded by activeRunsMu
+)
+
+func queuedRunOf(run status.PipelineStatus) QueuedRun {
+	return QueuedRun{
+		RunID:        run.ID,
+		Repository:   run.Repository,
+		Ref:          run.Ref,
+		SHA:          run.Commit,
+		Trigger:      run.Trigger,
+		Env:          run.Env,
+		TriggeredBy:  run.TriggeredBy,
+		RerunOf:      run.RerunOf,
+		Environment:  run.Environment,
+		PromotedFrom: run.PromotedFrom,
+	}
+}
+
+// Drain stops new runs from starting and waits for the running ones until ctx
+// is done. Runs still going then are interrupted and, together with the runs
+// requested meanwhile, saved so ResumeQueued starts them again after restart.
+func Drain(ctx context.Context, st *store.Store) error {
+	activeRunsMu.Lock()
+	draining = true
+	// Runs waiting for an approval would not finish on their own
+	for id, run := range activeRuns {
+		if run.isWaiting() {
+			interruptLocked(id, run)
+		}
+	}
+	activeRunsMu.Unlock()
+
+	if waitForRuns(ctx) {
+		logrus.Info("All pipelines finished")
+	} else {
+		activeRunsMu.Lock()
+		for id, run := range activeRuns {
+			if !run.isInterrupted() {
+				interruptLocked(id, run)
+			}
+		}
+		activeRunsMu.Unlock()
+
+		graceCtx, cancel := context.WithTimeout(context.Background(), interruptGrace)
+		defer cancel()
+		if !waitForRuns(graceCtx) {
+			logrus.Warn("Some pipelines did not stop in time")
+		}
+	}
+
+	activeRunsMu.Lock()
+	toSave := append([]QueuedRun{}, queued...)
+	activeRunsMu.Unlock()
+	if len(toSave) > 0 {
+		logrus.Infof("Saving %d queued runs for the next start", len(toSave))
+	}
+	if err := st.Save(queuedRunsState, toSave); err != nil {
+		return err
+	}
+	return status.Persist(st)
+}
+
+// interruptLocked cancels a run and queues it for the next start. activeRunsMu must be held.
+func interruptLocked(id string, run *activeRun) {
+	logrus.Warnf("Interrupting pipeline %s", id)
+	run.mu.Lock()
+	run.interrupted = true
+	run.mu.Unlock()
+	queued = append(queued, queuedRunOf(run.run))
+	run.cancel()
+}
+
+// unqueue drops a run interrupted too late to stop it, it finished anyway
+func unqueue(runID string) {
+	activeRunsMu.Lock()
+	defer activeRunsMu.Unlock()
+	queued = slices.DeleteFunc(queued, func(q QueuedRun) bool { return q.RunID == runID })
+}
+
+// waitForRuns reports whether all runs finished before ctx was done
+func waitForRuns(ctx context.Context) bool {
+	ticker := time.NewTicker(200 * time.Millisecond)
+	defer ticker.Stop()
+	for {
+		activeRunsMu.Lock()
+		remaining := len(activeRuns)
+		activeRunsMu.Unlock()
+		if remaining == 0 {
+			return true
+		}
+		select {
+		case <-ctx.Done():
+			return false
+		case <-ticker.C:
+		}
+	}
+}
+
+// ResumeQueued starts the runs saved by Drain during the previous shutdown
+func ResumeQueued(cfg *config.PipelineConfig, st *store.Store) error {
+	var runs []QueuedRun
+	if err := st.Load(queuedRunsState, &runs); err != nil {
+		return err
+	}
+	if err := st.Save(queuedRunsState, []QueuedRun{}); err != nil {
+		return err
+	}
+
+	for _, q := range runs {
+		repo := cfg.Repository(q.Repository)
+		if repo == nil {
+			logrus.Warnf("Dropping queued run %s: repository %s is no longer configured", q.RunID, q.Repository)
+			status.Add(q.RunID, "failed", "repository no longer configured")
+			continue
+		}
+		logrus.Infof("Resuming queued run %s for %s", q.RunID, q.Repository)
+		go func(q QueuedRun) {
+			_, err := StartPipeline(cfg, RunRequest{
+				Repo:         repo,
+				Ref:          q.Ref,
+				SHA:          q.SHA,
+				Trigger:      q.Trigger,
+				Env:          q.Env,
+				TriggeredBy:  q.TriggeredBy,
+				RerunOf:      q.RerunOf,
+				Environment:  q.Environment,
+				PromotedFrom: q.PromotedFrom,
+				RunID:        q.RunID,
+			})
+			if err != nil {
+				logrus.Errorf("Resumed run %s could not start: %v", q.RunID, err)
+			}
+		}(q)
+	}
+	return nil
+}
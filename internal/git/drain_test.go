@@ -0,0 +1,70 @@
+package git
+
+import (
+	"context"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/khaledibrahim1015/goFlow-cicd/internal/config"
+	"github.com/khaledibrahim1015/goFlow-cicd/internal/status"
+	"github.com/khaledibrahim1015/goFlow-cicd/internal/store"
+)
+
+func TestDrainPersistsAndResumesRuns(t *testing.T) {
+	t.Setenv("GIT_TERMINAL_PROMPT", "0")
+	st, err := store.New(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	repo := config.RepositoryConfig{URL: "http://127.0.0.1:1/app.git", Branch: "main"}
+	env := map[string]string{"FEATURE_FLAG": "on"}
+	run := status.PipelineStatus{ID: "drain1", Repository: repo.URL, Ref: "refs/heads/main", Trigger: TriggerManual,
+		TriggeredBy: "alice", Env: env, Status: "running"}
+	ctx, cancel := context.WithCancel(context.Background())
+	if _, started := registerRun(run, cancel); !started {
+		t.Fatal("run not started")
+	}
+	go func() {
+		<-ctx.Done()
+		unregisterRun(run.ID)
+	}()
+
+	// Shutdown does not wait: the run is interrupted and queued
+	done, stop := context.WithCancel(context.Background())
+	stop()
+	if err := Drain(done, st); err != nil {
+		t.Fatalf("Drain: %v", err)
+	}
+	activeRunsMu.Lock()
+	draining, queued = false, nil
+	activeRunsMu.Unlock()
+
+	// Restart: the status comes back with its overrides, so does the run
+	status.Register(status.PipelineStatus{ID: run.ID})
+	if err := status.Restore(st); err != nil {
+		t.Fatal(err)
+	}
+	if s, _ := status.Get(run.ID); !reflect.DeepEqual(s.Env, env) || s.TriggeredBy != "alice" {
+		t.Errorf("restored status = %+v", s)
+	}
+	cfg := &config.PipelineConfig{Repositories: []config.RepositoryConfig{repo}}
+	if err := ResumeQueued(cfg, st); err != nil {
+		t.Fatal(err)
+	}
+	// The repository is unreachable, so the resumed run fails at its clone
+	deadline := time.Now().Add(10 * time.Second)
+	for {
+		s, _ := status.Get(run.ID)
+		if s.Status == "failed" {
+			if !reflect.DeepEqual(s.Env, env) {
+				t.Errorf("resumed run env = %v", s.Env)
+			}
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("resumed run is %q", s.Status)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
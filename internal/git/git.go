@@ -1,10 +1,12 @@
 package git
 
 import (
+	"errors"
 	"fmt"
 	"os"
 	"os/exec"
 	"path/filepath"
+	"regexp"
 	"strings"
 
 	"github.com/khaledibrahim1015/goFlow-cicd/internal/server"
@@ -19,13 +21,24 @@ const (
 	X_Gitlab_Event = "X-Gitlab-Event"
 )
 
+// ErrRefNotFound is returned by Clone when the branch or tag does not exist on the remote
+var ErrRefNotFound = errors.New("ref not found")
+
+var commitSHA = regexp.MustCompile(`^[0-9a-fA-F]{7,40}$`)
+
+// IsCommitSHA reports whether s is a full or abbreviated commit sha. Anything
+// else must not reach git as an argument, where it could be read as an option.
+func IsCommitSHA(s string) bool {
+	return commitSHA.MatchString(s)
+}
+
 // that mean the request from githubprovider here we do not need value of X_Github_Event value (push)
 // just identify provider
 func DetermineGitProvider(req *server.HttpRequest) string {
-	if _, ok := req.Headers["X-GitHub-Event"]; ok {
+	if _, err := req.GetHeader(X_Github_Event); err == nil {
 		return Github
 	}
-	if _, ok := req.Headers[X_Gitlab_Event]; ok {
+	if _, err := req.GetHeader(X_Gitlab_Event); err == nil {
 		return Gitlab
 	}
 	return "unknown"
@@ -47,10 +60,10 @@ func Clone(url, branch string) (string, error) {
 	}
 	// Generate unique directory name
 
+	// Unique per run, so webhook and polling runs of the same repository can overlap
 	repoName := sanitizedRepoName(url)
-	dir := filepath.Join(os.TempDir(), fmt.Sprintf("goflow-%s", repoName))
-
-	if err := os.Mkdir(dir, 0755); err != nil {
+	dir, err := os.MkdirTemp("", fmt.Sprintf("goflow-%s-", repoName))
+	if err != nil {
 		return "", fmt.Errorf("failed to create temp directory: %v", err)
 	}
 
@@ -64,6 +77,9 @@ func Clone(url, branch string) (string, error) {
 		if removeErr := os.RemoveAll(dir); removeErr != nil {
 			logrus.Warnf("Failed to clean up %s: %v", dir, removeErr)
 		}
+		if strings.Contains(output, "not found in upstream") {
+			return "", fmt.Errorf("%w: %s on %s", ErrRefNotFound, branch, url)
+		}
 		return "", fmt.Errorf("clone failed: %v\nOutput: %s", err, output)
 	}
 
@@ -100,3 +116,65 @@ func sanitizedRepoName(url string) string {
 		parts[len(parts)-1]), "@", "-")
 	return strings.ReplaceAll(safeName, ":", "-")
 }
+
+// Checkout moves a shallow clone to the given commit, fetching it when it is not the cloned head
+func Checkout(dir, sha string) error {
+	if !IsCommitSHA(sha) {
+		return fmt.Errorf("invalid commit sha %q", sha)
+	}
+	cmd := exec.Command("git", "rev-parse", "HEAD")
+	cmd.Dir = dir
+	if head, err := executor.RunWithOutput(cmd); err == nil && strings.TrimSpace(head) == sha {
+		return nil
+	}
+
+	cmd = exec.Command("git", "fetch", "--depth", "1", "origin", sha)
+	cmd.Dir = dir
+	if output, err := executor.RunWithOutput(cmd); err != nil {
+		// Not every server allows fetching a commit by sha, fall back to the full history
+		logrus.Debugf("Fetching %s directly failed, unshallowing: %s", sha, output)
+		cmd = exec.Command("git", "fetch", "--unshallow", "origin")
+		cmd.Dir = dir
+		if output, err := executor.RunWithOutput(cmd); err != nil {
+			return fmt.Errorf("fetch of %s failed: %v\nOutput: %s", sha, err, output)
+		}
+	}
+
+	cmd = exec.Command("git", "checkout", "--detach", sha)
+	cmd.Dir = dir
+	if output, err := executor.RunWithOutput(cmd); err != nil {
+		return fmt.Errorf("checkout of %s failed: %v\nOutput: %s", sha, err, output)
+	}
+	logrus.Debugf("Checked out %s in %s", sha, dir)
+	return nil
+}
+
+// BranchFromRef returns the branch or tag name of a ref such as "refs/heads/main"
+func BranchFromRef(ref string) string {
+	for _, prefix := range []string{"refs/heads/", "refs/tags/"} {
+		if strings.HasPrefix(ref, prefix) {
+			return strings.TrimPrefix(ref, prefix)
+		}
+	}
+	return ref
+}
+
+// LsRemote returns the commit sha the given branch points to on the remote repository
+func LsRemote(url, branch string) (string, error) {
+	if err := validateRepoURL(url); err != nil {
+		return "", err
+	}
+	ref := "refs/heads/" + branch
+	cmd := exec.Command("git", "ls-remote", url, ref)
+	output, err := executor.RunWithOutput(cmd)
+	if err != nil {
+		return "", fmt.Errorf("ls-remote failed: %v\nOutput: %s", err, output)
+	}
+	for _, line := range strings.Split(output, "\n") {
+		fields := strings.Fields(line)
+		if len(fields) == 2 && fields[1] == ref {
+			return fields[0], nil
+		}
+	}
+	return "", fmt.Errorf("branch %s not found on %s", branch, url)
+}
@@ -0,0 +1,14 @@
+package git
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestCheckoutRejectsNonSHA(t *testing.T) {
+	for _, sha := range []string{"--upload-pack=touch pwned", "main", "abc", strings.Repeat("a", 41)} {
+		if err := Checkout(t.TempDir(), sha); err == nil || !strings.Contains(err.Error(), "invalid commit sha") {
+			t.Errorf("Checkout(%q) = %v", sha, err)
+		}
+	}
+}
@@ -9,14 +9,11 @@ import (
 	"net/http"
 
 	"github.com/khaledibrahim1015/goFlow-cicd/internal/config"
-	"github.com/khaledibrahim1015/goFlow-cicd/internal/pipeline"
 	"github.com/khaledibrahim1015/goFlow-cicd/internal/server"
-	"github.com/khaledibrahim1015/goFlow-cicd/internal/status"
-	"github.com/sirupsen/logrus"
 )
 
 func Githubhandler(ctx *server.HttpContext, cfg *config.PipelineConfig) {
-	if ctx.Request.Headers["X-GitHub-Event"] != "push" {
+	if event, _ := ctx.Request.GetHeader(X_Github_Event); event != "push" {
 		ctx.JSON(server.StatusBadRequest, server.Generalesponse{
 			"error":   fmt.Sprintf("Only push events supported"),
 			"message": server.StatusCodeText[server.StatusBadRequest],
@@ -49,6 +46,7 @@ func Githubhandler(ctx *server.HttpContext, cfg *config.PipelineConfig) {
 
 	var event struct {
 		Ref        string `json:"ref"`
+		After      string `json:"after"` // commit sha after the push
 		Repository struct {
 			URL string `json:"html_url"`
 		} `json:"repository"`
@@ -71,8 +69,12 @@ func Githubhandler(ctx *server.HttpContext, cfg *config.PipelineConfig) {
 		return
 	}
 
-	pipelineID := fmt.Sprintf("%s-%s", repo.URL, event.Ref)
-	repoPath, err := Clone(repo.URL, repo.Branch)
+	runID, err := StartPipeline(cfg, RunRequest{
+		Repo:    repo,
+		Ref:     event.Ref,
+		SHA:     event.After,
+		Trigger: TriggerWebhook,
+	})
 	if err != nil {
 		ctx.JSON(server.StatusInternalServerError, server.Generalesponse{
 			"error":   fmt.Sprintf("Clone failed: %v", err),
@@ -81,20 +83,9 @@ func Githubhandler(ctx *server.HttpContext, cfg *config.PipelineConfig) {
 		return
 
 	}
-
-	// TRigger Pipeline
-	status.Add(pipelineID, "running", "")
-	go func() {
-		p := pipeline.New(cfg, repoPath)
-		if err := p.Run(); err != nil {
-			logrus.Errorf("Pipeline %s failed: %v", pipelineID, err)
-			status.Add(pipelineID, "failed", err.Error())
-		} else {
-			status.Add(pipelineID, "success", "")
-		}
-	}()
 	ctx.JSON(server.StatusOK, server.Generalesponse{
-		"message": fmt.Sprintf("Pipeline %s started", pipelineID),
+		"id":      runID,
+		"message": fmt.Sprintf("Pipeline %s started", runID),
 	})
 
 }
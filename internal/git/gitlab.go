@@ -6,14 +6,11 @@ import (
 	"net/http"
 
 	"github.com/khaledibrahim1015/goFlow-cicd/internal/config"
-	"github.com/khaledibrahim1015/goFlow-cicd/internal/pipeline"
 	"github.com/khaledibrahim1015/goFlow-cicd/internal/server"
-	"github.com/khaledibrahim1015/goFlow-cicd/internal/status"
-	"github.com/sirupsen/logrus"
 )
 
 func GitLabhandler(ctx *server.HttpContext, cfg *config.PipelineConfig) {
-	if ctx.Request.Headers["X-Gitlab-Event"] != "Push Hook" {
+	if event, _ := ctx.Request.GetHeader(X_Gitlab_Event); event != "Push Hook" {
 		ctx.JSON(server.StatusBadRequest, server.Generalesponse{
 			"error":   fmt.Sprintf("Only push events supported"),
 			"message": server.StatusCodeText[server.StatusBadRequest],
@@ -46,8 +43,9 @@ func GitLabhandler(ctx *server.HttpContext, cfg *config.PipelineConfig) {
 		return
 	}
 	var event struct {
-		Ref     string `json:"ref"`
-		Project struct {
+		Ref         string `json:"ref"`
+		CheckoutSHA string `json:"checkout_sha"` // commit sha after the push
+		Project     struct {
 			URL string `json:"web_url"`
 		} `json:"project"`
 	}
@@ -69,8 +67,12 @@ func GitLabhandler(ctx *server.HttpContext, cfg *config.PipelineConfig) {
 		return
 	}
 
-	pipelineID := fmt.Sprintf("%s-%s", repo.URL, event.Ref)
-	repoPath, err := Clone(repo.URL, repo.Branch)
+	runID, err := StartPipeline(cfg, RunRequest{
+		Repo:    repo,
+		Ref:     event.Ref,
+		SHA:     event.CheckoutSHA,
+		Trigger: TriggerWebhook,
+	})
 	if err != nil {
 		ctx.JSON(server.StatusInternalServerError, server.Generalesponse{
 			"error":   fmt.Sprintf("Clone failed: %v", err),
@@ -79,20 +81,9 @@ func GitLabhandler(ctx *server.HttpContext, cfg *config.PipelineConfig) {
 		return
 
 	}
-
-	// TRigger Pipeline
-	status.Add(pipelineID, "running", "")
-	go func() {
-		p := pipeline.New(cfg, repoPath)
-		if err := p.Run(); err != nil {
-			logrus.Errorf("Pipeline %s failed: %v", pipelineID, err)
-			status.Add(pipelineID, "failed", err.Error())
-		} else {
-			status.Add(pipelineID, "success", "")
-		}
-	}()
 	ctx.JSON(server.StatusOK, server.Generalesponse{
-		"message": fmt.Sprintf("Pipeline %s started", pipelineID),
+		"id":      runID,
+		"message": fmt.Sprintf("Pipeline %s started", runID),
 	})
 
 }
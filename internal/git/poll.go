@@ -0,0 +1,117 @@
+package git
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/khaledibrahim1015/goFlow-cicd/internal/config"
+	"github.com/khaledibrahim1015/goFlow-cicd/internal/store"
+	"github.com/sirupsen/logrus"
+)
+
+const lastSeenState = "poll-last-seen"
+
+// Poller watches repositories with a poll_interval for new commits and
+// starts pipelines for them the same way webhooks do
+type Poller struct {
+	cfg      *config.PipelineConfig
+	store    *store.Store
+	mu       sync.Mutex
+	lastSeen map[string]string // repo url@branch -> sha
+	// StartPipeline, faked by tests
+	start func(*config.PipelineConfig, RunRequest) (string, error)
+}
+
+func NewPoller(cfg *config.PipelineConfig, st *store.Store) (*Poller, error) {
+	p := &Poller{
+		cfg:      cfg,
+		store:    st,
+		lastSeen: make(map[string]string),
+		start:    StartPipeline,
+	}
+	if err := st.Load(lastSeenState, &p.lastSeen); err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+// Start launches one polling loop per repository that has a poll_interval,
+// they stop when ctx is done
+func (p *Poller) Start(ctx context.Context) {
+	for i := range p.cfg.Repositories {
+		repo := &p.cfg.Repositories[i]
+		if repo.PollInterval == "" {
+			continue
+		}
+		interval, err := time.ParseDuration(repo.PollInterval)
+		if err != nil || interval <= 0 {
+			logrus.Warnf("Invalid poll_interval %q for %s, polling disabled", repo.PollInterval, repo.URL)
+			continue
+		}
+		logrus.Infof("Polling %s (branch: %s) every %s", repo.URL, repo.Branch, interval)
+		go p.loop(ctx, repo, interval)
+	}
+}
+
+func (p *Poller) loop(ctx context.Context, repo *config.RepositoryConfig, interval time.Duration) {
+	p.poll(repo)
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			p.poll(repo)
+		}
+	}
+}
+
+// poll checks the watched branch once and starts a run when it moved
+func (p *Poller) poll(repo *config.RepositoryConfig) {
+	sha, err := LsRemote(repo.URL, repo.Branch)
+	if err != nil {
+		logrus.Warnf("Polling %s failed: %v", repo.URL, err)
+		return
+	}
+
+	key := repo.URL + "@" + repo.Branch
+	p.mu.Lock()
+	previous := p.lastSeen[key]
+	p.mu.Unlock()
+	if sha == previous {
+		return
+	}
+
+	// First time we see this branch: only record where it is
+	if previous == "" {
+		logrus.Infof("Polling %s: branch %s is at %s", repo.URL, repo.Branch, sha)
+		p.remember(key, sha)
+		return
+	}
+
+	logrus.Infof("Polling %s: branch %s moved %s -> %s", repo.URL, repo.Branch, previous, sha)
+	runID, err := p.start(p.cfg, RunRequest{
+		Repo:    repo,
+		Ref:     "refs/heads/" + repo.Branch,
+		SHA:     sha,
+		Trigger: TriggerPoll,
+	})
+	if err != nil {
+		// Not remembered, the next poll tries this commit again
+		logrus.Errorf("Pipeline %s for %s could not start: %v", runID, key, err)
+		return
+	}
+	p.remember(key, sha)
+}
+
+// remember records sha as the last seen commit of key
+func (p *Poller) remember(key, sha string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.lastSeen[key] = sha
+	if err := p.store.Save(lastSeenState, p.lastSeen); err != nil {
+		logrus.Errorf("Failed to persist last seen commit for %s: %v", key, err)
+	}
+}
@@ -0,0 +1,121 @@
+package git
+
+import (
+	"context"
+	"errors"
+	"net/http/cgi"
+	"net/http/httptest"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/khaledibrahim1015/goFlow-cicd/internal/config"
+	"github.com/khaledibrahim1015/goFlow-cicd/internal/store"
+)
+
+func git(t *testing.T, dir string, args ...string) string {
+	t.Helper()
+	cmd := exec.Command("git", args...)
+	cmd.Dir = dir
+	cmd.Env = append(cmd.Environ(), "GIT_AUTHOR_NAME=dev", "GIT_AUTHOR_EMAIL=dev@example.com",
+		"GIT_COMMITTER_NAME=dev", "GIT_COMMITTER_EMAIL=dev@example.com")
+	output, err := cmd.CombinedOutput()
+	if err != nil {
+		t.Fatalf("git %v: %v\n%s", args, err, output)
+	}
+	return strings.TrimSpace(string(output))
+}
+
+// servedRepo creates a work tree pushing to a bare repository served over
+// smart HTTP, and returns both
+func servedRepo(t *testing.T) (work, url string) {
+	t.Helper()
+	root := t.TempDir()
+	work = filepath.Join(root, "work")
+	git(t, root, "init", "-q", "-b", "main", work)
+	git(t, work, "commit", "-q", "--allow-empty", "-m", "initial")
+	git(t, root, "clone", "-q", "--bare", work, filepath.Join(root, "app.git"))
+	git(t, work, "remote", "add", "origin", filepath.Join(root, "app.git"))
+
+	srv := httptest.NewServer(&cgi.Handler{
+		Path: filepath.Join(git(t, root, "--exec-path"), "git-http-backend"),
+		Env:  []string{"GIT_PROJECT_ROOT=" + root, "GIT_HTTP_EXPORT_ALL=1"},
+	})
+	t.Cleanup(srv.Close)
+	return work, srv.URL + "/app.git"
+}
+
+func TestPollTriggersOncePerNewCommit(t *testing.T) {
+	work, url := servedRepo(t)
+	st, err := store.New(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg := &config.PipelineConfig{Repositories: []config.RepositoryConfig{{URL: url, Branch: "main", PollInterval: "1m"}}}
+	p, err := NewPoller(cfg, st)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var started []RunRequest
+	var startErr error
+	p.start = func(_ *config.PipelineConfig, req RunRequest) (string, error) {
+		started = append(started, req)
+		return "run1", startErr
+	}
+	repo := &cfg.Repositories[0]
+
+	// The first poll only records where the branch is, an unchanged ref does not trigger
+	p.poll(repo)
+	p.poll(repo)
+	if len(started) != 0 {
+		t.Fatalf("started %d runs without a new commit", len(started))
+	}
+
+	git(t, work, "commit", "-q", "--allow-empty", "-m", "fix login")
+	git(t, work, "push", "-q", "origin", "main")
+	sha := git(t, work, "rev-parse", "HEAD")
+	// A run that could not start is tried again at the next poll
+	startErr = errors.New("queue full")
+	p.poll(repo)
+	startErr = nil
+	p.poll(repo)
+	p.poll(repo)
+	if len(started) != 2 || started[1].SHA != sha || started[1].Trigger != TriggerPoll {
+		t.Fatalf("started = %+v", started)
+	}
+
+	// The last seen commit survives a restart
+	p, _ = NewPoller(cfg, st)
+	p.start = func(*config.PipelineConfig, RunRequest) (string, error) {
+		t.Error("restarted poller triggered for a commit it already saw")
+		return "", nil
+	}
+	p.poll(repo)
+}
+
+func TestPollLoopStopsWithContext(t *testing.T) {
+	t.Setenv("GIT_TERMINAL_PROMPT", "0")
+	st, err := store.New(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg := &config.PipelineConfig{Repositories: []config.RepositoryConfig{{URL: "http://127.0.0.1:1/app.git", Branch: "main"}}}
+	p, err := NewPoller(cfg, st)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		p.loop(ctx, &cfg.Repositories[0], time.Hour)
+		close(done)
+	}()
+	cancel()
+	select {
+	case <-done:
+	case <-time.After(10 * time.Second):
+		t.Fatal("polling loop did not stop")
+	}
+}
@@ -0,0 +1,223 @@
+package git
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/khaledibrahim1015/goFlow-cicd/internal/config"
+)
+
+// Commit states reported back to the git provider
+const (
+	StatePending   = "pending" // waiting, for an approval or the end of a freeze
+	StateRunning   = "running"
+	StateSuccess   = "success"
+	StateFailure   = "failure"
+	StateCancelled = "cancelled"
+
+	statusContext      = "goflow"
+	defaultGithubAPI   = "https://api.github.com"
+	defaultGitlabAPIv4 = "/api/v4"
+)
+
+// CommitStatus is the state of a pipeline run for a single commit
+type CommitStatus struct {
+	SHA         string
+	State       string // StatePending, StateRunning, StateSuccess, StateFailure, StateCancelled
+	TargetURL   string
+	Description string
+}
+
+// StatusReporter posts commit statuses to a git provider
+type StatusReporter interface {
+	Report(status CommitStatus) error
+}
+
+// NewStatusReporter returns the reporter matching the repository provider,
+// or nil when the repository has no API token configured
+func NewStatusReporter(repo *config.RepositoryConfig) (StatusReporter, error) {
+	if repo.Token == "" {
+		return nil, nil
+	}
+	project, err := projectPath(repo.URL)
+	if err != nil {
+		return nil, err
+	}
+	client := &http.Client{Timeout: 10 * time.Second}
+
+	switch providerOf(repo) {
+	case Github:
+		apiURL := repo.APIURL
+		if apiURL == "" {
+			apiURL = defaultGithubAPI
+		}
+		return &githubReporter{apiURL: strings.TrimRight(apiURL, "/"), project: project, token: repo.Token, client: client}, nil
+	case Gitlab:
+		apiURL := repo.APIURL
+		if apiURL == "" {
+			apiURL = "https://" + hostOf(repo.URL) + defaultGitlabAPIv4
+		}
+		return &gitlabReporter{apiURL: strings.TrimRight(apiURL, "/"), project: project, token: repo.Token, client: client}, nil
+	default:
+		return nil, fmt.Errorf("cannot determine git provider for %s (set provider in config)", repo.URL)
+	}
+}
+
+// githubReporter uses the GitHub commit statuses API
+type githubReporter struct {
+	apiURL  string
+	project string // owner/repo
+	token   string
+	client  *http.Client
+}
+
+func (r *githubReporter) Report(status CommitStatus) error {
+	state := status.State
+	switch state {
+	case StateRunning:
+		state = StatePending // GitHub has no running state
+	case StateCancelled:
+		state = "error" // GitHub has no cancelled state
+	}
+	body := map[string]string{
+		"state":       state,
+		"target_url":  status.TargetURL,
+		"description": status.Description,
+		"context":     statusContext,
+	}
+	endpoint := fmt.Sprintf("%s/repos/%s/statuses/%s", r.apiURL, r.project, status.SHA)
+	headers := map[string]string{
+		"Authorization": "Bearer " + r.token,
+		"Accept":        "application/vnd.github+json",
+	}
+	return postJSON(r.client, endpoint, headers, body)
+}
+
+// gitlabReporter uses the GitLab commit status API
+type gitlabReporter struct {
+	apiURL  string
+	project string // group/subgroup/repo
+	token   string
+	client  *http.Client
+	mu      sync.Mutex
+	sent    map[string]string // sha -> last state GitLab accepted
+}
+
+func (r *gitlabReporter) Report(status CommitStatus) error {
+	state := status.State
+	switch state {
+	case StateFailure:
+		state = "failed"
+	case StateCancelled:
+		state = "canceled"
+	}
+	// GitLab refuses to report a state twice or to go from running back to pending
+	r.mu.Lock()
+	last := r.sent[status.SHA]
+	r.mu.Unlock()
+	if state == last || (last == StateRunning && state == StatePending) {
+		return nil
+	}
+	body := map[string]string{
+		"state":       state,
+		"target_url":  status.TargetURL,
+		"description": status.Description,
+		"name":        statusContext,
+	}
+	endpoint := fmt.Sprintf("%s/projects/%s/statuses/%s", r.apiURL, url.PathEscape(r.project), status.SHA)
+	headers := map[string]string{
+		"PRIVATE-TOKEN": r.token,
+	}
+	if err := postJSON(r.client, endpoint, headers, body); err != nil {
+		return err
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.sent == nil {
+		r.sent = make(map[string]string)
+	}
+	r.sent[status.SHA] = state
+	return nil
+}
+
+func postJSON(client *http.Client, endpoint string, headers map[string]string, body interface{}) error {
+	data, err := json.Marshal(body)
+	if err != nil {
+		return fmt.Errorf("error marshaling JSON: %v", err)
+	}
+	req, err := http.NewRequest(http.MethodPost, endpoint, bytes.NewReader(data))
+	if err != nil {
+		return fmt.Errorf("failed to create request: %v", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for key, value := range headers {
+		req.Header.Set(key, value)
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to post commit status: %v", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return fmt.Errorf("commit status rejected with %d: %s", resp.StatusCode, strings.TrimSpace(string(msg)))
+	}
+	return nil
+}
+
+// providerOf returns the configured provider, or guesses it from the repository host
+func providerOf(repo *config.RepositoryConfig) string {
+	if repo.Provider != "" {
+		return repo.Provider
+	}
+	host := strings.ToLower(hostOf(repo.URL))
+	switch {
+	case strings.Contains(host, Github):
+		return Github
+	case strings.Contains(host, Gitlab):
+		return Gitlab
+	}
+	return "unknown"
+}
+
+// hostOf extracts the host from https://host/owner/repo.git or git@host:owner/repo.git
+func hostOf(repoURL string) string {
+	rest := repoURL
+	if i := strings.Index(rest, "://"); i >= 0 {
+		rest = rest[i+3:]
+	}
+	if i := strings.Index(rest, "@"); i >= 0 {
+		rest = rest[i+1:]
+	}
+	if i := strings.IndexAny(rest, ":/"); i >= 0 {
+		rest = rest[:i]
+	}
+	return rest
+}
+
+// projectPath extracts "owner/repo" (or "group/subgroup/repo") from a repository url
+func projectPath(repoURL string) (string, error) {
+	rest := repoURL
+	if i := strings.Index(rest, "://"); i >= 0 {
+		rest = rest[i+3:]
+		if i := strings.Index(rest, "/"); i >= 0 {
+			rest = rest[i+1:]
+		} else {
+			rest = ""
+		}
+	} else if i := strings.Index(rest, ":"); i >= 0 {
+		rest = rest[i+1:]
+	}
+	rest = strings.Trim(strings.TrimSuffix(rest, ".git"), "/")
+	if !strings.Contains(rest, "/") {
+		return "", fmt.Errorf("cannot determine project path from %s", repoURL)
+	}
+	return rest, nil
+}
@@ -0,0 +1,100 @@
+package git
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+
+	"github.com/khaledibrahim1015/goFlow-cicd/internal/config"
+)
+
+func TestStatusReporter(t *testing.T) {
+	tests := []struct {
+		name       string
+		repo       config.RepositoryConfig
+		wantPath   string
+		wantHeader string
+		wantState  string
+	}{
+		{
+			name:       "github",
+			repo:       config.RepositoryConfig{URL: "git@github.com:acme/api.git", Token: "gh-token"},
+			wantPath:   "/repos/acme/api/statuses/abc123",
+			wantHeader: "Authorization",
+			wantState:  "failure",
+		},
+		{
+			name:       "gitlab",
+			repo:       config.RepositoryConfig{URL: "https://gitlab.example.com/group/sub/api.git", Provider: Gitlab, Token: "gl-token"},
+			wantPath:   "/projects/group%2Fsub%2Fapi/statuses/abc123",
+			wantHeader: "PRIVATE-TOKEN",
+			wantState:  "failed",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var gotPath, gotHeader string
+			var gotBody map[string]string
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				gotPath = r.URL.EscapedPath()
+				gotHeader = r.Header.Get(tt.wantHeader)
+				json.NewDecoder(r.Body).Decode(&gotBody)
+				w.WriteHeader(http.StatusCreated)
+			}))
+			defer srv.Close()
+
+			tt.repo.APIURL = srv.URL
+			reporter, err := NewStatusReporter(&tt.repo)
+			if err != nil {
+				t.Fatalf("NewStatusReporter: %v", err)
+			}
+			err = reporter.Report(CommitStatus{SHA: "abc123", State: StateFailure, TargetURL: "http://goflow/status/1"})
+			if err != nil {
+				t.Fatalf("Report: %v", err)
+			}
+			if gotPath != tt.wantPath {
+				t.Errorf("path = %s, want %s", gotPath, tt.wantPath)
+			}
+			if gotHeader == "" {
+				t.Errorf("missing %s header", tt.wantHeader)
+			}
+			if gotBody["state"] != tt.wantState || gotBody["target_url"] != "http://goflow/status/1" {
+				t.Errorf("unexpected body: %v", gotBody)
+			}
+		})
+	}
+}
+
+func TestGitlabReporterStateSequence(t *testing.T) {
+	var states []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var body map[string]string
+		json.NewDecoder(r.Body).Decode(&body)
+		states = append(states, body["state"])
+		w.WriteHeader(http.StatusCreated)
+	}))
+	defer srv.Close()
+	reporter, err := NewStatusReporter(&config.RepositoryConfig{
+		URL: "https://gitlab.example.com/group/api.git", Provider: Gitlab, Token: "gl-token", APIURL: srv.URL,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// A protected deploy that waits for a freeze to end, as trigger reports it
+	for _, state := range []string{StateRunning, StatePending, StateRunning, StatePending, StateRunning, StateSuccess} {
+		if err := reporter.Report(CommitStatus{SHA: "abc123", State: state}); err != nil {
+			t.Fatalf("Report %s: %v", state, err)
+		}
+	}
+	// Repeated pending reports are sent once
+	for _, state := range []string{StatePending, StatePending, StateRunning, StateFailure} {
+		reporter.Report(CommitStatus{SHA: "def456", State: state})
+	}
+	if want := []string{"running", "success", "pending", "running", "failed"}; !reflect.DeepEqual(states, want) {
+		t.Errorf("states = %v, want %v", states, want)
+	}
+}
@@ -0,0 +1,410 @@
+package git
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/khaledibrahim1015/goFlow-cicd/internal/config"
+	"github.com/khaledibrahim1015/goFlow-cicd/internal/deployments"
+	"github.com/khaledibrahim1015/goFlow-cicd/internal/freeze"
+	"github.com/khaledibrahim1015/goFlow-cicd/internal/pipeline"
+	"github.com/khaledibrahim1015/goFlow-cicd/internal/status"
+	"github.com/sirupsen/logrus"
+)
+
+// Trigger sources
+const (
+	TriggerWebhook  = "webhook"
+	TriggerPoll     = "poll"
+	TriggerSchedule = "schedule"
+	TriggerManual   = "manual"
+	TriggerRerun    = "rerun"
+	TriggerPromote  = "promotion"
+)
+
+// freezeRecheckInterval is how often a held deploy checks the freeze windows again
+const freezeRecheckInterval = time.Minute
+
+// ErrNotApprover is returned when a user may not approve deploys to the run's environment
+var ErrNotApprover = errors.New("not an approver")
+
+// RunRequest describes what a new pipeline run should build
+type RunRequest struct {
+	Repo    *config.RepositoryConfig
+	Ref     string // e.g., "refs/heads/main"
+	SHA     string
+	Trigger string // TriggerWebhook, TriggerPoll, ...
+	// Manual runs only
+	Env         map[string]string // extra environment variables for the pipeline commands
+	TriggeredBy string
+	RerunOf     string // id of the run being retried
+	// Environment to deploy to, defaults to the first configured one
+	Environment  string
+	PromotedFrom string // id of the run whose commit is promoted
+	// Resumed runs only
+	RunID string // keep the id of the interrupted run
+}
+
+// StartPipeline clones the repository, registers a new run and executes the
+// pipeline in the background, reporting the commit status to the git provider.
+// It returns the id of the new run.
+func StartPipeline(cfg *config.PipelineConfig, req RunRequest) (string, error) {
+	repo, sha := req.Repo, req.SHA
+	runID := req.RunID
+	if runID == "" {
+		runID = status.NewID()
+	}
+	ref := req.Ref
+	if ref == "" {
+		ref = "refs/heads/" + repo.Branch
+	}
+	environment := req.Environment
+	if environment == "" && len(cfg.Environments) > 0 {
+		environment = cfg.Environments[0].Name
+	}
+	env := cfg.Environment(environment)
+	if environment != "" && env == nil {
+		return "", fmt.Errorf("unknown environment %q", environment)
+	}
+	run := status.PipelineStatus{
+		ID:           runID,
+		Repository:   repo.URL,
+		Ref:          ref,
+		Commit:       sha,
+		Trigger:      req.Trigger,
+		TriggeredBy:  req.TriggeredBy,
+		RerunOf:      req.RerunOf,
+		Environment:  environment,
+		PromotedFrom: req.PromotedFrom,
+		Env:          req.Env,
+		Status:       "cloning",
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	active, started := registerRun(run, cancel)
+	if !started {
+		// goFlow is shutting down: the run is kept for the next start
+		cancel()
+		logrus.Infof("Shutting down, queued run %s for %s", runID, repo.URL)
+		return runID, nil
+	}
+
+	reporter, err := NewStatusReporter(repo)
+	if err != nil {
+		logrus.Warnf("Commit statuses disabled for %s: %v", repo.URL, err)
+	}
+	report := func(state, description string) {
+		if reporter == nil || sha == "" {
+			return
+		}
+		commitStatus := CommitStatus{
+			SHA:         sha,
+			State:       state,
+			TargetURL:   runURL(cfg, runID),
+			Description: description,
+		}
+		if err := reporter.Report(commitStatus); err != nil {
+			logrus.Warnf("Failed to report %s status for %s: %v", state, sha, err)
+		}
+	}
+
+	repoPath, err := Clone(repo.URL, BranchFromRef(ref))
+	if err == nil && sha != "" {
+		if err = Checkout(repoPath, sha); err != nil {
+			os.RemoveAll(repoPath)
+		}
+	}
+	if err != nil {
+		unregisterRun(runID)
+		cancel()
+		status.Add(runID, "failed", err.Error())
+		report(StateFailure, "Clone failed")
+		return runID, err
+	}
+
+	// TRigger Pipeline
+	status.Add(runID, "running", "")
+	report(StateRunning, "Pipeline running")
+	go func() {
+		p := pipeline.New(cfg.ForEnvironment(env), repoPath)
+		p.SetEnv(req.Env)
+		p.SetRevision(ref, sha)
+		if env != nil {
+			p.SetDeployEnv(env.Secrets)
+			if env.Protected {
+				p.SetApprovalGate(func(ctx context.Context) error {
+					return waitForApproval(ctx, runID, active, env, report)
+				})
+			}
+			p.SetDeployGate(func(ctx context.Context) error {
+				return waitForDeployWindow(ctx, runID, active, env, report)
+			})
+		}
+		p.ReportHosts(func(hosts []deployments.Host) { status.SetHosts(runID, hosts) })
+		// Looked up when deploying, another run may deploy while this one builds
+		p.SetLiveCommit(func() string {
+			if live := deployments.Current(repo.URL, environment); live != nil {
+				return live.Commit
+			}
+			return ""
+		})
+		err := p.Run(ctx)
+		if d := p.Deployment(); d != nil {
+			d.ID = runID
+			d.Repository = repo.URL
+			d.Environment = environment
+			d.DeployedBy = req.TriggeredBy
+			if d.DeployedBy == "" {
+				d.DeployedBy = req.Trigger
+			}
+			if run, ok := status.Get(runID); ok {
+				d.ApprovedBy = run.ApprovedBy
+			}
+			deployments.Record(*d)
+		}
+		finishRun(ctx, runID, environment, active, err, report)
+		unregisterRun(runID)
+		cancel()
+	}()
+	return runID, nil
+}
+
+// finishRun records how the run ended. A pipeline that completed succeeded,
+// even when it was cancelled or interrupted right after.
+func finishRun(ctx context.Context, runID, environment string, active *activeRun, err error, report func(state, description string)) {
+	if err == nil && active.isInterrupted() {
+		// Nothing left to resume on restart
+		unqueue(runID)
+	}
+	switch {
+	case err == nil && active.skippedDeploy():
+		status.Add(runID, "deploy_skipped", "")
+		report(StateSuccess, "Pipeline succeeded, deploy to "+environment+" skipped")
+	case err == nil:
+		status.Add(runID, "success", "")
+		report(StateSuccess, "Pipeline succeeded")
+	case active.isInterrupted():
+		logrus.Warnf("Pipeline %s interrupted by shutdown, it will resume on restart", runID)
+		status.Add(runID, "interrupted", "")
+		report(StatePending, "Interrupted by goFlow restart, will resume")
+	case ctx.Err() != nil:
+		by := active.cancelledBy()
+		logrus.Warnf("Pipeline %s cancelled by %s", runID, by)
+		status.MarkCancelled(runID, by)
+		report(StateCancelled, "Pipeline cancelled by "+by)
+	default:
+		logrus.Errorf("Pipeline %s failed: %v", runID, err)
+		status.Add(runID, "failed", err.Error())
+		report(StateFailure, "Pipeline failed")
+	}
+}
+
+// activeRun is the cancellation handle of a cloning or running pipeline
+type activeRun struct {
+	run         status.PipelineStatus // what was requested, to queue it again on shutdown
+	cancel      context.CancelFunc
+	mu          sync.Mutex
+	by          string
+	interrupted bool // cancelled by shutdown rather than by a user
+	// Set while the run waits for an approval to deploy
+	approved  chan<- string
+	approvers []string
+	// Deploy held by a freeze or lock: while waiting, or for good when skipped
+	blocked bool
+	skipped bool
+}
+
+func (r *activeRun) cancelledBy() string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.by
+}
+
+func (r *activeRun) isInterrupted() bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.interrupted
+}
+
+var (
+	activeRuns   = make(map[string]*activeRun)
+	activeRunsMu sync.Mutex
+)
+
+// registerRun records a starting run, or queues it when goFlow is draining
+func registerRun(run status.PipelineStatus, cancel context.CancelFunc) (*activeRun, bool) {
+	activeRunsMu.Lock()
+	defer activeRunsMu.Unlock()
+	if draining {
+		run.Status = "queued"
+		status.Register(run)
+		queued = append(queued, queuedRunOf(run))
+		return nil, false
+	}
+	status.Register(run)
+	active := &activeRun{run: run, cancel: cancel}
+	activeRuns[run.ID] = active
+	return active, true
+}
+
+func unregisterRun(runID string) {
+	activeRunsMu.Lock()
+	defer activeRunsMu.Unlock()
+	delete(activeRuns, runID)
+}
+
+// waitForApproval blocks the run until ApproveRun is called for it or ctx is done
+func waitForApproval(ctx context.Context, runID string, active *activeRun, env *config.EnvironmentConfig, report func(state, description string)) error {
+	approved := make(chan string, 1)
+	active.mu.Lock()
+	active.approved = approved
+	active.approvers = env.Approvers
+	active.mu.Unlock()
+	defer func() {
+		active.mu.Lock()
+		active.approved = nil
+		active.mu.Unlock()
+	}()
+
+	logrus.Infof("Pipeline %s is waiting for approval to deploy to %s", runID, env.Name)
+	status.Add(runID, "waiting_approval", "")
+	report(StatePending, "Waiting for approval to deploy to "+env.Name)
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case user := <-approved:
+		logrus.Infof("Deploy of %s to %s approved by %s", runID, env.Name, user)
+		status.MarkApproved(runID, user)
+		report(StateRunning, fmt.Sprintf("Deploying to %s, approved by %s", env.Name, user))
+		return nil
+	}
+}
+
+// isWaiting reports whether the run waits for an approval or the end of a deploy freeze
+func (r *activeRun) isWaiting() bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.approved != nil || r.blocked
+}
+
+func (r *activeRun) skippedDeploy() bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.skipped
+}
+
+// waitForDeployWindow checks the environment's deploy lock and freeze windows
+// right before deploying. While one is in effect the deploy is skipped, or with
+// on_freeze "wait", held until it ends or ctx is done.
+func waitForDeployWindow(ctx context.Context, runID string, active *activeRun, env *config.EnvironmentConfig, report func(state, description string)) error {
+	waiting := false
+	defer func() {
+		active.mu.Lock()
+		active.blocked = false
+		active.mu.Unlock()
+	}()
+	for {
+		changed := freeze.Changed()
+		block, blocked := freeze.Check(env, time.Now())
+		if !blocked {
+			if waiting {
+				logrus.Infof("Deploy of %s to %s unblocked", runID, env.Name)
+				status.Add(runID, "running", "")
+				status.SetDeployBlocked(runID, "")
+				report(StateRunning, "Deploying to "+env.Name)
+			}
+			return nil
+		}
+		status.SetDeployBlocked(runID, block.Reason)
+		if env.OnFreeze != "wait" {
+			logrus.Infof("Pipeline %s does not deploy to %s: %s", runID, env.Name, block.Reason)
+			active.mu.Lock()
+			active.skipped = true
+			active.mu.Unlock()
+			return fmt.Errorf("%w: %s", pipeline.ErrDeploySkipped, block.Reason)
+		}
+		if !waiting {
+			waiting = true
+			logrus.Infof("Pipeline %s waits to deploy to %s: %s", runID, env.Name, block.Reason)
+			active.mu.Lock()
+			active.blocked = true
+			active.mu.Unlock()
+			status.Add(runID, "deploy_blocked", "")
+			report(StatePending, fmt.Sprintf("Deploy to %s blocked: %s", env.Name, block.Reason))
+		}
+
+		// Locks wake the run up when released, freezes are checked again when they end
+		recheck := freezeRecheckInterval
+		if block.Until != nil {
+			recheck = min(recheck, max(time.Until(*block.Until), time.Second))
+		}
+		timer := time.NewTimer(recheck)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return ctx.Err()
+		case <-changed:
+		case <-timer.C:
+		}
+		timer.Stop()
+	}
+}
+
+// ApproveRun lets a run waiting for approval go on with its deploy
+func ApproveRun(runID, user string) error {
+	activeRunsMu.Lock()
+	defer activeRunsMu.Unlock()
+	run, ok := activeRuns[runID]
+	if !ok {
+		return fmt.Errorf("run %s is not running", runID)
+	}
+
+	run.mu.Lock()
+	defer run.mu.Unlock()
+	if run.approved == nil {
+		return fmt.Errorf("run %s is not waiting for approval", runID)
+	}
+	// Four eyes: whoever triggered the run can't approve its deploy
+	if user == "" || user == run.run.TriggeredBy {
+		return fmt.Errorf("%w: %q triggered run %s", ErrNotApprover, user, runID)
+	}
+	if !slices.Contains(run.approvers, user) {
+		return fmt.Errorf("%w: %s may not approve deploys to %s", ErrNotApprover, user, run.run.Environment)
+	}
+	run.approved <- user
+	run.approved = nil
+	return nil
+}
+
+// CancelRun stops a running pipeline on behalf of the given user
+func CancelRun(runID, user string) error {
+	activeRunsMu.Lock()
+	defer activeRunsMu.Unlock()
+	run, ok := activeRuns[runID]
+	if !ok {
+		return fmt.Errorf("run %s is not running", runID)
+	}
+
+	run.mu.Lock()
+	if run.by == "" {
+		run.by = user
+	}
+	run.mu.Unlock()
+	status.Add(runID, "cancelling", "")
+	run.cancel()
+	return nil
+}
+
+// runURL returns the link to the run status, empty when no public url is configured
+func runURL(cfg *config.PipelineConfig, runID string) string {
+	if cfg.Server.PublicURL == "" {
+		return ""
+	}
+	return fmt.Sprintf("%s/status/%s", strings.TrimRight(cfg.Server.PublicURL, "/"), runID)
+}
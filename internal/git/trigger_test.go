@@ -0,0 +1,144 @@
+package git
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/khaledibrahim1015/goFlow-cicd/internal/config"
+	"github.com/khaledibrahim1015/goFlow-cicd/internal/freeze"
+	"github.com/khaledibrahim1015/goFlow-cicd/internal/pipeline"
+	"github.com/khaledibrahim1015/goFlow-cicd/internal/status"
+)
+
+func TestApproveRun(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	run := status.PipelineStatus{ID: "approve1", Environment: "prod", Status: "running", TriggeredBy: "carol"}
+	active, _ := registerRun(run, cancel)
+	defer unregisterRun(run.ID)
+
+	if err := ApproveRun(run.ID, "alice"); err == nil {
+		t.Fatal("expected approving a run that does not wait to fail")
+	}
+
+	wait := func(ctx context.Context, env *config.EnvironmentConfig) <-chan error {
+		done := make(chan error, 1)
+		go func() {
+			done <- waitForApproval(ctx, run.ID, active, env, func(string, string) {})
+		}()
+		for !active.isWaiting() {
+			time.Sleep(time.Millisecond)
+		}
+		return done
+	}
+
+	// Without approvers nobody may approve, the run waits until cancelled
+	waiting, stop := context.WithCancel(ctx)
+	done := wait(waiting, &config.EnvironmentConfig{Name: "prod", Protected: true})
+	if err := ApproveRun(run.ID, "bob"); !errors.Is(err, ErrNotApprover) {
+		t.Errorf("approval by bob without approvers: %v", err)
+	}
+	stop()
+	if err := <-done; err == nil {
+		t.Fatal("waitForApproval returned without an approval")
+	}
+
+	// Only listed approvers, and not the user who triggered the run
+	done = wait(ctx, &config.EnvironmentConfig{Name: "prod", Protected: true, Approvers: []string{"alice", "carol"}})
+	if s, _ := status.Get(run.ID); s.Status != "waiting_approval" {
+		t.Errorf("status = %q, want waiting_approval", s.Status)
+	}
+	for _, user := range []string{"bob", "carol", ""} {
+		if err := ApproveRun(run.ID, user); !errors.Is(err, ErrNotApprover) {
+			t.Errorf("approval by %q: %v", user, err)
+		}
+	}
+	if err := ApproveRun(run.ID, "alice"); err != nil {
+		t.Fatalf("approval by alice: %v", err)
+	}
+	if err := <-done; err != nil {
+		t.Fatalf("waitForApproval: %v", err)
+	}
+	if s, _ := status.Get(run.ID); s.Status != "running" || s.ApprovedBy != "alice" {
+		t.Errorf("status = %q approved by %q", s.Status, s.ApprovedBy)
+	}
+}
+
+func TestDeployWindowWaitsForUnlock(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	run := status.PipelineStatus{ID: "locked1", Environment: "prod", Status: "running"}
+	active, _ := registerRun(run, cancel)
+	defer unregisterRun(run.ID)
+
+	env := &config.EnvironmentConfig{Name: "prod", OnFreeze: "wait"}
+	if _, err := freeze.Acquire("prod", "alice", "incident 42"); err != nil {
+		t.Fatal(err)
+	}
+	done := make(chan error, 1)
+	go func() {
+		done <- waitForDeployWindow(ctx, run.ID, active, env, func(string, string) {})
+	}()
+	for !active.isWaiting() {
+		time.Sleep(time.Millisecond)
+	}
+	if s, _ := status.Get(run.ID); s.Status != "deploy_blocked" || s.DeployBlocked != "deploy lock by alice: incident 42" {
+		t.Errorf("status = %q, blocked by %q", s.Status, s.DeployBlocked)
+	}
+
+	freeze.Release("prod")
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatalf("waitForDeployWindow: %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("release of the lock did not resume the deploy")
+	}
+	if s, _ := status.Get(run.ID); s.Status != "running" || s.DeployBlocked != "" {
+		t.Errorf("status = %q, blocked by %q", s.Status, s.DeployBlocked)
+	}
+
+	// Without on_freeze "wait" the deploy is skipped
+	env.OnFreeze = ""
+	env.Freezes = []config.FreezeWindow{{Name: "year-end", Start: "2000-01-01", End: "2999-01-01"}}
+	err := waitForDeployWindow(ctx, run.ID, active, env, func(string, string) {})
+	if !errors.Is(err, pipeline.ErrDeploySkipped) || !active.skippedDeploy() {
+		t.Errorf("err = %v", err)
+	}
+}
+
+func TestCancelRun(t *testing.T) {
+	noReport := func(string, string) {}
+	cases := []struct {
+		id, name string
+		err      error
+		status   string
+	}{
+		{"cancel1", "stopped by the cancel", errors.New("pipeline cancelled: build failed: signal: killed"), "cancelled"},
+		{"cancel2", "completed before the cancel took effect", nil, "success"},
+	}
+	for _, c := range cases {
+		ctx, cancel := context.WithCancel(context.Background())
+		run := status.PipelineStatus{ID: c.id, Status: "running"}
+		active, _ := registerRun(run, cancel)
+
+		if err := CancelRun(run.ID, "alice"); err != nil {
+			t.Fatalf("%s: CancelRun: %v", c.name, err)
+		}
+		if s, _ := status.Get(run.ID); s.Status != "cancelling" || ctx.Err() == nil {
+			t.Errorf("%s: status = %q, ctx = %v", c.name, s.Status, ctx.Err())
+		}
+		finishRun(ctx, run.ID, "", active, c.err, noReport)
+		unregisterRun(run.ID)
+		if s, _ := status.Get(run.ID); s.Status != c.status || (c.status == "cancelled" && s.CancelledBy != "alice") {
+			t.Errorf("%s: status = %q, cancelled by %q", c.name, s.Status, s.CancelledBy)
+		}
+	}
+
+	if err := CancelRun("cancel-unknown", "alice"); err == nil {
+		t.Error("expected cancelling a run that is not running to fail")
+	}
+}
@@ -0,0 +1,21 @@
+package handlers
+
+import (
+	"crypto/subtle"
+
+	"github.com/khaledibrahim1015/goFlow-cicd/internal/config"
+	"github.com/khaledibrahim1015/goFlow-cicd/internal/server"
+)
+
+// APIAuth is the middleware protecting the run management endpoints: it
+// accepts the configured API tokens and stores the matching user in the context
+func APIAuth(cfg *config.PipelineConfig) server.MiddlewareFunc {
+	return server.BearerAuth(func(token string) (string, bool) {
+		for _, t := range cfg.API.Tokens {
+			if subtle.ConstantTimeCompare([]byte(t.Token), []byte(token)) == 1 {
+				return t.User, true
+			}
+		}
+		return "", false
+	})
+}
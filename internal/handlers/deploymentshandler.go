@@ -0,0 +1,250 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/khaledibrahim1015/goFlow-cicd/internal/config"
+	"github.com/khaledibrahim1015/goFlow-cicd/internal/deployments"
+	"github.com/khaledibrahim1015/goFlow-cicd/internal/freeze"
+	"github.com/khaledibrahim1015/goFlow-cicd/internal/pipeline"
+	"github.com/khaledibrahim1015/goFlow-cicd/internal/server"
+	"github.com/sirupsen/logrus"
+)
+
+// rollbackTimeout bounds the SSH commands of an on-demand rollback
+const rollbackTimeout = 2 * time.Minute
+
+type DeploymentsController struct {
+	cfg *config.PipelineConfig
+}
+
+func NewDeploymentsController(cfg *config.PipelineConfig) *DeploymentsController {
+	return &DeploymentsController{
+		cfg: cfg,
+	}
+}
+
+// Rollback handles POST /deployments/:id/rollback, switching every host back
+// to the release that was current before the deployment
+func (dc *DeploymentsController) Rollback(ctx *server.HttpContext) {
+	user := ctx.GetString(server.ContextKeyUser)
+
+	id, err := ctx.Param("id")
+	if err != nil {
+		ctx.JSON(server.StatusBadRequest, server.Generalesponse{
+			"error":   server.ResponseMessage["invalid_id"],
+			"message": server.StatusCodeText[server.StatusBadRequest],
+		})
+		return
+	}
+	d, found := deployments.Get(id)
+	if !found {
+		ctx.JSON(server.StatusNotFound, server.Generalesponse{
+			"error":   fmt.Sprintf("deployment %s not found", id),
+			"message": server.StatusCodeText[server.StatusNotFound],
+		})
+		return
+	}
+	// Hosts and releases of the environment the deployment went to
+	sshConfig := dc.cfg.ForEnvironment(dc.cfg.Environment(d.Environment)).Deploy.SSH
+	if d.Method != "ssh" || d.Status != "deployed" || sshConfig == nil {
+		ctx.JSON(server.StatusConflict, server.Generalesponse{
+			"error":   fmt.Sprintf("deployment %s (%s, %s) cannot be rolled back", id, d.Method, d.Status),
+			"message": server.StatusCodeText[server.StatusConflict],
+		})
+		return
+	}
+	var hosts []string
+	for _, h := range d.Hosts {
+		if h.Status != "deployed" {
+			continue
+		}
+		if !slices.Contains(sshConfig.Targets(), h.Host) {
+			ctx.JSON(server.StatusConflict, server.Generalesponse{
+				"error":   fmt.Sprintf("host %s of deployment %s is not configured anymore", h.Host, id),
+				"message": server.StatusCodeText[server.StatusConflict],
+			})
+			return
+		}
+		hosts = append(hosts, h.Host)
+	}
+
+	rollbackCtx, cancel := context.WithTimeout(context.Background(), rollbackTimeout)
+	defer cancel()
+	if err := pipeline.RollbackDeployment(rollbackCtx, sshConfig, d); err != nil {
+		logrus.Errorf("Rollback of deployment %s requested by %s failed: %v", id, user, err)
+		ctx.JSON(server.StatusConflict, server.Generalesponse{
+			"error":   err.Error(),
+			"message": server.StatusCodeText[server.StatusConflict],
+		})
+		return
+	}
+	if err := deployments.MarkRolledBack(id, user); err != nil {
+		logrus.Errorf("Failed to record rollback of %s: %v", id, err)
+	}
+
+	logrus.Infof("Deployment %s rolled back on %s by %s", id, strings.Join(hosts, ", "), user)
+	ctx.JSON(server.StatusOK, server.Generalesponse{
+		"id":      id,
+		"hosts":   hosts,
+		"message": fmt.Sprintf("Deployment %s rolled back on %d host(s)", id, len(hosts)),
+	})
+}
+
+// List handles GET /deployments, newest first. Optional filters:
+// ?repository=...&environment=prod&host=web1&status=deployed&limit=20
+func (dc *DeploymentsController) List(ctx *server.HttpContext) {
+	var filter deployments.Filter
+	filter.Repository, _ = ctx.Query("repository")
+	filter.Environment, _ = ctx.Query("environment")
+	filter.Host, _ = ctx.Query("host")
+	filter.Status, _ = ctx.Query("status")
+	list := deployments.List(filter)
+
+	if limitParam, err := ctx.Query("limit"); err == nil {
+		limit, err := strconv.Atoi(limitParam)
+		if err != nil || limit < 1 {
+			ctx.JSON(server.StatusBadRequest, server.Generalesponse{
+				"error":   fmt.Sprintf("invalid limit %q", limitParam),
+				"message": server.StatusCodeText[server.StatusBadRequest],
+			})
+			return
+		}
+		list = list[:min(limit, len(list))]
+	}
+	if list == nil {
+		list = []deployments.Deployment{}
+	}
+	ctx.JSON(server.StatusOK, server.Generalesponse{
+		"data":    list,
+		"message": server.StatusCodeText[server.StatusOK],
+	})
+}
+
+// LockRequest is the body of POST /environments/:name/lock
+type LockRequest struct {
+	Reason string `json:"reason"` // e.g. "incident 42", required
+}
+
+// Environment handles GET /environments/:name: what each repository has
+// deployed there, per host, and the commits between the current and previous
+// deployment, along with the deploy lock or freeze in effect.
+// ?repository=... limits it to one repository.
+func (dc *DeploymentsController) Environment(ctx *server.HttpContext) {
+	env, ok := dc.environment(ctx)
+	if !ok {
+		return
+	}
+	wantRepo, _ := ctx.Query("repository")
+
+	live := []deployments.Live{}
+	for _, repo := range dc.cfg.Repositories {
+		if wantRepo == "" || repo.URL == wantRepo {
+			live = append(live, deployments.LiveIn(repo.URL, env.Name))
+		}
+	}
+	data := server.Generalesponse{
+		"name":         env.Name,
+		"protected":    env.Protected,
+		"repositories": live,
+	}
+	if block, blocked := freeze.Check(env, time.Now()); blocked {
+		data["deploy_blocked"] = block
+	}
+	ctx.JSON(server.StatusOK, server.Generalesponse{
+		"data":    data,
+		"message": server.StatusCodeText[server.StatusOK],
+	})
+}
+
+// Lock handles POST /environments/:name/lock, stopping deploys to the
+// environment until the lock is released
+func (dc *DeploymentsController) Lock(ctx *server.HttpContext) {
+	user := ctx.GetString(server.ContextKeyUser)
+	env, ok := dc.environment(ctx)
+	if !ok {
+		return
+	}
+	var body LockRequest
+	if err := json.Unmarshal(ctx.Request.Body, &body); err != nil {
+		ctx.JSON(server.StatusBadRequest, server.Generalesponse{
+			"error":   fmt.Sprintf("%s: %v", server.ResponseMessage["invalid_json"], err),
+			"message": server.StatusCodeText[server.StatusBadRequest],
+		})
+		return
+	}
+	if strings.TrimSpace(body.Reason) == "" {
+		ctx.JSON(server.StatusBadRequest, server.Generalesponse{
+			"error":   "reason required",
+			"message": server.StatusCodeText[server.StatusBadRequest],
+		})
+		return
+	}
+
+	lock, err := freeze.Acquire(env.Name, user, body.Reason)
+	if errors.Is(err, freeze.ErrLocked) {
+		ctx.JSON(server.StatusConflict, server.Generalesponse{
+			"error":   fmt.Sprintf("%s is already locked by %s: %s", env.Name, lock.LockedBy, lock.Reason),
+			"lock":    lock,
+			"message": server.StatusCodeText[server.StatusConflict],
+		})
+		return
+	}
+	logrus.Infof("Deploys to %s locked by %s: %s", env.Name, user, body.Reason)
+	ctx.JSON(server.StatusCreated, server.Generalesponse{
+		"lock":    lock,
+		"message": fmt.Sprintf("Deploys to %s are locked", env.Name),
+	})
+}
+
+// Unlock handles DELETE /environments/:name/lock. Runs holding their deploy
+// for the lock go on right away.
+func (dc *DeploymentsController) Unlock(ctx *server.HttpContext) {
+	user := ctx.GetString(server.ContextKeyUser)
+	env, ok := dc.environment(ctx)
+	if !ok {
+		return
+	}
+	lock, released := freeze.Release(env.Name)
+	if !released {
+		ctx.JSON(server.StatusNotFound, server.Generalesponse{
+			"error":   fmt.Sprintf("%s is not locked", env.Name),
+			"message": server.StatusCodeText[server.StatusNotFound],
+		})
+		return
+	}
+	logrus.Infof("Deploy lock of %s (%s, by %s) released by %s", env.Name, lock.Reason, lock.LockedBy, user)
+	ctx.JSON(server.StatusOK, server.Generalesponse{
+		"lock":    lock,
+		"message": fmt.Sprintf("Deploys to %s are unlocked", env.Name),
+	})
+}
+
+// environment returns the environment named in the path, responding with an
+// error when there is none
+func (dc *DeploymentsController) environment(ctx *server.HttpContext) (*config.EnvironmentConfig, bool) {
+	name, err := ctx.Param("name")
+	if err != nil {
+		ctx.JSON(server.StatusBadRequest, server.Generalesponse{
+			"error":   "invalid environment name",
+			"message": server.StatusCodeText[server.StatusBadRequest],
+		})
+		return nil, false
+	}
+	env := dc.cfg.Environment(name)
+	if env == nil {
+		ctx.JSON(server.StatusNotFound, server.Generalesponse{
+			"error":   fmt.Sprintf("environment %s not found", name),
+			"message": server.StatusCodeText[server.StatusNotFound],
+		})
+		return nil, false
+	}
+	return env, true
+}
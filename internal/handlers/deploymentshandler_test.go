@@ -0,0 +1,57 @@
+package handlers
+
+import (
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/khaledibrahim1015/goFlow-cicd/internal/config"
+	"github.com/khaledibrahim1015/goFlow-cicd/internal/deployments"
+	"github.com/khaledibrahim1015/goFlow-cicd/internal/server"
+	"github.com/khaledibrahim1015/goFlow-cicd/pkg/sshclient/sshtest"
+)
+
+func TestRollback(t *testing.T) {
+	keyPath, public := sshtest.NewKey(t)
+	srv := sshtest.NewServer(t, public)
+	base := filepath.Join(srv.Dir, "app")
+	os.MkdirAll(filepath.Join(base, "releases", "20261018130000-bbb"), 0755)
+	os.Symlink("releases/20261018130000-bbb", filepath.Join(base, "current"))
+
+	// The environment deploys over SSH, the top-level deploy config does not
+	cfg := &config.PipelineConfig{Environments: []config.EnvironmentConfig{{Name: "prod", Deploy: config.DeployConfig{
+		Method: "ssh",
+		SSH: &config.SSHConfig{RemoteUser: "deploy", RemoteHost: srv.Addr, RemotePath: "app", KeepReleases: 2,
+			KeyPath: keyPath, KnownHosts: sshtest.WriteKnownHosts(t, srv)},
+	}}}}
+	deployments.Record(deployments.Deployment{ID: "rollback1", Environment: "prod", Method: "ssh", Status: "deployed",
+		Hosts: []deployments.Host{{Host: srv.Addr, Status: "deployed", Release: "20261018130000-bbb", Previous: "20261018120000-aaa"}}})
+	r := server.NewRouter()
+	r.POST("/deployments/:id/rollback", NewDeploymentsController(cfg).Rollback)
+	rollback := func() *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		r.ServeHTTP(rec, httptest.NewRequest("POST", "/deployments/rollback1/rollback", nil))
+		return rec
+	}
+
+	// The previous release was removed, by hand or by an older keep_releases setting
+	if rec := rollback(); rec.Code != server.StatusConflict || !strings.Contains(rec.Body.String(), "was removed") {
+		t.Fatalf("rollback to a pruned release: code = %d, body = %s", rec.Code, rec.Body.String())
+	}
+	if current, _ := os.Readlink(filepath.Join(base, "current")); current != "releases/20261018130000-bbb" {
+		t.Errorf("current = %q after the refused rollback", current)
+	}
+
+	os.MkdirAll(filepath.Join(base, "releases", "20261018120000-aaa"), 0755)
+	if rec := rollback(); rec.Code != server.StatusOK {
+		t.Fatalf("rollback: code = %d, body = %s", rec.Code, rec.Body.String())
+	}
+	if current, _ := os.Readlink(filepath.Join(base, "current")); current != "releases/20261018120000-aaa" {
+		t.Errorf("current = %q after rollback", current)
+	}
+	if d, _ := deployments.Get("rollback1"); d.Status != "rolled_back" {
+		t.Errorf("deployment status = %q", d.Status)
+	}
+}
@@ -0,0 +1,325 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/khaledibrahim1015/goFlow-cicd/internal/config"
+	"github.com/khaledibrahim1015/goFlow-cicd/internal/git"
+	"github.com/khaledibrahim1015/goFlow-cicd/internal/server"
+	"github.com/khaledibrahim1015/goFlow-cicd/internal/status"
+	"github.com/sirupsen/logrus"
+)
+
+// RunRequest is the body of POST /runs
+type RunRequest struct {
+	Repository string            `json:"repository"` // repository url, optional when only one is configured
+	Ref        string            `json:"ref"`        // branch, tag or full ref; defaults to the configured branch
+	SHA        string            `json:"sha"`        // exact commit to build
+	Env        map[string]string `json:"env"`        // environment overrides for the pipeline commands
+	// Environment to deploy to, defaults to the first configured one
+	Environment string `json:"environment"`
+}
+
+// PromoteRequest is the optional body of POST /runs/:id/promote
+type PromoteRequest struct {
+	Environment string `json:"environment"` // defaults to the environment after the run's one
+}
+
+type RunsController struct {
+	cfg *config.PipelineConfig
+}
+
+func NewRunsController(cfg *config.PipelineConfig) *RunsController {
+	return &RunsController{
+		cfg: cfg,
+	}
+}
+
+// TriggerRun handles POST /runs
+func (rc *RunsController) TriggerRun(ctx *server.HttpContext) {
+	user := ctx.GetString(server.ContextKeyUser)
+
+	var body RunRequest
+	if err := json.Unmarshal(ctx.Request.Body, &body); err != nil {
+		ctx.JSON(server.StatusBadRequest, server.Generalesponse{
+			"error":   fmt.Sprintf("%s: %v", server.ResponseMessage["invalid_json"], err),
+			"message": server.StatusCodeText[server.StatusBadRequest],
+		})
+		return
+	}
+
+	repo := rc.cfg.Repository(body.Repository)
+	if body.Repository == "" && len(rc.cfg.Repositories) == 1 {
+		repo = &rc.cfg.Repositories[0]
+	}
+	if repo == nil {
+		ctx.JSON(server.StatusBadRequest, server.Generalesponse{
+			"error":   fmt.Sprintf("unknown repository: %q", body.Repository),
+			"message": server.StatusCodeText[server.StatusBadRequest],
+		})
+		return
+	}
+
+	if body.SHA != "" && !git.IsCommitSHA(body.SHA) {
+		ctx.JSON(server.StatusBadRequest, server.Generalesponse{
+			"error":   fmt.Sprintf("invalid sha %q: expected 7 to 40 hex characters", body.SHA),
+			"message": server.StatusCodeText[server.StatusBadRequest],
+		})
+		return
+	}
+	ref := body.Ref
+	if strings.HasPrefix(git.BranchFromRef(ref), "-") {
+		ctx.JSON(server.StatusBadRequest, server.Generalesponse{
+			"error":   fmt.Sprintf("invalid ref %q", body.Ref),
+			"message": server.StatusCodeText[server.StatusBadRequest],
+		})
+		return
+	}
+	if ref != "" && !strings.HasPrefix(ref, "refs/") {
+		ref = "refs/heads/" + ref
+	}
+	if body.Environment != "" && rc.cfg.Environment(body.Environment) == nil {
+		ctx.JSON(server.StatusBadRequest, server.Generalesponse{
+			"error":   fmt.Sprintf("unknown environment: %q", body.Environment),
+			"message": server.StatusCodeText[server.StatusBadRequest],
+		})
+		return
+	}
+
+	logrus.Infof("Manual run of %s (ref: %q, sha: %q) requested by %s", repo.URL, ref, body.SHA, user)
+	rc.start(ctx, git.RunRequest{
+		Repo:        repo,
+		Ref:         ref,
+		SHA:         body.SHA,
+		Trigger:     git.TriggerManual,
+		Env:         body.Env,
+		TriggeredBy: user,
+		Environment: body.Environment,
+	})
+}
+
+// RerunRun handles POST /runs/:id/rerun
+func (rc *RunsController) RerunRun(ctx *server.HttpContext) {
+	user := ctx.GetString(server.ContextKeyUser)
+
+	id, err := ctx.Param("id")
+	if err != nil {
+		ctx.JSON(server.StatusBadRequest, server.Generalesponse{
+			"error":   server.ResponseMessage["invalid_id"],
+			"message": server.StatusCodeText[server.StatusBadRequest],
+		})
+		return
+	}
+	previous, found := status.Get(id)
+	if !found {
+		ctx.JSON(server.StatusNotFound, server.Generalesponse{
+			"error":   fmt.Sprintf("run %s not found", id),
+			"message": server.StatusCodeText[server.StatusNotFound],
+		})
+		return
+	}
+	repo := rc.cfg.Repository(previous.Repository)
+	if repo == nil {
+		ctx.JSON(server.StatusBadRequest, server.Generalesponse{
+			"error":   fmt.Sprintf("repository %s is no longer configured", previous.Repository),
+			"message": server.StatusCodeText[server.StatusBadRequest],
+		})
+		return
+	}
+
+	logrus.Infof("Rerun of %s requested by %s", id, user)
+	rc.start(ctx, git.RunRequest{
+		Repo:        repo,
+		Ref:         previous.Ref,
+		SHA:         previous.Commit,
+		Trigger:     git.TriggerRerun,
+		Env:         previous.Env,
+		TriggeredBy: user,
+		RerunOf:     id,
+		Environment: previous.Environment,
+	})
+}
+
+// PromoteRun handles POST /runs/:id/promote, deploying the commit of a
+// successful run to the next environment, or the one named in the body
+func (rc *RunsController) PromoteRun(ctx *server.HttpContext) {
+	user := ctx.GetString(server.ContextKeyUser)
+
+	id, err := ctx.Param("id")
+	if err != nil {
+		ctx.JSON(server.StatusBadRequest, server.Generalesponse{
+			"error":   server.ResponseMessage["invalid_id"],
+			"message": server.StatusCodeText[server.StatusBadRequest],
+		})
+		return
+	}
+	var body PromoteRequest
+	if len(ctx.Request.Body) > 0 {
+		if err := json.Unmarshal(ctx.Request.Body, &body); err != nil {
+			ctx.JSON(server.StatusBadRequest, server.Generalesponse{
+				"error":   fmt.Sprintf("%s: %v", server.ResponseMessage["invalid_json"], err),
+				"message": server.StatusCodeText[server.StatusBadRequest],
+			})
+			return
+		}
+	}
+	previous, found := status.Get(id)
+	if !found {
+		ctx.JSON(server.StatusNotFound, server.Generalesponse{
+			"error":   fmt.Sprintf("run %s not found", id),
+			"message": server.StatusCodeText[server.StatusNotFound],
+		})
+		return
+	}
+	if previous.Status != "success" || previous.Environment == "" {
+		ctx.JSON(server.StatusConflict, server.Generalesponse{
+			"error":   fmt.Sprintf("only successful runs of an environment can be promoted, run %s is %s", id, previous.Status),
+			"message": server.StatusCodeText[server.StatusConflict],
+		})
+		return
+	}
+	target := body.Environment
+	if target == "" {
+		target = rc.cfg.NextEnvironment(previous.Environment)
+	}
+	if !rc.promotable(previous.Environment, target) {
+		ctx.JSON(server.StatusConflict, server.Generalesponse{
+			"error":   fmt.Sprintf("cannot promote from %s to %q", previous.Environment, target),
+			"message": server.StatusCodeText[server.StatusConflict],
+		})
+		return
+	}
+	repo := rc.cfg.Repository(previous.Repository)
+	if repo == nil {
+		ctx.JSON(server.StatusBadRequest, server.Generalesponse{
+			"error":   fmt.Sprintf("repository %s is no longer configured", previous.Repository),
+			"message": server.StatusCodeText[server.StatusBadRequest],
+		})
+		return
+	}
+
+	logrus.Infof("Promotion of %s from %s to %s requested by %s", id, previous.Environment, target, user)
+	rc.start(ctx, git.RunRequest{
+		Repo:         repo,
+		Ref:          previous.Ref,
+		SHA:          previous.Commit,
+		Trigger:      git.TriggerPromote,
+		Env:          previous.Env,
+		TriggeredBy:  user,
+		Environment:  target,
+		PromotedFrom: id,
+	})
+}
+
+// promotable reports whether target is a configured environment after from
+func (rc *RunsController) promotable(from, target string) bool {
+	fromIndex, targetIndex := -1, -1
+	for i, env := range rc.cfg.Environments {
+		switch env.Name {
+		case from:
+			fromIndex = i
+		case target:
+			targetIndex = i
+		}
+	}
+	return fromIndex >= 0 && targetIndex > fromIndex
+}
+
+// ApproveRun handles POST /runs/:id/approve, letting a run waiting for
+// approval deploy to its protected environment
+func (rc *RunsController) ApproveRun(ctx *server.HttpContext) {
+	user := ctx.GetString(server.ContextKeyUser)
+
+	id, err := ctx.Param("id")
+	if err != nil {
+		ctx.JSON(server.StatusBadRequest, server.Generalesponse{
+			"error":   server.ResponseMessage["invalid_id"],
+			"message": server.StatusCodeText[server.StatusBadRequest],
+		})
+		return
+	}
+	if _, found := status.Get(id); !found {
+		ctx.JSON(server.StatusNotFound, server.Generalesponse{
+			"error":   fmt.Sprintf("run %s not found", id),
+			"message": server.StatusCodeText[server.StatusNotFound],
+		})
+		return
+	}
+	if err := git.ApproveRun(id, user); err != nil {
+		code := server.StatusConflict
+		if errors.Is(err, git.ErrNotApprover) {
+			code = server.StatusForbidden
+		}
+		ctx.JSON(code, server.Generalesponse{
+			"error":   err.Error(),
+			"message": server.StatusCodeText[code],
+		})
+		return
+	}
+
+	logrus.Infof("Run %s approved by %s", id, user)
+	ctx.JSON(server.StatusOK, server.Generalesponse{
+		"id":      id,
+		"message": fmt.Sprintf("Pipeline %s approved, deploying", id),
+	})
+}
+
+// CancelRun handles POST /runs/:id/cancel
+func (rc *RunsController) CancelRun(ctx *server.HttpContext) {
+	user := ctx.GetString(server.ContextKeyUser)
+
+	id, err := ctx.Param("id")
+	if err != nil {
+		ctx.JSON(server.StatusBadRequest, server.Generalesponse{
+			"error":   server.ResponseMessage["invalid_id"],
+			"message": server.StatusCodeText[server.StatusBadRequest],
+		})
+		return
+	}
+	if _, found := status.Get(id); !found {
+		ctx.JSON(server.StatusNotFound, server.Generalesponse{
+			"error":   fmt.Sprintf("run %s not found", id),
+			"message": server.StatusCodeText[server.StatusNotFound],
+		})
+		return
+	}
+	if err := git.CancelRun(id, user); err != nil {
+		ctx.JSON(server.StatusBadRequest, server.Generalesponse{
+			"error":   err.Error(),
+			"message": server.StatusCodeText[server.StatusBadRequest],
+		})
+		return
+	}
+
+	logrus.Infof("Run %s cancelled by %s", id, user)
+	ctx.JSON(server.StatusOK, server.Generalesponse{
+		"id":      id,
+		"message": fmt.Sprintf("Pipeline %s cancelling", id),
+	})
+}
+
+func (rc *RunsController) start(ctx *server.HttpContext, req git.RunRequest) {
+	runID, err := git.StartPipeline(rc.cfg, req)
+	if errors.Is(err, git.ErrRefNotFound) {
+		ctx.JSON(server.StatusNotFound, server.Generalesponse{
+			"error":   err.Error(),
+			"id":      runID,
+			"message": server.StatusCodeText[server.StatusNotFound],
+		})
+		return
+	}
+	if err != nil {
+		ctx.JSON(server.StatusInternalServerError, server.Generalesponse{
+			"error":   fmt.Sprintf("Clone failed: %v", err),
+			"message": server.StatusCodeText[server.StatusInternalServerError],
+		})
+		return
+	}
+	ctx.JSON(server.StatusOK, server.Generalesponse{
+		"id":      runID,
+		"message": fmt.Sprintf("Pipeline %s started", runID),
+	})
+}
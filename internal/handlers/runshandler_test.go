@@ -0,0 +1,67 @@
+package handlers
+
+import (
+	"net/http/cgi"
+	"net/http/httptest"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/khaledibrahim1015/goFlow-cicd/internal/config"
+	"github.com/khaledibrahim1015/goFlow-cicd/internal/server"
+)
+
+// gitHTTPServer serves a repository with one commit on main over smart HTTP
+// and returns its url
+func gitHTTPServer(t *testing.T) string {
+	t.Helper()
+	root := t.TempDir()
+	work := filepath.Join(root, "work")
+	for _, args := range [][]string{
+		{"init", "-q", "-b", "main", work},
+		{"-C", work, "-c", "user.name=dev", "-c", "user.email=dev@example.com", "commit", "-q", "--allow-empty", "-m", "initial"},
+		{"clone", "-q", "--bare", work, filepath.Join(root, "app.git")},
+	} {
+		if output, err := exec.Command("git", args...).CombinedOutput(); err != nil {
+			t.Fatalf("git %v: %v\n%s", args, err, output)
+		}
+	}
+	execPath, err := exec.Command("git", "--exec-path").Output()
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv := httptest.NewServer(&cgi.Handler{
+		Path: filepath.Join(strings.TrimSpace(string(execPath)), "git-http-backend"),
+		Env:  []string{"GIT_PROJECT_ROOT=" + root, "GIT_HTTP_EXPORT_ALL=1"},
+	})
+	t.Cleanup(srv.Close)
+	return srv.URL + "/app.git"
+}
+
+func TestTriggerRunRejectsBadRequests(t *testing.T) {
+	repoURL := gitHTTPServer(t)
+	t.Setenv("GIT_TERMINAL_PROMPT", "0")
+	cfg := &config.PipelineConfig{Repositories: []config.RepositoryConfig{{URL: repoURL, Branch: "main"}}}
+	r := server.NewRouter()
+	r.POST("/runs", NewRunsController(cfg).TriggerRun)
+
+	cases := []struct {
+		name, body string
+		code       int
+		error      string
+	}{
+		{"option as sha", `{"sha": "--upload-pack=touch /tmp/pwned"}`, server.StatusBadRequest, "invalid sha"},
+		{"short sha", `{"sha": "abc12"}`, server.StatusBadRequest, "invalid sha"},
+		{"option as ref", `{"ref": "--upload-pack=touch /tmp/pwned"}`, server.StatusBadRequest, "invalid ref"},
+		{"unknown repository", `{"repository": "https://example.com/other.git"}`, server.StatusBadRequest, "unknown repository"},
+		{"unknown ref", `{"ref": "does-not-exist"}`, server.StatusNotFound, "ref not found"},
+	}
+	for _, c := range cases {
+		rec := httptest.NewRecorder()
+		r.ServeHTTP(rec, httptest.NewRequest("POST", "/runs", strings.NewReader(c.body)))
+		if rec.Code != c.code || !strings.Contains(rec.Body.String(), c.error) {
+			t.Errorf("%s: code = %d, body = %s", c.name, rec.Code, rec.Body.String())
+		}
+	}
+}
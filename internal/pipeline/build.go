@@ -1,6 +1,7 @@
 package pipeline
 
 import (
+	"context"
 	"fmt"
 	"os"
 	"os/exec"
@@ -16,7 +17,7 @@ const (
 	java   = "java"
 )
 
-func (p *Pipeline) build() error {
+func (p *Pipeline) build(ctx context.Context) error {
 	logrus.Info("Building project with Docker-like behavior...")
 
 	// Define a fixed output directory for .NET (mimics Docker's /app/build or /app/publish)
@@ -37,15 +38,15 @@ func (p *Pipeline) build() error {
 			return fmt.Errorf("failed to locate .NET project file: %v", err)
 		}
 		restoreCmdFunc = func() *exec.Cmd {
-			cmd := exec.Command("dotnet", "restore", buildFile)
-			cmd.Env = os.Environ()
+			cmd := executor.CommandContext(ctx, "dotnet", "restore", buildFile)
+			cmd.Env = p.environ()
 			cmd.Dir = p.repoPath
 			return cmd
 		}
 		// Mimic Docker's dotnet publish -o
 		buildCmdFunc = func() *exec.Cmd {
-			cmd := exec.Command("dotnet", "publish", buildFile, "-c", "Release", "-o", buildOutputDir, "/p:UseAppHost=false")
-			cmd.Env = os.Environ()
+			cmd := executor.CommandContext(ctx, "dotnet", "publish", buildFile, "-c", "Release", "-o", buildOutputDir, "/p:UseAppHost=false")
+			cmd.Env = p.environ()
 			cmd.Dir = p.repoPath
 			return cmd
 		}
@@ -57,8 +58,8 @@ func (p *Pipeline) build() error {
 		}
 		// Mimic Docker's mvn clean package
 		buildCmdFunc = func() *exec.Cmd {
-			cmd := exec.Command("mvn", "clean", "package", "-f", buildFile)
-			cmd.Env = os.Environ()
+			cmd := executor.CommandContext(ctx, "mvn", "clean", "package", "-f", buildFile)
+			cmd.Env = p.environ()
 			cmd.Dir = p.repoPath
 			return cmd
 		}
@@ -70,6 +71,9 @@ func (p *Pipeline) build() error {
 	// Restore for dotnet only
 	if p.cfg.Build.Type == dotnet {
 		for attempt := 1; attempt <= 3; attempt++ {
+			if err := ctx.Err(); err != nil {
+				return err
+			}
 			cmd := restoreCmdFunc()
 			output, err := executor.RunWithOutput(cmd)
 			if err == nil {
@@ -85,6 +89,9 @@ func (p *Pipeline) build() error {
 
 	// Build (or publish for dotnet)
 	for attempt := 1; attempt <= 3; attempt++ {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
 		cmd := buildCmdFunc()
 		output, err := executor.RunWithOutput(cmd)
 		if err == nil {
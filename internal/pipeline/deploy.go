@@ -1,48 +1,87 @@
 package pipeline
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"os"
-	"os/exec"
-	"path/filepath"
+	"slices"
 	"strings"
+	"sync"
+	"time"
 
+	"github.com/khaledibrahim1015/goFlow-cicd/internal/config"
+	"github.com/khaledibrahim1015/goFlow-cicd/internal/deployments"
 	"github.com/khaledibrahim1015/goFlow-cicd/pkg/executor"
 	"github.com/sirupsen/logrus"
 )
 
-func (p *Pipeline) deploy() error {
+func (p *Pipeline) deploy(ctx context.Context) error {
 	if p.cfg.Deploy.Method == "" {
 		logrus.Info("No deployment configured, skipping")
 		return nil
 	}
+	if p.gate != nil {
+		if err := p.gate(ctx); errors.Is(err, ErrDeploySkipped) {
+			logrus.Infof("Not deploying: %v", err)
+			return nil
+		} else if err != nil {
+			return fmt.Errorf("deploy blocked: %v", err)
+		}
+	}
 	logrus.Info("Deploying...")
+	p.SetEnv(p.secrets)
 
+	var deployFn func(context.Context) error
 	switch p.cfg.Deploy.Method {
 	case "ssh":
-		if err := p.deploySSH(); err != nil {
-			logrus.Errorf("SSH deployment failed: %v", err)
-			logrus.Info("Executing rollback...")
-			if rollbackErr := p.executeRollback(); rollbackErr != nil {
-				logrus.Errorf("Rollback failed: %v", rollbackErr)
-			}
-			return fmt.Errorf("deployment failed: %v", err)
-		}
+		deployFn = p.deploySSH
+	case "docker":
+		deployFn = p.deployDocker
+	case "kubernetes", "k8s":
+		deployFn = p.deployKubernetes
+	case "local":
+		deployFn = p.deployLocal
+	case "http_upload":
+		deployFn = p.deployHTTPUpload
 	default:
 		return fmt.Errorf("unsupported deploy method: %s", p.cfg.Deploy.Method)
 	}
+	p.deployment = &deployments.Deployment{Method: p.cfg.Deploy.Method, Ref: p.ref}
+	p.recordRevision(ctx)
+	err := deployFn(ctx)
+	if err == nil && p.cfg.Deploy.Method != "ssh" {
+		// ssh deploys check each host as soon as it is updated
+		err = p.healthCheck(ctx, nil)
+	}
+	p.deployment.Commit = p.commit
+	p.deployment.DeployedAt = time.Now().UTC()
+	if err != nil {
+		p.deployment.Status = "failed"
+		p.deployment.Error = err.Error()
+		logrus.Errorf("%s deployment failed: %v", p.cfg.Deploy.Method, err)
+		logrus.Info("Executing rollback...")
+		// Roll back even when the run was cancelled mid-deploy
+		if rollbackErr := p.executeRollback(context.WithoutCancel(ctx)); rollbackErr != nil {
+			logrus.Errorf("Rollback failed: %v", rollbackErr)
+			return fmt.Errorf("deployment failed: %v; rollback failed: %v", err, rollbackErr)
+		}
+		return fmt.Errorf("deployment failed: %v", err)
+	}
+	p.deployment.Status = "deployed"
 	logrus.Info("Deploy stage completed successfully")
 	return nil
 }
 
-func (p *Pipeline) deploySSH() error {
+func (p *Pipeline) deploySSH(ctx context.Context) error {
 	sshConfig := p.cfg.Deploy.SSH
 	if sshConfig == nil {
 		return fmt.Errorf("SSH config missing")
 	}
+	hosts := sshConfig.Targets()
 
 	// Validate required SSH configuration fields
-	if sshConfig.RemoteUser == "" || sshConfig.RemoteHost == "" || sshConfig.RemotePath == "" || sshConfig.KeyPath == "" {
+	if sshConfig.RemoteUser == "" || len(hosts) == 0 || sshConfig.RemotePath == "" {
 		return fmt.Errorf("incomplete SSH configuration")
 	}
 
@@ -51,90 +90,213 @@ func (p *Pipeline) deploySSH() error {
 	if _, err := os.Stat(srcDir); os.IsNotExist(err) {
 		return fmt.Errorf("build artifacts not found at %s", srcDir)
 	}
-
-	// Construct rsync command with SSH
-	rsyncCmd := []string{
-		"rsync",
-		"-e", fmt.Sprintf("ssh -i %s -o StrictHostKeyChecking=no", sshConfig.KeyPath), // Use SSH with the key
-		"-avz", // Archive mode, verbose, compress
+	p.deployment.Path = sshConfig.RemotePath
+	p.deployment.Hosts = make([]deployments.Host, len(hosts))
+	for i, host := range hosts {
+		p.deployment.Hosts[i] = deployments.Host{Host: host, Status: "pending"}
 	}
-	logrus.Infof("COMMAND : %v", strings.Join(rsyncCmd, " "))
+	p.updateHosts(func(*deployments.Host) {}) // report the pending hosts
 
-	// Add custom rsync options if specified
-	if sshConfig.RsyncOptions != "" {
-		rsyncCmd = append(rsyncCmd, strings.Split(sshConfig.RsyncOptions, " ")...)
+	// Release names carry the commit; resolve it before hosts deploy in parallel
+	if sshConfig.KeepReleases > 0 {
+		if _, err := p.resolveCommit(); err != nil {
+			return err
+		}
+	}
+	if err := p.rollOut(ctx, sshConfig, srcDir, hosts); err != nil {
+		p.updateHosts(func(h *deployments.Host) {
+			if h.Status == "pending" {
+				h.Status = "skipped"
+			}
+		})
+		return err
 	}
 
-	// Add source and destination paths
-	sourcePath := srcDir
-	if !strings.HasSuffix(sourcePath, "/") {
-		sourcePath += "/"
+	if sshConfig.KeepReleases > 0 {
+		for _, host := range hosts {
+			if err := pruneReleases(ctx, hostConfig(sshConfig, host)); err != nil {
+				logrus.Warnf("Failed to remove old releases on %s: %v", host, err)
+			}
+		}
 	}
-	rsyncCmd = append(rsyncCmd,
-		sourcePath, // Source directory (build output)
-		fmt.Sprintf("%s@%s:%s", sshConfig.RemoteUser, sshConfig.RemoteHost, sshConfig.RemotePath), // Destination
-	)
+	logrus.Infof("SSH deployment to %d host(s) successful", len(hosts))
+	return nil
+}
 
-	// Execute rsync command
-	cmd := exec.Command(rsyncCmd[0], rsyncCmd[1:]...)
-	cmd.Dir = filepath.Dir(sourcePath)
+// rollOut updates the hosts batch by batch, stopping at the first failure
+func (p *Pipeline) rollOut(ctx context.Context, sshConfig *config.SSHConfig, srcDir string, hosts []string) error {
+	batchSize, pause := rollingBatch(sshConfig.Rolling)
+	for start := 0; start < len(hosts); start += batchSize {
+		if start > 0 && pause > 0 {
+			logrus.Infof("Pausing %s before the next batch", pause)
+			select {
+			case <-ctx.Done():
+				return ctx.Err()
+			case <-time.After(pause):
+			}
+		}
+		batch := hosts[start:min(start+batchSize, len(hosts))]
+		logrus.Infof("Deploying to %s", strings.Join(batch, ", "))
 
-	output, err := executor.RunWithOutput(cmd)
-	if err != nil {
-		logrus.Errorf("Deploy failed: %v\nOutput: %s", err, output)
-		return fmt.Errorf("rsync failed: %v", err)
+		errs := make([]error, len(batch))
+		var wg sync.WaitGroup
+		for i, host := range batch {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				errs[i] = p.deployHost(ctx, hostConfig(sshConfig, host), srcDir)
+			}()
+		}
+		wg.Wait()
+		for i, err := range errs {
+			if err != nil {
+				return fmt.Errorf("deploy to %s failed: %v", batch[i], err)
+			}
+		}
 	}
+	return nil
+}
 
-	logrus.Info("Deploy succeeded")
-	logrus.Debugf("Deploy output: %s", output)
+// deployHost uploads the build to one host, then runs the post-deploy
+// commands and the health check there
+func (p *Pipeline) deployHost(ctx context.Context, sshConfig *config.SSHConfig, srcDir string) error {
+	host := sshConfig.RemoteHost
+	p.updateHost(host, func(h *deployments.Host) { h.Status = "deploying" })
+	remote, err := dialHost(ctx, sshConfig)
+	if err == nil {
+		err = p.deployToHost(ctx, remote, srcDir)
+		remote.Close()
+	}
+	p.updateHost(host, func(h *deployments.Host) {
+		if err != nil {
+			h.Status = "failed"
+			h.Error = err.Error()
+			return
+		}
+		h.Status = "deployed"
+	})
+	return err
+}
+
+func (p *Pipeline) deployToHost(ctx context.Context, remote *remoteHost, srcDir string) error {
+	if remote.cfg.KeepReleases > 0 {
+		if err := p.deployRelease(ctx, remote, srcDir); err != nil {
+			return err
+		}
+	} else if err := remote.sync(ctx, srcDir, remote.cfg.RemotePath, ""); err != nil {
+		return err
+	}
+	logrus.Infof("Deploy to %s succeeded", remote.name())
 
 	// Execute post-deployment commands (including running the application)
-	if len(p.cfg.Deploy.PostDeployCmds) > 0 {
-		for _, postCmd := range p.cfg.Deploy.PostDeployCmds {
-			sshCmd := fmt.Sprintf("ssh -i %s -o StrictHostKeyChecking=no %s@%s %s", sshConfig.KeyPath, sshConfig.RemoteUser, sshConfig.RemoteHost, postCmd)
-			cmd = exec.Command("sh", "-c", sshCmd)
-			output, err := executor.RunWithOutput(cmd)
-			if err != nil {
-				logrus.Errorf("Post-deploy command '%s' failed: %v\nOutput: %s", postCmd, err, output)
-				return fmt.Errorf("post-deploy command '%s' failed: %v", postCmd, err)
-			}
-			logrus.Infof("Executed post-deploy command: %s", postCmd)
-			logrus.Debugf("Post-deploy output: %s", output)
+	for _, postCmd := range p.cfg.Deploy.PostDeployCmds {
+		output, err := remote.Run(ctx, postCmd)
+		if err != nil {
+			logrus.Errorf("Post-deploy command '%s' on %s failed: %v\nOutput: %s", postCmd, remote.name(), err, output)
+			return fmt.Errorf("post-deploy command '%s' failed: %v", postCmd, err)
 		}
+		logrus.Infof("Executed post-deploy command on %s: %s", remote.name(), postCmd)
+		logrus.Debugf("Post-deploy output: %s", output)
 	}
+	return p.healthCheck(ctx, remote)
+}
 
-	logrus.Info("SSH deployment successful")
-	return nil
+// hostConfig returns sshConfig aimed at one of its hosts
+func hostConfig(sshConfig *config.SSHConfig, host string) *config.SSHConfig {
+	hostCfg := *sshConfig
+	hostCfg.RemoteHost = host
+	return &hostCfg
 }
 
-func (p *Pipeline) executeRollback() error {
-	sshConfig := p.cfg.Deploy.SSH
-	if sshConfig == nil {
-		return fmt.Errorf("SSH config missing for rollback")
+// rollingBatch returns how many hosts to update at once and the pause between batches
+func rollingBatch(rolling *config.RollingConfig) (int, time.Duration) {
+	if rolling == nil {
+		return 1, 0
 	}
+	size := rolling.BatchSize
+	if size == 0 {
+		size = rolling.MaxUnavailable
+	}
+	if rolling.MaxUnavailable > 0 {
+		size = min(size, rolling.MaxUnavailable)
+	}
+	return max(size, 1), parseDurationOr(rolling.Pause, 0)
+}
+
+// updateHosts applies update to the host records and reports them to the run status
+func (p *Pipeline) updateHosts(update func(h *deployments.Host)) {
+	p.hostsMu.Lock()
+	defer p.hostsMu.Unlock()
+	for i := range p.deployment.Hosts {
+		update(&p.deployment.Hosts[i])
+	}
+	if p.hostReporter != nil {
+		p.hostReporter(slices.Clone(p.deployment.Hosts))
+	}
+}
 
+// updateHost applies update to the record of one host
+func (p *Pipeline) updateHost(host string, update func(h *deployments.Host)) {
+	p.updateHosts(func(h *deployments.Host) {
+		if h.Host == host {
+			update(h)
+		}
+	})
+}
+
+func (p *Pipeline) executeRollback(ctx context.Context) error {
 	// If a rollback script is specified, execute it locally
 	if p.cfg.Deploy.RollbackScript != "" {
-		cmd := exec.Command("bash", p.cfg.Deploy.RollbackScript)
-		cmd.Env = os.Environ()
+		updated := p.updatedHosts()
+		cmd := executor.CommandContext(ctx, "bash", p.cfg.Deploy.RollbackScript)
+		cmd.Env = append(p.environ(), "GOFLOW_UPDATED_HOSTS="+strings.Join(updated, ","))
 		cmd.Dir = p.repoPath
 		output, err := executor.RunWithOutput(cmd)
 		if err != nil {
 			return fmt.Errorf("rollback script failed: %v\nOutput: %s", err, output)
 		}
 		logrus.Info("Rollback script executed successfully")
+		for _, host := range updated {
+			p.updateHost(host, func(h *deployments.Host) { h.Status = "rolled_back" })
+		}
 		logrus.Debugf("Rollback output: %s", output)
 		return nil
 	}
 
-	// Default rollback: remove deployed files on the remote server
-	rollbackCmd := fmt.Sprintf("ssh -i %s -o StrictHostKeyChecking=no %s@%s 'rm -rf %s/*'", sshConfig.KeyPath, sshConfig.RemoteUser, sshConfig.RemoteHost, sshConfig.RemotePath)
-	cmd := exec.Command("sh", "-c", rollbackCmd)
-	output, err := executor.RunWithOutput(cmd)
-	if err != nil {
-		return fmt.Errorf("remote file removal failed: %v\nOutput: %s", err, output)
+	// Default rollback: switch back to the previous release of the releases layout
+	sshConfig := p.cfg.Deploy.SSH
+	if p.cfg.Deploy.Method == "ssh" && sshConfig != nil && sshConfig.KeepReleases > 0 && p.deployment != nil {
+		return p.rollbackReleases(ctx, sshConfig)
+	}
+	// or to the directory a local deploy replaced
+	if p.cfg.Deploy.Method == "local" && p.replaced != "" {
+		return p.rollbackLocal()
+	}
+	// or undo the workloads a Kubernetes deploy configured
+	if p.cfg.Deploy.Kubernetes != nil && len(p.configured) > 0 {
+		p.rollbackKubernetes(ctx)
+		return nil
 	}
-	logrus.Info("Remote files removed successfully during rollback")
-	logrus.Debugf("Rollback output: %s", output)
+	// ssh hosts synced in place keep the new build, say which ones
+	if updated := p.updatedHosts(); p.cfg.Deploy.Method == "ssh" && len(updated) > 0 {
+		return fmt.Errorf("no rollback_script configured and no previous release kept, %s stayed on the new build", strings.Join(updated, ", "))
+	}
+	logrus.Warnf("No rollback_script configured and no previous release kept, nothing to roll back for %s deployments", p.cfg.Deploy.Method)
 	return nil
 }
+
+// updatedHosts returns the hosts the deploy changed, deployed or failed half-way
+func (p *Pipeline) updatedHosts() []string {
+	if p.deployment == nil {
+		return nil
+	}
+	p.hostsMu.Lock()
+	defer p.hostsMu.Unlock()
+	var hosts []string
+	for _, h := range p.deployment.Hosts {
+		if h.Status == "deployed" || h.Status == "failed" {
+			hosts = append(hosts, h.Host)
+		}
+	}
+	return hosts
+}
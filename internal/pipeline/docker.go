@@ -0,0 +1,266 @@
+package pipeline
+
+import (
+	"context"
+	"fmt"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/khaledibrahim1015/goFlow-cicd/internal/config"
+	"github.com/khaledibrahim1015/goFlow-cicd/pkg/executor"
+	"github.com/sirupsen/logrus"
+)
+
+// ContainerCLI runs the container engine commands of Docker deploys. The
+// default implementation shells out to docker (or podman), tests fake it.
+type ContainerCLI interface {
+	Build(ctx context.Context, build ImageBuild) error
+	Login(ctx context.Context, registry, username, password string) error
+	Push(ctx context.Context, image string) error
+	ComposeUp(ctx context.Context, dir, composeFile string, env []string) error
+}
+
+// ImageBuild describes a "docker build" of the checkout
+type ImageBuild struct {
+	Dir        string // repository checkout, the paths below are relative to it
+	Dockerfile string
+	Context    string
+	Tags       []string // full references, e.g. "registry.example.com/api:1a2b3c4d5e6f"
+	BuildArgs  map[string]string
+	Env        []string
+}
+
+// deployDocker builds the image, pushes it with every tag and, when a compose
+// file is configured, brings the services up with the new image
+func (p *Pipeline) deployDocker(ctx context.Context) error {
+	dockerCfg := p.cfg.Deploy.Docker
+	if dockerCfg == nil {
+		return fmt.Errorf("docker config missing")
+	}
+	images, tags, err := p.buildImage(ctx, dockerCfg)
+	if err != nil {
+		return err
+	}
+
+	// The commit tag is the first one, compose files refer to it as ${GOFLOW_IMAGE}
+	deployEnv := append(p.environ(), "GOFLOW_IMAGE="+images[0], "GOFLOW_IMAGE_TAG="+tags[0])
+	if dockerCfg.ComposeFile != "" {
+		if err := p.containerCLI(dockerCfg).ComposeUp(ctx, p.repoPath, dockerCfg.ComposeFile, deployEnv); err != nil {
+			return fmt.Errorf("compose up failed: %v", err)
+		}
+		logrus.Infof("Started services from %s with %s", dockerCfg.ComposeFile, images[0])
+	}
+
+	// Post-deployment commands run on this host, next to the container engine
+	if err := p.runLocalPostDeploy(ctx, deployEnv); err != nil {
+		return err
+	}
+
+	logrus.Info("Docker deployment successful")
+	return nil
+}
+
+// runLocalPostDeploy runs the post-deploy commands on this host, in the checkout
+func (p *Pipeline) runLocalPostDeploy(ctx context.Context, env []string) error {
+	for _, postCmd := range p.cfg.Deploy.PostDeployCmds {
+		cmd := executor.CommandContext(ctx, "sh", "-c", postCmd)
+		cmd.Env = env
+		cmd.Dir = p.repoPath
+		output, err := executor.RunWithOutput(cmd)
+		if err != nil {
+			logrus.Errorf("Post-deploy command '%s' failed: %v\nOutput: %s", postCmd, err, output)
+			return fmt.Errorf("post-deploy command '%s' failed: %v", postCmd, err)
+		}
+		logrus.Infof("Executed post-deploy command: %s", postCmd)
+		logrus.Debugf("Post-deploy output: %s", output)
+	}
+	return nil
+}
+
+// buildImage builds the image and, unless skip_push is set, pushes every tag.
+// The first image returned is the one tagged with the commit.
+func (p *Pipeline) buildImage(ctx context.Context, dockerCfg *config.DockerConfig) ([]string, []string, error) {
+	cli := p.containerCLI(dockerCfg)
+	commit, err := p.resolveCommit()
+	if err != nil {
+		return nil, nil, err
+	}
+	repository, imageTag := imageRepository(dockerCfg.Image, dockerCfg.Registry)
+	tags := imageTags(p.ref, commit, append([]string{imageTag}, dockerCfg.Tags...))
+	images := make([]string, len(tags))
+	for i, tag := range tags {
+		images[i] = repository + ":" + tag
+	}
+
+	buildArgs := map[string]string{"GIT_COMMIT": commit, "GIT_REF": p.ref}
+	for key, value := range dockerCfg.BuildArgs {
+		buildArgs[key] = value
+	}
+	logrus.Infof("Building image %s", strings.Join(images, ", "))
+	if err := cli.Build(ctx, ImageBuild{
+		Dir:        p.repoPath,
+		Dockerfile: valueOr(dockerCfg.Dockerfile, "Dockerfile"),
+		Context:    valueOr(dockerCfg.Context, "."),
+		Tags:       images,
+		BuildArgs:  buildArgs,
+		Env:        p.environ(),
+	}); err != nil {
+		return nil, nil, fmt.Errorf("image build failed: %v", err)
+	}
+
+	if !dockerCfg.SkipPush {
+		if dockerCfg.Username != "" {
+			if err := cli.Login(ctx, dockerCfg.Registry, dockerCfg.Username, dockerCfg.Password); err != nil {
+				return nil, nil, fmt.Errorf("registry login failed: %v", err)
+			}
+		}
+		for _, image := range images {
+			if err := cli.Push(ctx, image); err != nil {
+				return nil, nil, fmt.Errorf("push of %s failed: %v", image, err)
+			}
+			logrus.Infof("Pushed %s", image)
+		}
+	}
+	return images, tags, nil
+}
+
+// containerCLI returns the CLI set by tests, or the configured one
+func (p *Pipeline) containerCLI(dockerCfg *config.DockerConfig) ContainerCLI {
+	if p.containers != nil {
+		return p.containers
+	}
+	return newDockerCLI(dockerCfg.CLI)
+}
+
+// resolveCommit returns the commit being built, asking git when the trigger did not say
+func (p *Pipeline) resolveCommit() (string, error) {
+	if p.commit != "" {
+		return p.commit, nil
+	}
+	cmd := exec.Command("git", "rev-parse", "HEAD")
+	cmd.Dir = p.repoPath
+	output, err := executor.RunWithOutput(cmd)
+	if err != nil {
+		return "", fmt.Errorf("failed to resolve commit: %v\nOutput: %s", err, output)
+	}
+	p.commit = strings.TrimSpace(output)
+	return p.commit, nil
+}
+
+// imageRepository returns the image name with the registry prefix, and the tag
+// written in the configured image if any ("api:stable" -> "api", "stable")
+func imageRepository(image, registry string) (string, string) {
+	repository, tag := image, ""
+	if i := strings.LastIndex(repository, ":"); i > strings.LastIndex(repository, "/") {
+		repository, tag = repository[:i], repository[i+1:]
+	}
+	registry = strings.TrimSuffix(registry, "/")
+	if registry != "" && !strings.HasPrefix(repository, registry+"/") {
+		repository = registry + "/" + repository
+	}
+	return repository, tag
+}
+
+var invalidTagChars = regexp.MustCompile(`[^A-Za-z0-9_.-]`)
+
+// imageTags derives the tags of a build: the short commit first, then the
+// branch or tag name of ref, then the extra tags, without duplicates
+func imageTags(ref, commit string, extra []string) []string {
+	candidates := []string{}
+	if commit != "" {
+		candidates = append(candidates, commit[:min(len(commit), 12)])
+	}
+	for _, prefix := range []string{"refs/heads/", "refs/tags/"} {
+		if name, ok := strings.CutPrefix(ref, prefix); ok {
+			candidates = append(candidates, name)
+		}
+	}
+	candidates = append(candidates, extra...)
+
+	seen := map[string]bool{}
+	tags := []string{}
+	for _, candidate := range candidates {
+		tag := strings.TrimLeft(invalidTagChars.ReplaceAllString(candidate, "-"), ".-")
+		if len(tag) > 128 {
+			tag = tag[:128]
+		}
+		if tag == "" || seen[tag] {
+			continue
+		}
+		seen[tag] = true
+		tags = append(tags, tag)
+	}
+	if len(tags) == 0 {
+		tags = append(tags, "latest")
+	}
+	return tags
+}
+
+func valueOr(value, fallback string) string {
+	if value == "" {
+		return fallback
+	}
+	return value
+}
+
+// dockerCLI runs the docker (or a compatible, e.g. podman) command line
+type dockerCLI struct {
+	binary string
+}
+
+func newDockerCLI(binary string) *dockerCLI {
+	return &dockerCLI{binary: valueOr(binary, "docker")}
+}
+
+func (d *dockerCLI) run(ctx context.Context, dir string, env []string, stdin string, args ...string) error {
+	cmd := executor.CommandContext(ctx, d.binary, args...)
+	cmd.Dir = dir
+	cmd.Env = env
+	if stdin != "" {
+		cmd.Stdin = strings.NewReader(stdin)
+	}
+	logrus.Infof("COMMAND : %s %s", d.binary, strings.Join(args, " "))
+	output, err := executor.RunWithOutput(cmd)
+	if err != nil {
+		return fmt.Errorf("%s %s failed: %v\nOutput: %s", d.binary, args[0], err, output)
+	}
+	logrus.Debugf("%s %s output: %s", d.binary, args[0], output)
+	return nil
+}
+
+func (d *dockerCLI) Build(ctx context.Context, build ImageBuild) error {
+	args := []string{"build", "-f", filepath.Join(build.Dir, build.Dockerfile)}
+	for _, tag := range build.Tags {
+		args = append(args, "-t", tag)
+	}
+	keys := make([]string, 0, len(build.BuildArgs))
+	for key := range build.BuildArgs {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		args = append(args, "--build-arg", key+"="+build.BuildArgs[key])
+	}
+	args = append(args, filepath.Join(build.Dir, build.Context))
+	return d.run(ctx, build.Dir, build.Env, "", args...)
+}
+
+// Login passes the password on stdin so it never shows up in process listings or logs
+func (d *dockerCLI) Login(ctx context.Context, registry, username, password string) error {
+	args := []string{"login", "--username", username, "--password-stdin"}
+	if registry != "" {
+		args = append(args, registry)
+	}
+	return d.run(ctx, "", nil, password, args...)
+}
+
+func (d *dockerCLI) Push(ctx context.Context, image string) error {
+	return d.run(ctx, "", nil, "", "push", image)
+}
+
+func (d *dockerCLI) ComposeUp(ctx context.Context, dir, composeFile string, env []string) error {
+	return d.run(ctx, dir, env, "", "compose", "-f", composeFile, "up", "-d")
+}
@@ -0,0 +1,129 @@
+package pipeline
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/khaledibrahim1015/goFlow-cicd/internal/config"
+)
+
+// fakeContainerCLI records the container commands instead of running them
+type fakeContainerCLI struct {
+	calls  []string
+	builds []ImageBuild
+	env    []string
+	failOn string
+	logins []string
+}
+
+func (f *fakeContainerCLI) record(call string) error {
+	f.calls = append(f.calls, call)
+	if f.failOn != "" && strings.HasPrefix(call, f.failOn) {
+		return errors.New("boom")
+	}
+	return nil
+}
+
+func (f *fakeContainerCLI) Build(_ context.Context, build ImageBuild) error {
+	f.builds = append(f.builds, build)
+	return f.record("build")
+}
+
+func (f *fakeContainerCLI) Login(_ context.Context, registry, username, password string) error {
+	f.logins = append(f.logins, registry+" "+username+" "+password)
+	return f.record("login")
+}
+
+func (f *fakeContainerCLI) Push(_ context.Context, image string) error {
+	return f.record("push " + image)
+}
+
+func (f *fakeContainerCLI) ComposeUp(_ context.Context, dir, composeFile string, env []string) error {
+	f.env = env
+	return f.record("compose " + composeFile)
+}
+
+func dockerPipeline(dockerCfg *config.DockerConfig, cli ContainerCLI) *Pipeline {
+	p := New(&config.PipelineConfig{Deploy: config.DeployConfig{Method: "docker", Docker: dockerCfg}}, "/tmp/checkout")
+	p.SetRevision("refs/heads/feature/login", "0123456789abcdef0123")
+	p.containers = cli
+	return p
+}
+
+func TestDeployDocker(t *testing.T) {
+	cli := &fakeContainerCLI{}
+	p := dockerPipeline(&config.DockerConfig{
+		Image:       "team/api:stable",
+		Registry:    "registry.example.com",
+		Username:    "ci",
+		Password:    "secret",
+		ComposeFile: "docker-compose.prod.yml",
+		BuildArgs:   map[string]string{"VERSION": "1.2"},
+	}, cli)
+
+	if err := p.deployDocker(context.Background()); err != nil {
+		t.Fatalf("deployDocker: %v", err)
+	}
+
+	wantImages := []string{
+		"registry.example.com/team/api:0123456789ab",
+		"registry.example.com/team/api:feature-login",
+		"registry.example.com/team/api:stable",
+	}
+	build := cli.builds[0]
+	if !reflect.DeepEqual(build.Tags, wantImages) {
+		t.Errorf("tags = %v", build.Tags)
+	}
+	if build.Dockerfile != "Dockerfile" || build.Context != "." || build.Dir != "/tmp/checkout" {
+		t.Errorf("build = %+v", build)
+	}
+	if build.BuildArgs["GIT_COMMIT"] != "0123456789abcdef0123" || build.BuildArgs["VERSION"] != "1.2" {
+		t.Errorf("build args = %v", build.BuildArgs)
+	}
+	wantCalls := []string{"build", "login"}
+	for _, image := range wantImages {
+		wantCalls = append(wantCalls, "push "+image)
+	}
+	wantCalls = append(wantCalls, "compose docker-compose.prod.yml")
+	if !reflect.DeepEqual(cli.calls, wantCalls) {
+		t.Errorf("calls = %v", cli.calls)
+	}
+	if cli.logins[0] != "registry.example.com ci secret" {
+		t.Errorf("login = %q", cli.logins[0])
+	}
+	if !contains(cli.env, "GOFLOW_IMAGE="+wantImages[0]) {
+		t.Error("compose did not get GOFLOW_IMAGE")
+	}
+}
+
+func TestDeployDockerStopsOnFailure(t *testing.T) {
+	cli := &fakeContainerCLI{failOn: "push"}
+	p := dockerPipeline(&config.DockerConfig{Image: "api", ComposeFile: "compose.yml"}, cli)
+	if err := p.deployDocker(context.Background()); err == nil {
+		t.Fatal("expected push failure")
+	}
+	if got := cli.calls; !reflect.DeepEqual(got, []string{"build", "push api:0123456789ab"}) {
+		t.Errorf("calls = %v", got)
+	}
+
+	cli = &fakeContainerCLI{}
+	p = dockerPipeline(&config.DockerConfig{Image: "api", SkipPush: true}, cli)
+	if err := p.deployDocker(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if got := cli.calls; !reflect.DeepEqual(got, []string{"build"}) {
+		t.Errorf("skip_push calls = %v", got)
+	}
+}
+
+func contains(list []string, value string) bool {
+	for _, item := range list {
+		if item == value {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,144 @@
+package pipeline
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/khaledibrahim1015/goFlow-cicd/internal/config"
+	"github.com/khaledibrahim1015/goFlow-cicd/pkg/executor"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	defaultHealthRetries  = 5
+	defaultHealthInterval = 5 * time.Second
+	defaultHealthTimeout  = 10 * time.Second
+)
+
+// healthCheck probes the deployed application until it passes or the
+// attempts run out. remote is the host to check for ssh deploys, nil otherwise.
+func (p *Pipeline) healthCheck(ctx context.Context, remote *remoteHost) error {
+	hc := p.cfg.Deploy.HealthCheck
+	if hc == nil {
+		return nil
+	}
+	attempts := hc.Retries
+	if attempts == 0 {
+		attempts = defaultHealthRetries
+	}
+	interval := parseDurationOr(hc.Interval, defaultHealthInterval)
+	timeout := parseDurationOr(hc.Timeout, defaultHealthTimeout)
+
+	target := "deployment"
+	if remote != nil {
+		target = remote.name()
+	}
+	var err error
+	for attempt := 1; attempt <= attempts; attempt++ {
+		probeCtx, cancel := context.WithTimeout(ctx, timeout)
+		err = p.probe(probeCtx, hc, remote)
+		cancel()
+		if err == nil {
+			logrus.Infof("Health check of %s passed (attempt %d/%d)", target, attempt, attempts)
+			return nil
+		}
+		logrus.Warnf("Health check of %s failed (attempt %d/%d): %v", target, attempt, attempts, err)
+		if attempt == attempts {
+			break
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(interval):
+		}
+	}
+	return fmt.Errorf("health check failed after %d attempts: %v", attempts, err)
+}
+
+// probe runs one attempt of the configured check
+func (p *Pipeline) probe(ctx context.Context, hc *config.HealthCheckConfig, remote *remoteHost) error {
+	forHost := func(s string) string { return s }
+	if remote != nil {
+		host := remote.name()
+		if h, _, err := net.SplitHostPort(host); err == nil {
+			host = h
+		}
+		forHost = func(s string) string { return strings.ReplaceAll(s, "{host}", host) }
+	}
+	switch {
+	case hc.URL != "":
+		return probeHTTP(ctx, forHost(hc.URL), hc.ExpectStatus, hc.ExpectBody)
+	case hc.TCP != "":
+		return probeTCP(ctx, forHost(hc.TCP))
+	default:
+		return p.probeCommand(ctx, hc.Command, remote)
+	}
+}
+
+// probeHTTP GETs url and checks the status code and body
+func probeHTTP(ctx context.Context, url string, expectStatus int, expectBody string) error {
+	if expectStatus == 0 {
+		expectStatus = http.StatusOK
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return err
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode != expectStatus {
+		return fmt.Errorf("%s returned %d, expected %d", url, resp.StatusCode, expectStatus)
+	}
+	if expectBody != "" && !strings.Contains(string(body), expectBody) {
+		return fmt.Errorf("%s response does not contain %q", url, expectBody)
+	}
+	return nil
+}
+
+// probeTCP checks that address accepts connections
+func probeTCP(ctx context.Context, address string) error {
+	var dialer net.Dialer
+	conn, err := dialer.DialContext(ctx, "tcp", address)
+	if err != nil {
+		return err
+	}
+	return conn.Close()
+}
+
+// probeCommand runs command on the deploy host for ssh deploys, locally in
+// the checkout otherwise; it passes when the command exits with 0
+func (p *Pipeline) probeCommand(ctx context.Context, command string, remote *remoteHost) error {
+	if remote != nil {
+		_, err := remote.run(ctx, command)
+		return err
+	}
+	cmd := executor.CommandContext(ctx, "sh", "-c", command)
+	cmd.Env = p.environ()
+	cmd.Dir = p.repoPath
+	output, err := executor.RunWithOutput(cmd)
+	if err != nil {
+		return fmt.Errorf("%v\nOutput: %s", err, output)
+	}
+	return nil
+}
+
+// parseDurationOr parses value, fallback when it is empty. Values are
+// validated when the config is loaded.
+func parseDurationOr(value string, fallback time.Duration) time.Duration {
+	if d, err := time.ParseDuration(value); err == nil {
+		return d
+	}
+	return fallback
+}
@@ -0,0 +1,82 @@
+package pipeline
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/khaledibrahim1015/goFlow-cicd/internal/config"
+)
+
+func TestHealthCheckHTTPRetries(t *testing.T) {
+	requests := 0
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		if requests < 3 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.Write([]byte(`{"status":"ok"}`))
+	}))
+	defer srv.Close()
+
+	p := New(&config.PipelineConfig{Deploy: config.DeployConfig{HealthCheck: &config.HealthCheckConfig{
+		URL: srv.URL, ExpectBody: `"ok"`, Retries: 3, Interval: "1ms",
+	}}}, t.TempDir())
+	if err := p.healthCheck(context.Background(), nil); err != nil {
+		t.Fatalf("healthCheck: %v", err)
+	}
+	if requests != 3 {
+		t.Errorf("requests = %d, want 3", requests)
+	}
+
+	p.cfg.Deploy.HealthCheck.ExpectBody = "ready"
+	err := p.healthCheck(context.Background(), nil)
+	if err == nil || !strings.Contains(err.Error(), "after 3 attempts") {
+		t.Errorf("err = %v", err)
+	}
+}
+
+func TestHealthCheckTCP(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	address := ln.Addr().String()
+	hc := &config.HealthCheckConfig{TCP: address, Retries: 1}
+	p := New(&config.PipelineConfig{Deploy: config.DeployConfig{HealthCheck: hc}}, t.TempDir())
+	if err := p.healthCheck(context.Background(), nil); err != nil {
+		t.Errorf("listening port: %v", err)
+	}
+	ln.Close()
+	if err := p.healthCheck(context.Background(), nil); err == nil {
+		t.Error("expected closed port to fail")
+	}
+}
+
+func TestFailedHealthCheckRollsBack(t *testing.T) {
+	repo := t.TempDir()
+	marker := filepath.Join(repo, "rolled-back")
+	os.WriteFile(filepath.Join(repo, "rollback.sh"), []byte("touch "+marker), 0755)
+
+	p := dockerPipeline(&config.DockerConfig{Image: "api", SkipPush: true}, &fakeContainerCLI{})
+	p.repoPath = repo
+	p.cfg.Deploy.RollbackScript = "rollback.sh"
+	p.cfg.Deploy.HealthCheck = &config.HealthCheckConfig{Command: "test -f healthy", Retries: 2, Interval: "1ms"}
+
+	err := p.deploy(context.Background())
+	if err == nil || !strings.Contains(err.Error(), "health check failed") {
+		t.Fatalf("err = %v", err)
+	}
+	if p.Deployment().Status != "failed" {
+		t.Errorf("status = %q", p.Deployment().Status)
+	}
+	if _, err := os.Stat(marker); err != nil {
+		t.Error("rollback script did not run")
+	}
+}
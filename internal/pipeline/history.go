@@ -0,0 +1,116 @@
+package pipeline
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/khaledibrahim1015/goFlow-cicd/internal/deployments"
+	"github.com/khaledibrahim1015/goFlow-cicd/pkg/executor"
+	"github.com/sirupsen/logrus"
+)
+
+// maxRangeCommits bounds the commits recorded for a deployment
+const maxRangeCommits = 200
+
+// recordRevision fills in the deployment what is deployed: the artifact
+// checksum and the commits since the one live before. Failures only lose
+// information, the deploy goes on.
+func (p *Pipeline) recordRevision(ctx context.Context) {
+	if checksum, err := artifactChecksum(p.cfg.Build.OutputPath); err == nil {
+		p.deployment.ArtifactChecksum = checksum
+	} else if !os.IsNotExist(err) {
+		logrus.Warnf("Failed to checksum build artifacts: %v", err)
+	}
+	if p.liveCommit == nil {
+		return
+	}
+	live := p.liveCommit()
+	if live == "" {
+		return
+	}
+	p.deployment.PreviousCommit = live
+	commits, err := p.commitsSince(ctx, live)
+	if err != nil {
+		logrus.Warnf("Failed to list the commits since %s: %v", live, err)
+		return
+	}
+	p.deployment.Commits = commits
+}
+
+// artifactChecksum hashes the relative paths and contents of the files in dir
+func artifactChecksum(dir string) (string, error) {
+	if _, err := os.Stat(dir); err != nil {
+		return "", err
+	}
+	sum := sha256.New()
+	err := filepath.WalkDir(dir, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil || !entry.Type().IsRegular() {
+			return err
+		}
+		rel, err := filepath.Rel(dir, path)
+		if err != nil {
+			return err
+		}
+		f, err := os.Open(path)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		fmt.Fprintf(sum, "%s\x00", filepath.ToSlash(rel))
+		_, err = io.Copy(sum, f)
+		return err
+	})
+	if err != nil {
+		return "", err
+	}
+	return "sha256:" + hex.EncodeToString(sum.Sum(nil)), nil
+}
+
+// commitsSince lists the commits of the checkout that since lacks, newest
+// first. The clone is shallow, so more history is fetched when since is not in it.
+func (p *Pipeline) commitsSince(ctx context.Context, since string) ([]deployments.Commit, error) {
+	if !p.hasCommit(ctx, since) {
+		cmd := executor.CommandContext(ctx, "git", "fetch", "--quiet", fmt.Sprintf("--deepen=%d", maxRangeCommits), "origin")
+		cmd.Dir = p.repoPath
+		if output, err := executor.RunWithOutput(cmd); err != nil {
+			return nil, fmt.Errorf("git fetch failed: %v\nOutput: %s", err, output)
+		}
+		if !p.hasCommit(ctx, since) {
+			return nil, fmt.Errorf("commit %s is not in the last %d commits", since, maxRangeCommits)
+		}
+	}
+
+	cmd := executor.CommandContext(ctx, "git", "log", "-n", fmt.Sprint(maxRangeCommits),
+		"--format=%H%x1f%an%x1f%aI%x1f%s", since+"..HEAD")
+	cmd.Dir = p.repoPath
+	output, err := executor.RunWithOutput(cmd)
+	if err != nil {
+		return nil, fmt.Errorf("git log failed: %v\nOutput: %s", err, output)
+	}
+	var commits []deployments.Commit
+	for _, line := range strings.Split(strings.TrimSpace(output), "\n") {
+		fields := strings.SplitN(line, "\x1f", 4)
+		if len(fields) != 4 {
+			continue
+		}
+		date, _ := time.Parse(time.RFC3339, fields[2])
+		commits = append(commits, deployments.Commit{SHA: fields[0], Author: fields[1], Date: date.UTC(), Subject: fields[3]})
+	}
+	return commits, nil
+}
+
+// hasCommit reports whether the checkout has the commit sha
+func (p *Pipeline) hasCommit(ctx context.Context, sha string) bool {
+	cmd := executor.CommandContext(ctx, "git", "cat-file", "-e", sha+"^{commit}")
+	cmd.Dir = p.repoPath
+	_, err := executor.RunWithOutput(cmd)
+	return err == nil
+}
@@ -0,0 +1,73 @@
+package pipeline
+
+import (
+	"context"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/khaledibrahim1015/goFlow-cicd/internal/config"
+)
+
+func git(t *testing.T, dir string, args ...string) string {
+	t.Helper()
+	cmd := exec.Command("git", args...)
+	cmd.Dir = dir
+	cmd.Env = append(os.Environ(), "GIT_AUTHOR_NAME=dev", "GIT_AUTHOR_EMAIL=dev@example.com",
+		"GIT_COMMITTER_NAME=dev", "GIT_COMMITTER_EMAIL=dev@example.com")
+	output, err := cmd.CombinedOutput()
+	if err != nil {
+		t.Fatalf("git %v: %v\n%s", args, err, output)
+	}
+	return strings.TrimSpace(string(output))
+}
+
+func TestDeploymentRecordsCommitRange(t *testing.T) {
+	origin := t.TempDir()
+	git(t, origin, "init", "-q", "-b", "main")
+	var commits []string
+	for _, subject := range []string{"initial", "add login", "fix login"} {
+		git(t, origin, "commit", "-q", "--allow-empty", "-m", subject)
+		commits = append(commits, git(t, origin, "rev-parse", "HEAD"))
+	}
+
+	// Shallow like the pipeline's own clones
+	repo := filepath.Join(t.TempDir(), "repo")
+	git(t, filepath.Dir(repo), "clone", "-q", "--depth", "1", "file://"+origin, repo)
+	out := t.TempDir()
+	os.WriteFile(filepath.Join(out, "app.dll"), []byte("v3"), 0644)
+
+	p := New(&config.PipelineConfig{
+		Build:  config.BuildConfig{OutputPath: out},
+		Deploy: config.DeployConfig{Method: "local", Local: &config.LocalConfig{Path: filepath.Join(t.TempDir(), "app")}},
+	}, repo)
+	p.SetRevision("refs/heads/main", commits[2])
+	// Another run deploys commits[0] while this one waits at its deploy gate
+	live := ""
+	p.SetLiveCommit(func() string { return live })
+	p.SetDeployGate(func(context.Context) error {
+		live = commits[0]
+		return nil
+	})
+	if err := p.deploy(context.Background()); err != nil {
+		t.Fatalf("deploy: %v", err)
+	}
+
+	d := p.Deployment()
+	if d.PreviousCommit != commits[0] || len(d.Commits) != 2 {
+		t.Fatalf("previous = %s, commits = %+v", d.PreviousCommit, d.Commits)
+	}
+	if d.Commits[0].SHA != commits[2] || d.Commits[0].Subject != "fix login" || d.Commits[1].Author != "dev" {
+		t.Errorf("commits = %+v", d.Commits)
+	}
+	if !strings.HasPrefix(d.ArtifactChecksum, "sha256:") {
+		t.Errorf("checksum = %q", d.ArtifactChecksum)
+	}
+	before := d.ArtifactChecksum
+	os.WriteFile(filepath.Join(out, "app.dll"), []byte("v4"), 0644)
+	if after, _ := artifactChecksum(out); after == before {
+		t.Error("checksum did not change with the artifact")
+	}
+}
@@ -0,0 +1,332 @@
+package pipeline
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/khaledibrahim1015/goFlow-cicd/internal/config"
+	"github.com/khaledibrahim1015/goFlow-cicd/pkg/executor"
+	"github.com/sirupsen/logrus"
+)
+
+const defaultRolloutTimeout = 5 * time.Minute
+
+// Kubectl runs the kubectl commands of Kubernetes deploys. The default
+// implementation shells out to kubectl, tests fake it.
+type Kubectl interface {
+	Kustomize(ctx context.Context, dir string) ([]byte, error)
+	Apply(ctx context.Context, manifests []byte) ([]AppliedObject, error)
+	RolloutStatus(ctx context.Context, resource string, timeout time.Duration) error
+	RolloutUndo(ctx context.Context, resource string) error
+}
+
+// AppliedObject is one line of kubectl apply output, e.g. "deployment.apps/api configured"
+type AppliedObject struct {
+	Name   string // e.g. "deployment.apps/api"
+	Action string // created, configured or unchanged
+}
+
+// manifestData is what manifest templates can refer to, e.g. image: {{.Image}}
+type manifestData struct {
+	Image     string
+	Tag       string
+	Commit    string
+	Ref       string
+	Namespace string
+	Env       map[string]string
+}
+
+// deployKubernetes renders and applies the manifests, then waits for the
+// workloads to roll out. Workloads that fail to roll out are rolled back.
+func (p *Pipeline) deployKubernetes(ctx context.Context) error {
+	k8s := p.cfg.Deploy.Kubernetes
+	if k8s == nil {
+		return fmt.Errorf("kubernetes config missing")
+	}
+	kube := p.kubectlCLI(k8s)
+
+	image, tag, err := p.deployImage(ctx, k8s)
+	if err != nil {
+		return err
+	}
+
+	var raw []byte
+	if k8s.Kustomize != "" {
+		if raw, err = kube.Kustomize(ctx, filepath.Join(p.repoPath, k8s.Kustomize)); err != nil {
+			return fmt.Errorf("kustomize failed: %v", err)
+		}
+	} else if raw, err = readManifests(p.repoPath, k8s.Manifests); err != nil {
+		return err
+	}
+	manifests, err := renderManifests(raw, manifestData{
+		Image:     image,
+		Tag:       tag,
+		Commit:    p.commit,
+		Ref:       p.ref,
+		Namespace: k8s.Namespace,
+		Env:       p.envMap(),
+	})
+	if err != nil {
+		return err
+	}
+
+	applied, err := kube.Apply(ctx, manifests)
+	if err != nil {
+		return fmt.Errorf("kubectl apply failed: %v", err)
+	}
+	names := make([]string, len(applied))
+	for i, obj := range applied {
+		names[i] = obj.Name + " " + obj.Action
+	}
+	logrus.Infof("Applied %s", strings.Join(names, ", "))
+
+	rollouts := k8s.Rollouts
+	if len(rollouts) == 0 {
+		rollouts = workloads(applied)
+	}
+	// Only workloads this apply configured have a revision to go back to
+	p.configured = nil
+	for _, resource := range rollouts {
+		if configured(applied, resource) {
+			p.configured = append(p.configured, resource)
+		}
+	}
+	timeout := defaultRolloutTimeout
+	if k8s.RolloutTimeout != "" {
+		timeout, _ = time.ParseDuration(k8s.RolloutTimeout)
+	}
+	for _, resource := range rollouts {
+		if err := kube.RolloutStatus(ctx, resource, timeout); err != nil {
+			logrus.Errorf("Rollout of %s failed: %v", resource, err)
+			p.rollbackKubernetes(ctx)
+			return fmt.Errorf("rollout of %s failed: %v", resource, err)
+		}
+		logrus.Infof("Rolled out %s", resource)
+	}
+
+	if err := p.runLocalPostDeploy(ctx, append(p.environ(), "GOFLOW_IMAGE="+image, "GOFLOW_IMAGE_TAG="+tag)); err != nil {
+		return err
+	}
+	logrus.Info("Kubernetes deployment successful")
+	return nil
+}
+
+// deployImage returns the image to roll out: built and pushed here when
+// deploy.docker is configured, otherwise the configured image tagged with the commit
+func (p *Pipeline) deployImage(ctx context.Context, k8s *config.KubernetesConfig) (string, string, error) {
+	if dockerCfg := p.cfg.Deploy.Docker; dockerCfg != nil && dockerCfg.Image != "" {
+		images, tags, err := p.buildImage(ctx, dockerCfg)
+		if err != nil {
+			return "", "", err
+		}
+		return images[0], tags[0], nil
+	}
+	commit, err := p.resolveCommit()
+	if err != nil {
+		return "", "", err
+	}
+	repository, _ := imageRepository(k8s.Image, "")
+	tag := imageTags(p.ref, commit, nil)[0]
+	return repository + ":" + tag, tag, nil
+}
+
+// readManifests concatenates the manifest files, directories contribute their
+// .yaml, .yml and .json files in name order
+func readManifests(repoPath string, paths []string) ([]byte, error) {
+	var files []string
+	for _, manifest := range paths {
+		path := filepath.Join(repoPath, manifest)
+		info, err := os.Stat(path)
+		if err != nil {
+			return nil, fmt.Errorf("manifest %s: %v", manifest, err)
+		}
+		if !info.IsDir() {
+			files = append(files, path)
+			continue
+		}
+		entries, err := os.ReadDir(path)
+		if err != nil {
+			return nil, fmt.Errorf("manifest directory %s: %v", manifest, err)
+		}
+		for _, entry := range entries {
+			switch filepath.Ext(entry.Name()) {
+			case ".yaml", ".yml", ".json":
+				if !entry.IsDir() {
+					files = append(files, filepath.Join(path, entry.Name()))
+				}
+			}
+		}
+	}
+
+	var buf bytes.Buffer
+	for _, file := range files {
+		data, err := os.ReadFile(file)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read manifest %s: %v", file, err)
+		}
+		buf.WriteString("---\n")
+		buf.Write(data)
+		if !bytes.HasSuffix(data, []byte("\n")) {
+			buf.WriteString("\n")
+		}
+	}
+	return buf.Bytes(), nil
+}
+
+func renderManifests(raw []byte, data manifestData) ([]byte, error) {
+	tmpl, err := template.New("manifests").Option("missingkey=error").Parse(string(raw))
+	if err != nil {
+		return nil, fmt.Errorf("invalid manifest template: %v", err)
+	}
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, data); err != nil {
+		return nil, fmt.Errorf("failed to render manifests: %v", err)
+	}
+	return buf.Bytes(), nil
+}
+
+// rollbackKubernetes rolls the workloads the deploy configured back to their
+// previous revision, even when the run was cancelled while waiting
+func (p *Pipeline) rollbackKubernetes(ctx context.Context) {
+	kube := p.kubectlCLI(p.cfg.Deploy.Kubernetes)
+	undoCtx := context.WithoutCancel(ctx)
+	for _, resource := range p.configured {
+		if err := kube.RolloutUndo(undoCtx, resource); err != nil {
+			logrus.Errorf("Rollout undo of %s failed: %v", resource, err)
+		} else {
+			logrus.Infof("Rolled back %s", resource)
+		}
+	}
+	// Undone already, not again by executeRollback
+	p.configured = nil
+}
+
+// kubectlCLI returns the kubectl set by tests, or the configured one
+func (p *Pipeline) kubectlCLI(k8s *config.KubernetesConfig) Kubectl {
+	if p.kubectl != nil {
+		return p.kubectl
+	}
+	return newKubectlCLI(k8s)
+}
+
+// workloads picks the objects kubectl rollout status can wait for
+func workloads(applied []AppliedObject) []string {
+	var rollouts []string
+	for _, obj := range applied {
+		kind, _ := splitResource(obj.Name)
+		switch kind {
+		case "deployment", "statefulset", "daemonset":
+			rollouts = append(rollouts, obj.Name)
+		}
+	}
+	sort.Strings(rollouts)
+	return rollouts
+}
+
+// configured reports whether apply changed an existing resource, matching
+// "deployment/api" against "deployment.apps/api"
+func configured(applied []AppliedObject, resource string) bool {
+	kind, name := splitResource(resource)
+	for _, obj := range applied {
+		if k, n := splitResource(obj.Name); k == kind && n == name {
+			return obj.Action == "configured"
+		}
+	}
+	return false
+}
+
+// splitResource returns the lower-case kind without API group, and the name
+func splitResource(resource string) (string, string) {
+	kind, name, _ := strings.Cut(resource, "/")
+	kind, _, _ = strings.Cut(strings.ToLower(kind), ".")
+	return kind, name
+}
+
+// envMap returns the run variables, for templates
+func (p *Pipeline) envMap() map[string]string {
+	vars := make(map[string]string, len(p.env))
+	for _, kv := range p.env {
+		key, value, _ := strings.Cut(kv, "=")
+		vars[key] = value
+	}
+	return vars
+}
+
+// kubectlCLI runs kubectl against the configured cluster
+type kubectlCLI struct {
+	binary   string
+	baseArgs []string
+}
+
+func newKubectlCLI(k8s *config.KubernetesConfig) *kubectlCLI {
+	var baseArgs []string
+	if k8s.Kubeconfig != "" {
+		baseArgs = append(baseArgs, "--kubeconfig", k8s.Kubeconfig)
+	}
+	if k8s.Context != "" {
+		baseArgs = append(baseArgs, "--context", k8s.Context)
+	}
+	if k8s.Namespace != "" {
+		baseArgs = append(baseArgs, "--namespace", k8s.Namespace)
+	}
+	return &kubectlCLI{binary: valueOr(k8s.Kubectl, "kubectl"), baseArgs: baseArgs}
+}
+
+// run returns the standard output; warnings on stderr only end up in errors and debug logs
+func (k *kubectlCLI) run(ctx context.Context, stdin []byte, args ...string) ([]byte, error) {
+	cmd := executor.CommandContext(ctx, k.binary, append(append([]string{}, k.baseArgs...), args...)...)
+	if stdin != nil {
+		cmd.Stdin = bytes.NewReader(stdin)
+	}
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	logrus.Infof("COMMAND : %s", cmd.String())
+	if err := cmd.Run(); err != nil {
+		return nil, fmt.Errorf("kubectl %s failed: %v\nOutput: %s", args[0], err, stderr.String())
+	}
+	logrus.Debugf("kubectl %s output: %s%s", args[0], stdout.String(), stderr.String())
+	return stdout.Bytes(), nil
+}
+
+func (k *kubectlCLI) Kustomize(ctx context.Context, dir string) ([]byte, error) {
+	return k.run(ctx, nil, "kustomize", dir)
+}
+
+func (k *kubectlCLI) Apply(ctx context.Context, manifests []byte) ([]AppliedObject, error) {
+	output, err := k.run(ctx, manifests, "apply", "-f", "-")
+	if err != nil {
+		return nil, err
+	}
+	return parseApplyOutput(output), nil
+}
+
+// parseApplyOutput reads lines like "deployment.apps/api configured"
+func parseApplyOutput(output []byte) []AppliedObject {
+	var applied []AppliedObject
+	for _, line := range strings.Split(string(output), "\n") {
+		fields := strings.Fields(line)
+		if len(fields) < 2 || !strings.Contains(fields[0], "/") {
+			continue
+		}
+		applied = append(applied, AppliedObject{Name: fields[0], Action: fields[1]})
+	}
+	return applied
+}
+
+func (k *kubectlCLI) RolloutStatus(ctx context.Context, resource string, timeout time.Duration) error {
+	_, err := k.run(ctx, nil, "rollout", "status", resource, "--timeout", timeout.String())
+	return err
+}
+
+func (k *kubectlCLI) RolloutUndo(ctx context.Context, resource string) error {
+	_, err := k.run(ctx, nil, "rollout", "undo", resource)
+	return err
+}
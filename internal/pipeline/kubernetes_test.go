@@ -0,0 +1,147 @@
+package pipeline
+
+import (
+	"context"
+	"errors"
+	"net"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/khaledibrahim1015/goFlow-cicd/internal/config"
+)
+
+// fakeKubectl records kubectl commands; the rollout of failRollout fails
+type fakeKubectl struct {
+	applied     string
+	calls       []string
+	failRollout string
+	objects     []AppliedObject // what apply reports, defaults to a configured deployment.apps/api
+}
+
+func (f *fakeKubectl) Kustomize(_ context.Context, dir string) ([]byte, error) {
+	f.calls = append(f.calls, "kustomize "+filepath.Base(dir))
+	return []byte("image: {{.Image}}\n"), nil
+}
+
+func (f *fakeKubectl) Apply(_ context.Context, manifests []byte) ([]AppliedObject, error) {
+	f.applied = string(manifests)
+	f.calls = append(f.calls, "apply")
+	if f.objects != nil {
+		return f.objects, nil
+	}
+	return []AppliedObject{{"service/api", "unchanged"}, {"deployment.apps/api", "configured"}, {"configmap/api", "created"}}, nil
+}
+
+func (f *fakeKubectl) RolloutStatus(_ context.Context, resource string, timeout time.Duration) error {
+	f.calls = append(f.calls, "status "+resource+" "+timeout.String())
+	if resource == f.failRollout {
+		return errors.New("deadline exceeded")
+	}
+	return nil
+}
+
+func (f *fakeKubectl) RolloutUndo(_ context.Context, resource string) error {
+	f.calls = append(f.calls, "undo "+resource)
+	return nil
+}
+
+func k8sPipeline(t *testing.T, k8s *config.KubernetesConfig, kube Kubectl) *Pipeline {
+	repo := t.TempDir()
+	os.MkdirAll(filepath.Join(repo, "k8s"), 0755)
+	os.WriteFile(filepath.Join(repo, "k8s", "deployment.yaml"), []byte("image: {{.Image}}\nenv: {{.Env.STAGE}}"), 0644)
+	os.WriteFile(filepath.Join(repo, "k8s", "README.md"), []byte("not a manifest {{"), 0644)
+
+	p := New(&config.PipelineConfig{Deploy: config.DeployConfig{Method: "kubernetes", Kubernetes: k8s}}, repo)
+	p.SetRevision("refs/tags/v1.2.0", "abcdef0123456789")
+	p.SetEnv(map[string]string{"STAGE": "prod"})
+	p.kubectl = kube
+	return p
+}
+
+func TestDeployKubernetes(t *testing.T) {
+	kube := &fakeKubectl{}
+	p := k8sPipeline(t, &config.KubernetesConfig{
+		Manifests:      []string{"k8s"},
+		Image:          "registry.example.com/api:old",
+		RolloutTimeout: "90s",
+	}, kube)
+
+	if err := p.deployKubernetes(context.Background()); err != nil {
+		t.Fatalf("deployKubernetes: %v", err)
+	}
+	if want := "---\nimage: registry.example.com/api:abcdef012345\nenv: prod\n"; kube.applied != want {
+		t.Errorf("applied = %q, want %q", kube.applied, want)
+	}
+	if want := []string{"apply", "status deployment.apps/api 1m30s"}; !reflect.DeepEqual(kube.calls, want) {
+		t.Errorf("calls = %v", kube.calls)
+	}
+}
+
+func TestDeployKubernetesUndoesFailedRollout(t *testing.T) {
+	kube := &fakeKubectl{failRollout: "deployment/worker", objects: []AppliedObject{
+		{"deployment.apps/api", "configured"}, {"deployment.apps/worker", "configured"},
+	}}
+	p := k8sPipeline(t, &config.KubernetesConfig{
+		Kustomize: "overlays/prod",
+		Image:     "api",
+		Rollouts:  []string{"deployment/api", "deployment/worker"},
+	}, kube)
+
+	err := p.deployKubernetes(context.Background())
+	if err == nil || !strings.Contains(err.Error(), "deployment/worker") {
+		t.Fatalf("err = %v", err)
+	}
+	want := []string{
+		"kustomize prod", "apply",
+		"status deployment/api 5m0s", "status deployment/worker 5m0s",
+		"undo deployment/api", "undo deployment/worker",
+	}
+	if !reflect.DeepEqual(kube.calls, want) {
+		t.Errorf("calls = %v", kube.calls)
+	}
+	if kube.applied != "image: api:abcdef012345\n" {
+		t.Errorf("applied = %q", kube.applied)
+	}
+}
+
+func TestDeployKubernetesLeavesUnchangedWorkloads(t *testing.T) {
+	kube := &fakeKubectl{failRollout: "deployment.apps/worker", objects: parseApplyOutput([]byte(
+		"service/api unchanged\ndeployment.apps/api configured\ndeployment.apps/worker unchanged\n"))}
+	p := k8sPipeline(t, &config.KubernetesConfig{Manifests: []string{"k8s"}, Image: "api"}, kube)
+
+	if err := p.deployKubernetes(context.Background()); err == nil {
+		t.Fatal("expected the failed rollout to fail the deploy")
+	}
+	want := []string{
+		"apply",
+		"status deployment.apps/api 5m0s",
+		"status deployment.apps/worker 5m0s",
+		"undo deployment.apps/api",
+	}
+	if !reflect.DeepEqual(kube.calls, want) {
+		t.Errorf("calls = %v", kube.calls)
+	}
+}
+
+func TestFailedHealthCheckUndoesKubernetesDeploy(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ln.Close()
+	kube := &fakeKubectl{}
+	p := k8sPipeline(t, &config.KubernetesConfig{Manifests: []string{"k8s"}, Image: "api"}, kube)
+	p.cfg.Deploy.HealthCheck = &config.HealthCheckConfig{TCP: ln.Addr().String(), Retries: 1}
+
+	if err := p.deploy(context.Background()); err == nil || !strings.Contains(err.Error(), "health check failed") {
+		t.Fatalf("err = %v", err)
+	}
+	want := []string{"apply", "status deployment.apps/api 5m0s", "undo deployment.apps/api"}
+	if !reflect.DeepEqual(kube.calls, want) {
+		t.Errorf("calls = %v", kube.calls)
+	}
+}
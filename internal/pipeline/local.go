@@ -0,0 +1,159 @@
+package pipeline
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+
+	"github.com/sirupsen/logrus"
+)
+
+// deployLocal replaces the configured directory with a copy of the build
+// output. The copy is staged next to it and exchanged with the current
+// directory, which is then kept as "<path>.previous" for rollback.
+func (p *Pipeline) deployLocal(ctx context.Context) error {
+	localCfg := p.cfg.Deploy.Local
+	if localCfg == nil || localCfg.Path == "" {
+		return fmt.Errorf("local deploy path missing")
+	}
+	srcDir := p.cfg.Build.OutputPath
+	if _, err := os.Stat(srcDir); os.IsNotExist(err) {
+		return fmt.Errorf("build artifacts not found at %s", srcDir)
+	}
+	dest := filepath.Clean(localCfg.Path)
+	p.deployment.Path = dest
+	if err := os.MkdirAll(filepath.Dir(dest), 0755); err != nil {
+		return err
+	}
+
+	// Staged in the same directory, so the rename never crosses file systems
+	staging, err := os.MkdirTemp(filepath.Dir(dest), "."+filepath.Base(dest)+".goflow-")
+	if err != nil {
+		return err
+	}
+	defer func() {
+		// After the exchange it holds the replaced directory, kept for rollback
+		if p.replaced != staging {
+			os.RemoveAll(staging)
+		}
+	}()
+	if err := copyDir(ctx, srcDir, staging); err != nil {
+		return fmt.Errorf("failed to copy %s: %v", srcDir, err)
+	}
+
+	if _, err := os.Lstat(dest); os.IsNotExist(err) {
+		if err := os.Rename(staging, dest); err != nil {
+			return err
+		}
+	} else {
+		if err := exchangeDirs(staging, dest); err != nil {
+			return fmt.Errorf("failed to replace %s: %v", dest, err)
+		}
+		p.replaced = staging
+		previous := dest + ".previous"
+		if err := os.RemoveAll(previous); err != nil {
+			return err
+		}
+		if err := os.Rename(staging, previous); err != nil {
+			return err
+		}
+		p.replaced = previous
+	}
+	logrus.Infof("Copied %s to %s", srcDir, dest)
+
+	if err := p.runLocalPostDeploy(ctx, append(p.environ(), "GOFLOW_DEPLOY_PATH="+dest)); err != nil {
+		return err
+	}
+	logrus.Info("Local deployment successful")
+	return nil
+}
+
+// rollbackLocal puts back the directory replaced by this run's deploy
+func (p *Pipeline) rollbackLocal() error {
+	dest := p.deployment.Path
+	if err := exchangeDirs(p.replaced, dest); err != nil {
+		return fmt.Errorf("failed to restore %s: %v", dest, err)
+	}
+	// The failed copy is not worth keeping as the previous version
+	if err := os.RemoveAll(p.replaced); err != nil {
+		logrus.Warnf("Failed to remove %s: %v", p.replaced, err)
+	}
+	p.replaced = ""
+	logrus.Infof("Restored the previous contents of %s", dest)
+	return nil
+}
+
+// swapByRename exchanges two directories with three renames, for file systems
+// that can't do it at once. For a moment neither is at b.
+func swapByRename(a, b string) error {
+	tmp := a + ".swap"
+	if err := os.Rename(b, tmp); err != nil {
+		return err
+	}
+	if err := os.Rename(a, b); err != nil {
+		os.Rename(tmp, b)
+		return err
+	}
+	return os.Rename(tmp, a)
+}
+
+// copyDir copies the tree at src into dst, keeping modes, modification times
+// and symlinks
+func copyDir(ctx context.Context, src, dst string) error {
+	return filepath.WalkDir(src, func(srcPath string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(src, srcPath)
+		if err != nil {
+			return err
+		}
+		dstPath := filepath.Join(dst, rel)
+		info, err := entry.Info()
+		if err != nil {
+			return err
+		}
+		switch {
+		case entry.IsDir():
+			if err := os.MkdirAll(dstPath, 0755); err != nil {
+				return err
+			}
+			return os.Chmod(dstPath, info.Mode().Perm())
+		case info.Mode()&fs.ModeSymlink != 0:
+			target, err := os.Readlink(srcPath)
+			if err != nil {
+				return err
+			}
+			return os.Symlink(target, dstPath)
+		case !info.Mode().IsRegular():
+			return nil // sockets, devices
+		}
+		return copyFile(srcPath, dstPath, info)
+	})
+}
+
+func copyFile(srcPath, dstPath string, info fs.FileInfo) error {
+	src, err := os.Open(srcPath)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+	dst, err := os.OpenFile(dstPath, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, info.Mode().Perm())
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(dst, src)
+	if closeErr := dst.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return err
+	}
+	return os.Chtimes(dstPath, info.ModTime(), info.ModTime())
+}
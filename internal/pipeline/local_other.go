@@ -0,0 +1,9 @@
+//go:build !linux
+
+package pipeline
+
+// exchangeDirs swaps the two directories; without an atomic exchange there
+// is a moment where b is missing
+func exchangeDirs(a, b string) error {
+	return swapByRename(a, b)
+}
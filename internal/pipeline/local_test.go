@@ -0,0 +1,97 @@
+package pipeline
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/khaledibrahim1015/goFlow-cicd/internal/config"
+)
+
+func TestDeployLocal(t *testing.T) {
+	repo, out := t.TempDir(), t.TempDir()
+	dest := filepath.Join(t.TempDir(), "share", "app")
+	os.MkdirAll(filepath.Join(out, "bin"), 0755)
+	os.WriteFile(filepath.Join(out, "bin", "tool"), []byte("v1"), 0755)
+	os.Symlink("bin/tool", filepath.Join(out, "tool"))
+
+	p := New(&config.PipelineConfig{
+		Build: config.BuildConfig{OutputPath: out},
+		Deploy: config.DeployConfig{
+			Method:         "local",
+			Local:          &config.LocalConfig{Path: dest},
+			PostDeployCmds: []string{`cat "$GOFLOW_DEPLOY_PATH/tool" > served`},
+		},
+	}, repo)
+	p.SetRevision("refs/heads/main", "abc123")
+	if err := p.deploy(context.Background()); err != nil {
+		t.Fatalf("first deploy: %v", err)
+	}
+	if got := readTestFile(t, filepath.Join(repo, "served")); got != "v1" {
+		t.Errorf("served = %q", got)
+	}
+	if info, err := os.Stat(filepath.Join(dest, "bin", "tool")); err != nil || info.Mode().Perm() != 0755 {
+		t.Errorf("bin/tool = %v, %v", info, err)
+	}
+
+	// A second deploy keeps the first as .previous, a failed third one is rolled back
+	os.WriteFile(filepath.Join(out, "bin", "tool"), []byte("v2"), 0755)
+	p = New(p.cfg, repo)
+	p.SetRevision("refs/heads/main", "def456")
+	if err := p.deploy(context.Background()); err != nil {
+		t.Fatalf("second deploy: %v", err)
+	}
+	if got := readTestFile(t, filepath.Join(dest+".previous", "bin", "tool")); got != "v1" {
+		t.Errorf("previous = %q", got)
+	}
+
+	os.WriteFile(filepath.Join(out, "bin", "tool"), []byte("v3"), 0755)
+	p = New(p.cfg, repo)
+	p.cfg.Deploy.PostDeployCmds = []string{"exit 1"}
+	if err := p.deploy(context.Background()); err == nil {
+		t.Fatal("expected the post-deploy command to fail the deploy")
+	}
+	if got := readTestFile(t, filepath.Join(dest, "bin", "tool")); got != "v2" {
+		t.Errorf("after rollback = %q, want v2", got)
+	}
+	if _, err := os.Stat(dest + ".previous"); !os.IsNotExist(err) {
+		t.Errorf("failed copy kept as previous: %v", err)
+	}
+	entries, _ := os.ReadDir(filepath.Dir(dest))
+	if len(entries) != 1 {
+		t.Errorf("left behind: %v", entries)
+	}
+}
+
+func TestDeployGateSkipsDeploy(t *testing.T) {
+	dest := filepath.Join(t.TempDir(), "app")
+	p := New(&config.PipelineConfig{
+		Build:  config.BuildConfig{OutputPath: t.TempDir()},
+		Deploy: config.DeployConfig{Method: "local", Local: &config.LocalConfig{Path: dest}},
+	}, t.TempDir())
+	p.SetDeployGate(func(context.Context) error {
+		return fmt.Errorf("%w: freeze", ErrDeploySkipped)
+	})
+	if err := p.deploy(context.Background()); err != nil {
+		t.Fatalf("deploy: %v", err)
+	}
+	if _, err := os.Stat(dest); !os.IsNotExist(err) || p.Deployment() != nil {
+		t.Errorf("deployed during a freeze: %v", err)
+	}
+
+	p.SetDeployGate(func(context.Context) error { return context.Canceled })
+	if err := p.deploy(context.Background()); err == nil {
+		t.Error("expected a failing gate to fail the deploy")
+	}
+}
+
+func readTestFile(t *testing.T, path string) string {
+	t.Helper()
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(data)
+}
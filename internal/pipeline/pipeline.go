@@ -1,17 +1,40 @@
 package pipeline
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"os"
+	"sync"
 
 	"github.com/khaledibrahim1015/goFlow-cicd/internal/config"
 	"github.com/khaledibrahim1015/goFlow-cicd/internal/dependencies"
+	"github.com/khaledibrahim1015/goFlow-cicd/internal/deployments"
+	"github.com/khaledibrahim1015/goFlow-cicd/pkg/executor"
 	"github.com/sirupsen/logrus"
 )
 
 type Pipeline struct {
 	cfg      *config.PipelineConfig
-	repoPath string // which cloned from url that provided
+	repoPath string                      // which cloned from url that provided
+	env      []string                    // extra KEY=value variables for every command of the run
+	secrets  map[string]string           // added to env when the deploy stage starts
+	approve  func(context.Context) error // gate before the deploy stage, nil when none
+	gate     func(context.Context) error // checked right before deploying, nil when none
+	ref      string                      // e.g. "refs/heads/main" or "refs/tags/v1.2.0"
+	commit   string                      // checked out commit, resolved from the checkout when empty
+	// looks up the commit deployed to the target right before deploying, to
+	// record the range the deploy changes; nil or "" when unknown
+	liveCommit func() string
+
+	containers ContainerCLI // Docker deploys, nil means the configured CLI
+	kubectl    Kubectl      // Kubernetes deploys, nil means the configured kubectl
+
+	deployment   *deployments.Deployment // what the deploy stage did, nil when it did not run
+	hostsMu      sync.Mutex              // guards deployment.Hosts, updated by parallel host deploys
+	hostReporter func([]deployments.Host)
+	replaced     string   // local deploys: where the replaced directory was moved, empty until then
+	configured   []string // Kubernetes deploys: workloads the apply changed, undone on rollback
 }
 
 func New(cfg *config.PipelineConfig, clonedRepoPath string) *Pipeline {
@@ -21,7 +44,68 @@ func New(cfg *config.PipelineConfig, clonedRepoPath string) *Pipeline {
 	}
 }
 
-func (p *Pipeline) Run() error {
+// SetEnv adds environment variables to every command the pipeline runs
+func (p *Pipeline) SetEnv(vars map[string]string) {
+	for key, value := range vars {
+		p.env = append(p.env, fmt.Sprintf("%s=%s", key, value))
+	}
+}
+
+// SetDeployEnv adds environment variables to the commands of the deploy stage
+// only, e.g. the secrets of the environment deployed to
+func (p *Pipeline) SetDeployEnv(vars map[string]string) {
+	p.secrets = vars
+}
+
+// SetApprovalGate makes the pipeline call approve before the deploy stage,
+// which only starts once approve returns nil
+func (p *Pipeline) SetApprovalGate(approve func(context.Context) error) {
+	p.approve = approve
+}
+
+// ErrDeploySkipped is returned by a deploy gate to finish the run without
+// deploying, e.g. during a deploy freeze
+var ErrDeploySkipped = errors.New("deploy skipped")
+
+// SetDeployGate makes the deploy stage call gate right before deploying, after
+// any approval. The stage waits while gate does, fails when it returns an
+// error and is skipped when that error is ErrDeploySkipped.
+func (p *Pipeline) SetDeployGate(gate func(context.Context) error) {
+	p.gate = gate
+}
+
+// SetRevision records the ref and commit being built, used to tag deployments
+func (p *Pipeline) SetRevision(ref, commit string) {
+	p.ref = ref
+	p.commit = commit
+}
+
+// SetLiveCommit sets how to look up the commit currently deployed to the
+// target. It is called right before deploying, after any approval or freeze,
+// and the deployment lists the commits between it and the one being deployed.
+func (p *Pipeline) SetLiveCommit(lookup func() string) {
+	p.liveCommit = lookup
+}
+
+// ReportHosts calls fn with the state of every host whenever an ssh deploy
+// progresses, e.g. to show it in the run status
+func (p *Pipeline) ReportHosts(fn func([]deployments.Host)) {
+	p.hostReporter = fn
+}
+
+// Deployment returns the record of the deploy stage, nil when the run did not get there
+func (p *Pipeline) Deployment() *deployments.Deployment {
+	return p.deployment
+}
+
+// environ returns the process environment with the run overrides applied
+func (p *Pipeline) environ() []string {
+	return append(os.Environ(), p.env...)
+}
+
+// Run executes the pipeline stages. Cancelling ctx stops the command that is
+// currently executing and runs the configured cleanup commands.
+func (p *Pipeline) Run(ctx context.Context) error {
 
 	logrus.Info("Starting pipeline...")
 
@@ -34,21 +118,52 @@ func (p *Pipeline) Run() error {
 		}
 	}()
 
+	err := p.runStages(ctx)
+	if err != nil && ctx.Err() != nil {
+		logrus.Warn("Pipeline cancelled, running cleanup...")
+		p.cleanup(context.WithoutCancel(ctx))
+		return fmt.Errorf("pipeline cancelled: %v", err)
+	}
+	return err
+}
+
+func (p *Pipeline) runStages(ctx context.Context) error {
 	if err := dependencies.EnsureEnvironment(p.cfg.Build.Type, p.cfg.Build.Version); err != nil {
 		return fmt.Errorf("environment setup failed: %v", err)
 	}
 
 	// execute pipeline (build , test , deploy )
 
-	if err := p.build(); err != nil {
+	if err := p.build(ctx); err != nil {
 		return fmt.Errorf("build failed: %v", err)
 	}
-	if err := p.test(); err != nil {
+	if err := p.test(ctx); err != nil {
 		return fmt.Errorf("test failed:%v", err)
 	}
-	if err := p.deploy(); err != nil {
+	if p.approve != nil {
+		if err := p.approve(ctx); err != nil {
+			return fmt.Errorf("deploy not approved: %v", err)
+		}
+	}
+	if err := p.deploy(ctx); err != nil {
 		return fmt.Errorf("deploy failed:%v", err)
 	}
 	logrus.Info("Pipeline completed successfully")
 	return nil
 }
+
+// cleanup runs the configured cleanup commands in the checkout, logging failures
+func (p *Pipeline) cleanup(ctx context.Context) {
+	for _, cleanupCmd := range p.cfg.CleanupCmds {
+		cmd := executor.CommandContext(ctx, "sh", "-c", cleanupCmd)
+		cmd.Env = p.environ()
+		cmd.Dir = p.repoPath
+		output, err := executor.RunWithOutput(cmd)
+		if err != nil {
+			logrus.Errorf("Cleanup command '%s' failed: %v\nOutput: %s", cleanupCmd, err, output)
+			continue
+		}
+		logrus.Infof("Executed cleanup command: %s", cleanupCmd)
+		logrus.Debugf("Cleanup output: %s", output)
+	}
+}
@@ -0,0 +1,255 @@
+package pipeline
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"path"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/khaledibrahim1015/goFlow-cicd/internal/config"
+	"github.com/khaledibrahim1015/goFlow-cicd/internal/deployments"
+	"github.com/sirupsen/logrus"
+)
+
+// Releases layout on the remote host:
+//
+//	remote_path/releases/20261018120000-abcdef012345/
+//	remote_path/releases/20261018130000-0123456789ab/
+//	remote_path/current -> releases/20261018130000-0123456789ab
+
+// deployRelease uploads the build into a new release directory and switches
+// current to it. Files unchanged since the current release are hard-linked.
+func (p *Pipeline) deployRelease(ctx context.Context, remote *remoteHost, srcDir string) error {
+	commit, err := p.resolveCommit()
+	if err != nil {
+		return err
+	}
+	release := time.Now().UTC().Format("20060102150405") + "-" + commit[:min(len(commit), 12)]
+
+	previous, err := currentRelease(remote)
+	if err != nil {
+		return err
+	}
+	p.updateHost(remote.name(), func(h *deployments.Host) {
+		h.Release = release
+		h.Previous = previous
+	})
+
+	var linkDest string
+	if previous != "" {
+		linkDest = remote.base() + "/releases/" + previous
+	}
+	if err := remote.sync(ctx, srcDir, remote.base()+"/releases/"+release, linkDest); err != nil {
+		return err
+	}
+	if err := switchRelease(ctx, remote, release); err != nil {
+		return err
+	}
+	logrus.Infof("Release %s is now current on %s (previous: %q)", release, remote.name(), previous)
+	return nil
+}
+
+// rollbackReleases undoes a failed deploy on every host that got a new release
+func (p *Pipeline) rollbackReleases(ctx context.Context, sshConfig *config.SSHConfig) error {
+	p.hostsMu.Lock()
+	hosts := slices.Clone(p.deployment.Hosts)
+	p.hostsMu.Unlock()
+
+	var failed []string
+	for _, h := range hosts {
+		if h.Release == "" {
+			continue
+		}
+		remote, err := dialHost(ctx, hostConfig(sshConfig, h.Host))
+		if err == nil {
+			err = rollbackRelease(ctx, remote, h.Release, h.Previous)
+			remote.Close()
+		}
+		if err != nil {
+			logrus.Errorf("Rollback on %s failed: %v", h.Host, err)
+			failed = append(failed, h.Host)
+			continue
+		}
+		p.updateHost(h.Host, func(h *deployments.Host) { h.Status = "rolled_back" })
+	}
+	if len(failed) > 0 {
+		return fmt.Errorf("rollback failed on %s", strings.Join(failed, ", "))
+	}
+	return nil
+}
+
+// rollbackRelease switches current back to previous if the failed release
+// was switched to already, and removes the failed release
+func rollbackRelease(ctx context.Context, remote *remoteHost, release, previous string) error {
+	current, err := currentRelease(remote)
+	if err != nil {
+		return err
+	}
+	if current == release {
+		if previous == "" {
+			return fmt.Errorf("release %s was the first one, there is no previous release to switch back to", release)
+		}
+		if err := switchRelease(ctx, remote, previous); err != nil {
+			return err
+		}
+		logrus.Infof("Switched %s back to release %s", remote.name(), previous)
+	}
+	if err := removeRelease(remote, release); err != nil {
+		return fmt.Errorf("failed to remove release %s: %v", release, err)
+	}
+	return nil
+}
+
+// RollbackDeployment switches every host the deployment updated back to the
+// release that preceded it. Nothing changes unless all of them still run
+// the deployment's release, and hosts are switched back again when one fails.
+func RollbackDeployment(ctx context.Context, sshConfig *config.SSHConfig, d deployments.Deployment) error {
+	var hosts []deployments.Host
+	for _, h := range d.Hosts {
+		if h.Status == "deployed" {
+			hosts = append(hosts, h)
+		}
+	}
+	if len(hosts) == 0 {
+		return fmt.Errorf("deployment %s has no deployed hosts", d.ID)
+	}
+	remotes := make([]*remoteHost, 0, len(hosts))
+	defer func() {
+		for _, remote := range remotes {
+			remote.Close()
+		}
+	}()
+	for _, h := range hosts {
+		if h.Release == "" {
+			return fmt.Errorf("deployment %s did not use the releases layout", d.ID)
+		}
+		if h.Previous == "" {
+			return fmt.Errorf("deployment %s was the first release on %s, there is nothing to roll back to", d.ID, h.Host)
+		}
+		remote, err := dialHost(ctx, hostConfig(sshConfig, h.Host))
+		if err != nil {
+			return err
+		}
+		remotes = append(remotes, remote)
+		current, err := currentRelease(remote)
+		if err != nil {
+			return err
+		}
+		if current != h.Release {
+			return fmt.Errorf("release %s of deployment %s is not current on %s anymore (current: %q)", h.Release, d.ID, h.Host, current)
+		}
+		// keep_releases may have pruned it already
+		if err := releaseExists(remote, h.Previous); err != nil {
+			return fmt.Errorf("cannot roll back %s to release %s: %v", h.Host, h.Previous, err)
+		}
+	}
+	for i, h := range hosts {
+		if err := switchRelease(ctx, remotes[i], h.Previous); err != nil {
+			// All or nothing: put the hosts switched so far back on the deployment's release
+			for j := range i {
+				if undoErr := switchRelease(ctx, remotes[j], hosts[j].Release); undoErr != nil {
+					logrus.Errorf("Failed to switch %s back to release %s: %v", hosts[j].Host, hosts[j].Release, undoErr)
+				}
+			}
+			return fmt.Errorf("%s: %v", h.Host, err)
+		}
+		logrus.Infof("Rolled back %s from release %s to %s", h.Host, h.Release, h.Previous)
+	}
+	return nil
+}
+
+// currentRelease returns the release current points to, "" when there is none yet
+func currentRelease(remote *remoteHost) (string, error) {
+	client, err := remote.SFTP()
+	if err != nil {
+		return "", err
+	}
+	target, err := client.ReadLink(remote.base() + "/current")
+	if errors.Is(err, fs.ErrNotExist) {
+		return "", nil
+	}
+	if err != nil {
+		return "", fmt.Errorf("failed to read current release: %v", err)
+	}
+	return path.Base(target), nil
+}
+
+// switchRelease points current to the release with a rename, so there is no
+// moment without a current release
+func switchRelease(ctx context.Context, remote *remoteHost, release string) error {
+	script := fmt.Sprintf("cd %s && ln -sfn %s .current.tmp && mv -Tf .current.tmp current",
+		shellQuote(remote.base()), shellQuote("releases/"+release))
+	if _, err := remote.run(ctx, script); err != nil {
+		return fmt.Errorf("failed to switch current to %s: %v", release, err)
+	}
+	return nil
+}
+
+// pruneReleases removes all but the newest keep_releases releases, never the current one
+func pruneReleases(ctx context.Context, sshConfig *config.SSHConfig) error {
+	remote, err := dialHost(ctx, sshConfig)
+	if err != nil {
+		return err
+	}
+	defer remote.Close()
+	client, err := remote.SFTP()
+	if err != nil {
+		return err
+	}
+	current, err := currentRelease(remote)
+	if err != nil {
+		return err
+	}
+	entries, err := client.ReadDir(remote.base() + "/releases")
+	if err != nil {
+		return err
+	}
+	var releases []string
+	for _, entry := range entries {
+		if entry.IsDir() {
+			releases = append(releases, entry.Name())
+		}
+	}
+	// Release names start with their timestamp, so newest sort last
+	slices.Sort(releases)
+	for _, release := range releases[:max(len(releases)-sshConfig.KeepReleases, 0)] {
+		if release == current {
+			continue
+		}
+		if err := removeRelease(remote, release); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// releaseExists checks that the release directory is still there
+func releaseExists(remote *remoteHost, release string) error {
+	client, err := remote.SFTP()
+	if err != nil {
+		return err
+	}
+	info, err := client.Stat(remote.base() + "/releases/" + release)
+	if errors.Is(err, fs.ErrNotExist) {
+		return fmt.Errorf("release was removed")
+	}
+	if err != nil {
+		return err
+	}
+	if !info.IsDir() {
+		return fmt.Errorf("release is not a directory")
+	}
+	return nil
+}
+
+func removeRelease(remote *remoteHost, release string) error {
+	client, err := remote.SFTP()
+	if err != nil {
+		return err
+	}
+	return client.RemoveAll(remote.base() + "/releases/" + release)
+}
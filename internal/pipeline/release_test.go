@@ -0,0 +1,225 @@
+package pipeline
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/khaledibrahim1015/goFlow-cicd/internal/config"
+	"github.com/khaledibrahim1015/goFlow-cicd/internal/deployments"
+	"github.com/khaledibrahim1015/goFlow-cicd/pkg/sshclient/sshtest"
+)
+
+// testHosts starts an ssh server for each host and returns the config deploying to them
+func testHosts(t *testing.T, n int) (*config.SSHConfig, []*sshtest.Server) {
+	keyPath, public := sshtest.NewKey(t)
+	servers := make([]*sshtest.Server, n)
+	hosts := make([]string, n)
+	for i := range servers {
+		servers[i] = sshtest.NewServer(t, public)
+		hosts[i] = servers[i].Addr
+	}
+	return &config.SSHConfig{
+		RemoteUser: "deploy", Hosts: hosts, RemotePath: "app",
+		KeyPath: keyPath, KnownHosts: sshtest.WriteKnownHosts(t, servers...),
+	}, servers
+}
+
+func TestReleaseSwitchPruneAndRollback(t *testing.T) {
+	ctx := context.Background()
+	sshConfig, servers := testHosts(t, 1)
+	sshConfig = hostConfig(sshConfig, servers[0].Addr)
+	sshConfig.Hosts, sshConfig.KeepReleases = nil, 2
+	base := filepath.Join(servers[0].Dir, "app")
+	remote, err := dialHost(ctx, sshConfig)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer remote.Close()
+	releases := []string{"20260101000000-aaa", "20260102000000-bbb", "20260103000000-ccc", "20260104000000-ddd"}
+	for _, release := range releases {
+		os.MkdirAll(filepath.Join(base, "releases", release), 0755)
+	}
+
+	if current, err := currentRelease(remote); err != nil || current != "" {
+		t.Fatalf("current before first switch = %q, %v", current, err)
+	}
+	if err := switchRelease(ctx, remote, releases[2]); err != nil {
+		t.Fatal(err)
+	}
+	if err := switchRelease(ctx, remote, releases[3]); err != nil {
+		t.Fatal(err)
+	}
+	if current, _ := currentRelease(remote); current != releases[3] {
+		t.Fatalf("current = %q", current)
+	}
+
+	// Rolling back a release that is not current anymore is refused
+	stale := deployments.Deployment{ID: "run1", Hosts: []deployments.Host{
+		{Host: servers[0].Addr, Status: "deployed", Release: releases[2], Previous: releases[1]},
+	}}
+	if err := RollbackDeployment(ctx, sshConfig, stale); err == nil {
+		t.Error("expected rollback of a stale deployment to fail")
+	}
+	d := deployments.Deployment{ID: "run2", Hosts: []deployments.Host{
+		{Host: servers[0].Addr, Status: "deployed", Release: releases[3], Previous: releases[2]},
+	}}
+	if err := RollbackDeployment(ctx, sshConfig, d); err != nil {
+		t.Fatal(err)
+	}
+	if current, _ := currentRelease(remote); current != releases[2] {
+		t.Fatalf("current after rollback = %q", current)
+	}
+
+	// Keeps the newest two, plus the current one even when it is older
+	sshConfig.KeepReleases = 1
+	if err := pruneReleases(ctx, sshConfig); err != nil {
+		t.Fatal(err)
+	}
+	entries, _ := os.ReadDir(filepath.Join(base, "releases"))
+	var left []string
+	for _, entry := range entries {
+		left = append(left, entry.Name())
+	}
+	if want := []string{releases[2], releases[3]}; !reflect.DeepEqual(left, want) {
+		t.Errorf("releases left = %v, want %v", left, want)
+	}
+}
+
+func TestRollbackDeploymentIsAllOrNothing(t *testing.T) {
+	sshConfig, servers := testHosts(t, 2)
+	d := deployments.Deployment{ID: "run3"}
+	for _, srv := range servers {
+		for _, release := range []string{"20260101000000-old", "20260102000000-new"} {
+			os.MkdirAll(filepath.Join(srv.Dir, "app", "releases", release), 0755)
+		}
+		os.Symlink("releases/20260102000000-new", filepath.Join(srv.Dir, "app", "current"))
+		d.Hosts = append(d.Hosts, deployments.Host{Host: srv.Addr, Status: "deployed", Release: "20260102000000-new", Previous: "20260101000000-old"})
+	}
+	// A directory in the way makes the switch on the second host fail
+	os.MkdirAll(filepath.Join(servers[1].Dir, "app", ".current.tmp", "x"), 0755)
+
+	err := RollbackDeployment(context.Background(), sshConfig, d)
+	if err == nil || !strings.Contains(err.Error(), servers[1].Addr) {
+		t.Fatalf("err = %v", err)
+	}
+	for i, srv := range servers {
+		if current, _ := os.Readlink(filepath.Join(srv.Dir, "app", "current")); current != "releases/20260102000000-new" {
+			t.Errorf("host %d: current = %q", i, current)
+		}
+	}
+}
+
+func TestRollingDeployRollsBackUpdatedHosts(t *testing.T) {
+	sshConfig, servers := testHosts(t, 5)
+	for _, srv := range servers {
+		os.MkdirAll(filepath.Join(srv.Dir, "app", "releases", "20260101000000-old"), 0755)
+		os.Symlink("releases/20260101000000-old", filepath.Join(srv.Dir, "app", "current"))
+	}
+	os.WriteFile(filepath.Join(servers[2].Dir, "broken"), nil, 0644)
+	out := t.TempDir()
+	os.WriteFile(filepath.Join(out, "app.dll"), []byte("v2"), 0644)
+
+	sshConfig.HostGroups = map[string][]string{"web": sshConfig.Hosts}
+	sshConfig.Hosts = []string{"web"}
+	sshConfig.KeepReleases = 3
+	sshConfig.Rolling = &config.RollingConfig{BatchSize: 3, MaxUnavailable: 2}
+	p := New(&config.PipelineConfig{
+		Build: config.BuildConfig{OutputPath: out},
+		Deploy: config.DeployConfig{
+			Method:         "ssh",
+			SSH:            sshConfig,
+			PostDeployCmds: []string{"touch restarted"},
+			HealthCheck:    &config.HealthCheckConfig{Command: "test ! -f broken", Retries: 1},
+		},
+	}, t.TempDir())
+	p.SetRevision("refs/heads/main", "0123456789abcdef")
+	var reports int
+	p.ReportHosts(func([]deployments.Host) { reports++ })
+
+	err := p.deploy(context.Background())
+	if err == nil || !strings.Contains(err.Error(), servers[2].Addr) {
+		t.Fatalf("err = %v", err)
+	}
+	var statuses []string
+	for _, h := range p.Deployment().Hosts {
+		statuses = append(statuses, h.Status)
+	}
+	want := []string{"rolled_back", "rolled_back", "rolled_back", "rolled_back", "skipped"}
+	if !reflect.DeepEqual(statuses, want) {
+		t.Errorf("hosts = %v", statuses)
+	}
+	if reports == 0 {
+		t.Error("host progress was not reported")
+	}
+	for i, srv := range servers {
+		current, _ := os.Readlink(filepath.Join(srv.Dir, "app", "current"))
+		releases, _ := os.ReadDir(filepath.Join(srv.Dir, "app", "releases"))
+		if current != "releases/20260101000000-old" || len(releases) != 1 {
+			t.Errorf("host %d: current = %q, %d releases", i, current, len(releases))
+		}
+		_, err := os.Stat(filepath.Join(srv.Dir, "restarted"))
+		if updated := i < 4; updated != (err == nil) {
+			t.Errorf("host %d: post-deploy command ran = %v", i, err == nil)
+		}
+	}
+}
+
+func TestFailedInPlaceDeployNamesUpdatedHosts(t *testing.T) {
+	sshConfig, servers := testHosts(t, 3)
+	os.WriteFile(filepath.Join(servers[1].Dir, "broken"), nil, 0644)
+	out := t.TempDir()
+	os.WriteFile(filepath.Join(out, "app.dll"), []byte("v2"), 0644)
+	// Not valid config, nothing can roll the first host back
+	p := New(&config.PipelineConfig{
+		Build: config.BuildConfig{OutputPath: out},
+		Deploy: config.DeployConfig{
+			Method:      "ssh",
+			SSH:         sshConfig,
+			HealthCheck: &config.HealthCheckConfig{Command: "test ! -f broken", Retries: 1},
+		},
+	}, t.TempDir())
+
+	err := p.deploy(context.Background())
+	if err == nil || !strings.Contains(err.Error(), servers[0].Addr+", "+servers[1].Addr+" stayed on the new build") {
+		t.Fatalf("err = %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(servers[2].Dir, "app", "app.dll")); err == nil {
+		t.Error("deploy went on after the failing host")
+	}
+}
+
+func TestDeploySSHReleases(t *testing.T) {
+	sshConfig, servers := testHosts(t, 2)
+	sshConfig.KeepReleases = 2
+	out := t.TempDir()
+	os.WriteFile(filepath.Join(out, "app.dll"), []byte("v1"), 0644)
+	p := New(&config.PipelineConfig{
+		Build:  config.BuildConfig{OutputPath: out},
+		Deploy: config.DeployConfig{Method: "ssh", SSH: sshConfig, PostDeployCmds: []string{"cat app/current/app.dll > served"}},
+	}, t.TempDir())
+
+	for _, commit := range []string{"aaaaaaaaaaaaaaaa", "bbbbbbbbbbbbbbbb", "cccccccccccccccc"} {
+		p.SetRevision("refs/heads/main", commit)
+		if err := p.deploy(context.Background()); err != nil {
+			t.Fatalf("deploy %s: %v", commit, err)
+		}
+		time.Sleep(time.Second) // release names have a one second resolution
+	}
+	for i, srv := range servers {
+		releases, _ := os.ReadDir(filepath.Join(srv.Dir, "app", "releases"))
+		if len(releases) != 2 || !strings.HasSuffix(releases[0].Name(), "-bbbbbbbbbbbb") {
+			t.Errorf("host %d: releases = %v", i, releases)
+		}
+		if served, _ := os.ReadFile(filepath.Join(srv.Dir, "served")); string(served) != "v1" {
+			t.Errorf("host %d: served %q", i, served)
+		}
+	}
+	if h := p.Deployment().Hosts[1]; h.Status != "deployed" || !strings.HasSuffix(h.Previous, "-bbbbbbbbbbbb") {
+		t.Errorf("host record = %+v", h)
+	}
+}
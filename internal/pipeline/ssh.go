@@ -0,0 +1,82 @@
+package pipeline
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+
+	"github.com/khaledibrahim1015/goFlow-cicd/internal/config"
+	"github.com/khaledibrahim1015/goFlow-cicd/pkg/sshclient"
+	"github.com/sirupsen/logrus"
+)
+
+const defaultSSHPort = 22
+
+// remoteHost is a connection to one of the ssh deploy hosts
+type remoteHost struct {
+	*sshclient.Client
+	cfg *config.SSHConfig // aimed at this host
+}
+
+// dialHost connects to the host sshConfig is aimed at
+func dialHost(ctx context.Context, sshConfig *config.SSHConfig) (*remoteHost, error) {
+	client, err := sshclient.Dial(ctx, sshclient.Config{
+		User:                  sshConfig.RemoteUser,
+		Addr:                  hostAddr(sshConfig.RemoteHost, sshConfig.Port),
+		KeyPath:               sshConfig.KeyPath,
+		UseAgent:              sshConfig.UseAgent,
+		KnownHosts:            sshConfig.KnownHosts,
+		InsecureIgnoreHostKey: sshConfig.InsecureIgnoreHostKey,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &remoteHost{Client: client, cfg: sshConfig}, nil
+}
+
+// hostAddr returns "host:port", keeping a port given with the host
+func hostAddr(host string, port int) string {
+	if _, _, err := net.SplitHostPort(host); err == nil {
+		return host
+	}
+	if port == 0 {
+		port = defaultSSHPort
+	}
+	return net.JoinHostPort(host, strconv.Itoa(port))
+}
+
+func (r *remoteHost) name() string {
+	return r.cfg.RemoteHost
+}
+
+// base returns the remote directory deployed to
+func (r *remoteHost) base() string {
+	return strings.TrimRight(r.cfg.RemotePath, "/")
+}
+
+// run executes a shell command on the host, the output is part of the error
+func (r *remoteHost) run(ctx context.Context, remoteCmd string) (string, error) {
+	output, err := r.Run(ctx, remoteCmd)
+	if err != nil {
+		return output, fmt.Errorf("%v\nOutput: %s", err, output)
+	}
+	return output, nil
+}
+
+// sync copies the build output into dest, hard-linking files unchanged since linkDest
+func (r *remoteHost) sync(ctx context.Context, srcDir, dest, linkDest string) error {
+	stats, err := r.Sync(ctx, srcDir, dest, sshclient.SyncOptions{LinkDest: linkDest})
+	if err != nil {
+		return fmt.Errorf("sync to %s failed: %v", r.name(), err)
+	}
+	logrus.Infof("Synced %s to %s:%s (%d uploaded, %d bytes; %d linked; %d unchanged)",
+		srcDir, r.name(), dest, stats.Uploaded, stats.Bytes, stats.Linked, stats.Unchanged)
+	return nil
+}
+
+// shellQuote quotes s for the remote shell
+func shellQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'"'"'`) + "'"
+}
@@ -1,6 +1,7 @@
 package pipeline
 
 import (
+	"context"
 	"fmt"
 	"os"
 	"os/exec"
@@ -10,7 +11,7 @@ import (
 	"github.com/sirupsen/logrus"
 )
 
-func (p *Pipeline) test() error {
+func (p *Pipeline) test(ctx context.Context) error {
 	logrus.Info("Starting test stage...")
 
 	if p.cfg.Test.Type == "" {
@@ -34,9 +35,9 @@ func (p *Pipeline) test() error {
 		}
 		logrus.Infof("Running .NET tests for %s", testFile)
 		testCmdFunc = func() *exec.Cmd {
-			cmd := exec.Command("dotnet", "test", testFile, "--configuration", "Release",
+			cmd := executor.CommandContext(ctx, "dotnet", "test", testFile, "--configuration", "Release",
 				"--logger", "trx", "--results-directory", testOutputDir)
-			cmd.Env = append(os.Environ(), "DOTNET_CLI_TELEMETRY_OPTOUT=1")
+			cmd.Env = append(p.environ(), "DOTNET_CLI_TELEMETRY_OPTOUT=1")
 			cmd.Dir = p.repoPath
 			return cmd
 		}
@@ -48,8 +49,8 @@ func (p *Pipeline) test() error {
 		}
 		logrus.Infof("Running Java tests with Maven: %s", testFile)
 		testCmdFunc = func() *exec.Cmd {
-			cmd := exec.Command("mvn", "test", "-f", testFile)
-			cmd.Env = os.Environ()
+			cmd := executor.CommandContext(ctx, "mvn", "test", "-f", testFile)
+			cmd.Env = p.environ()
 			cmd.Dir = p.repoPath
 			return cmd
 		}
@@ -59,6 +60,9 @@ func (p *Pipeline) test() error {
 	}
 
 	for attempt := 1; attempt <= 3; attempt++ {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
 		cmd := testCmdFunc()
 		output, err := executor.RunWithOutput(cmd)
 		if err == nil {
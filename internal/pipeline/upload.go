@@ -0,0 +1,152 @@
+package pipeline
+
+import (
+	"context"
+	"crypto/md5"
+	"crypto/sha1"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/khaledibrahim1015/goFlow-cicd/internal/config"
+	"github.com/sirupsen/logrus"
+)
+
+const defaultUploadTimeout = 5 * time.Minute
+
+// deployHTTPUpload sends every file of the build output to the artifact
+// repository, each to the configured URL followed by its relative path
+func (p *Pipeline) deployHTTPUpload(ctx context.Context) error {
+	upload := p.cfg.Deploy.HTTPUpload
+	if upload == nil || upload.URL == "" {
+		return fmt.Errorf("http_upload url missing")
+	}
+	srcDir := p.cfg.Build.OutputPath
+	if _, err := os.Stat(srcDir); os.IsNotExist(err) {
+		return fmt.Errorf("build artifacts not found at %s", srcDir)
+	}
+	baseURL, err := p.uploadURL(upload.URL)
+	if err != nil {
+		return err
+	}
+	p.deployment.Path = baseURL
+
+	client := &http.Client{Timeout: parseDurationOr(upload.Timeout, defaultUploadTimeout)}
+	files := 0
+	var total int64
+	err = filepath.WalkDir(srcDir, func(localPath string, entry fs.DirEntry, err error) error {
+		if err != nil || !entry.Type().IsRegular() {
+			return err
+		}
+		rel, err := filepath.Rel(srcDir, localPath)
+		if err != nil {
+			return err
+		}
+		target, err := url.JoinPath(baseURL, strings.Split(filepath.ToSlash(rel), "/")...)
+		if err != nil {
+			return err
+		}
+		n, err := p.uploadFile(ctx, client, upload, localPath, target)
+		if err != nil {
+			return fmt.Errorf("upload of %s failed: %v", rel, err)
+		}
+		logrus.Debugf("Uploaded %s to %s", rel, target)
+		files++
+		total += n
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	logrus.Infof("Uploaded %d file(s), %d bytes, to %s", files, total, baseURL)
+
+	if err := p.runLocalPostDeploy(ctx, append(p.environ(), "GOFLOW_UPLOAD_URL="+baseURL)); err != nil {
+		return err
+	}
+	logrus.Info("HTTP upload deployment successful")
+	return nil
+}
+
+// uploadURL fills the "{commit}" and "{ref}" placeholders of the configured URL
+func (p *Pipeline) uploadURL(rawURL string) (string, error) {
+	if strings.Contains(rawURL, "{commit}") {
+		commit, err := p.resolveCommit()
+		if err != nil {
+			return "", err
+		}
+		rawURL = strings.ReplaceAll(rawURL, "{commit}", commit)
+	}
+	ref := p.ref
+	for _, prefix := range []string{"refs/heads/", "refs/tags/"} {
+		ref = strings.TrimPrefix(ref, prefix)
+	}
+	return strings.ReplaceAll(rawURL, "{ref}", url.PathEscape(ref)), nil
+}
+
+// uploadFile sends one file with its checksums and returns its size
+func (p *Pipeline) uploadFile(ctx context.Context, client *http.Client, upload *config.HTTPUploadConfig, localPath, target string) (int64, error) {
+	f, err := os.Open(localPath)
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+	sha1Sum, sha256Sum, md5Sum := sha1.New(), sha256.New(), md5.New()
+	size, err := io.Copy(io.MultiWriter(sha1Sum, sha256Sum, md5Sum), f)
+	if err != nil {
+		return 0, err
+	}
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
+		return 0, err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, strings.ToUpper(valueOr(upload.Method, http.MethodPut)), target, f)
+	if err != nil {
+		return 0, err
+	}
+	req.ContentLength = size
+	req.Header.Set("Content-Type", "application/octet-stream")
+	req.Header.Set("X-Checksum-Sha1", hex.EncodeToString(sha1Sum.Sum(nil)))
+	req.Header.Set("X-Checksum-Sha256", hex.EncodeToString(sha256Sum.Sum(nil)))
+	req.Header.Set("X-Checksum-Md5", hex.EncodeToString(md5Sum.Sum(nil)))
+	for key, value := range upload.Headers {
+		req.Header.Set(key, p.expandVars(value))
+	}
+	switch {
+	case upload.Token != "":
+		req.Header.Set("Authorization", "Bearer "+p.expandVars(upload.Token))
+	case upload.Username != "":
+		req.SetBasicAuth(p.expandVars(upload.Username), p.expandVars(upload.Password))
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return 0, fmt.Errorf("%s %s returned %s: %s", req.Method, target, resp.Status, strings.TrimSpace(string(body)))
+	}
+	io.Copy(io.Discard, resp.Body)
+	return size, nil
+}
+
+// expandVars replaces $VAR and ${VAR} with the run variables, e.g. the
+// secrets of the environment, or else the process environment
+func (p *Pipeline) expandVars(s string) string {
+	vars := p.envMap()
+	return os.Expand(s, func(key string) string {
+		if value, ok := vars[key]; ok {
+			return value
+		}
+		return os.Getenv(key)
+	})
+}
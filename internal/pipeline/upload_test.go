@@ -0,0 +1,84 @@
+package pipeline
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/khaledibrahim1015/goFlow-cicd/internal/config"
+)
+
+func TestDeployHTTPUpload(t *testing.T) {
+	var mu sync.Mutex
+	uploads := map[string]string{}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		user, password, _ := r.BasicAuth()
+		body, _ := io.ReadAll(r.Body)
+		sum := sha256.Sum256(body)
+		switch {
+		case r.Method != http.MethodPut || user != "ci" || password != "s3cret":
+			http.Error(w, "denied", http.StatusUnauthorized)
+		case r.Header.Get("X-Checksum-Sha256") != hex.EncodeToString(sum[:]):
+			http.Error(w, "checksum mismatch", http.StatusBadRequest)
+		case strings.HasSuffix(r.URL.Path, "/broken.bin"):
+			http.Error(w, "storage full", http.StatusInsufficientStorage)
+		default:
+			mu.Lock()
+			uploads[r.URL.Path] = string(body)
+			mu.Unlock()
+			w.WriteHeader(http.StatusCreated)
+		}
+	}))
+	defer srv.Close()
+
+	out := t.TempDir()
+	os.MkdirAll(filepath.Join(out, "lib"), 0755)
+	os.WriteFile(filepath.Join(out, "app.jar"), []byte("jar"), 0644)
+	os.WriteFile(filepath.Join(out, "lib", "dep.jar"), []byte("dep"), 0644)
+
+	p := New(&config.PipelineConfig{
+		Build: config.BuildConfig{OutputPath: out},
+		Deploy: config.DeployConfig{Method: "http_upload", HTTPUpload: &config.HTTPUploadConfig{
+			URL:      srv.URL + "/repository/raw/app/{ref}/{commit}",
+			Username: "ci",
+			Password: "$UPLOAD_PASSWORD",
+		}},
+	}, t.TempDir())
+	p.SetRevision("refs/tags/v1.2.0", "abc123")
+	p.SetDeployEnv(map[string]string{"UPLOAD_PASSWORD": "s3cret"})
+	if err := p.deploy(context.Background()); err != nil {
+		t.Fatalf("deploy: %v", err)
+	}
+	want := map[string]string{
+		"/repository/raw/app/v1.2.0/abc123/app.jar":     "jar",
+		"/repository/raw/app/v1.2.0/abc123/lib/dep.jar": "dep",
+	}
+	if len(uploads) != len(want) {
+		t.Errorf("uploads = %v", uploads)
+	}
+	for path, content := range want {
+		if uploads[path] != content {
+			t.Errorf("%s = %q, want %q", path, uploads[path], content)
+		}
+	}
+	if got := p.Deployment().Path; got != srv.URL+"/repository/raw/app/v1.2.0/abc123" {
+		t.Errorf("deployment path = %q", got)
+	}
+
+	os.WriteFile(filepath.Join(out, "broken.bin"), []byte("x"), 0644)
+	p = New(p.cfg, t.TempDir())
+	p.SetRevision("refs/tags/v1.2.0", "abc123")
+	p.SetDeployEnv(map[string]string{"UPLOAD_PASSWORD": "s3cret"})
+	err := p.deploy(context.Background())
+	if err == nil || !strings.Contains(err.Error(), "storage full") {
+		t.Errorf("err = %v", err)
+	}
+}
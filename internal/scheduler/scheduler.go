@@ -0,0 +1,88 @@
+package scheduler
+
+import (
+	"context"
+	"time"
+
+	"github.com/khaledibrahim1015/goFlow-cicd/internal/config"
+	"github.com/khaledibrahim1015/goFlow-cicd/internal/git"
+	"github.com/khaledibrahim1015/goFlow-cicd/internal/status"
+	"github.com/khaledibrahim1015/goFlow-cicd/pkg/cron"
+	"github.com/sirupsen/logrus"
+)
+
+// Scheduler starts pipelines for the cron schedules of each repository
+type Scheduler struct {
+	cfg *config.PipelineConfig
+	// Clock and pipeline start, faked by tests
+	now   func() time.Time
+	after func(time.Duration) <-chan time.Time
+	start func(*config.PipelineConfig, git.RunRequest) (string, error)
+}
+
+func New(cfg *config.PipelineConfig) *Scheduler {
+	return &Scheduler{cfg: cfg, now: time.Now, after: time.After, start: git.StartPipeline}
+}
+
+// Start launches one timer loop per configured schedule, they stop when ctx is done
+func (s *Scheduler) Start(ctx context.Context) {
+	for i := range s.cfg.Repositories {
+		repo := &s.cfg.Repositories[i]
+		for _, schedule := range repo.Schedules {
+			expr, err := cron.Parse(schedule.Cron)
+			if err != nil {
+				logrus.Warnf("Invalid schedule %q for %s: %v", schedule.Cron, repo.URL, err)
+				continue
+			}
+			loc, err := time.LoadLocation(schedule.Timezone)
+			if err != nil {
+				logrus.Warnf("Invalid timezone %q for %s: %v", schedule.Timezone, repo.URL, err)
+				continue
+			}
+			logrus.Infof("Scheduled %s (branch: %s) at %q (%s)", repo.URL, repo.Branch, schedule.Cron, loc)
+			go s.loop(ctx, repo, schedule.Cron, expr, loc)
+		}
+	}
+}
+
+func (s *Scheduler) loop(ctx context.Context, repo *config.RepositoryConfig, spec string, expr *cron.Schedule, loc *time.Location) {
+	var lastRunID string
+	for {
+		next := expr.Next(s.now().In(loc))
+		if next.IsZero() {
+			logrus.Warnf("Schedule %q for %s never fires, stopping", spec, repo.URL)
+			return
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-s.after(next.Sub(s.now())):
+		}
+
+		// Skip this tick while the previous scheduled run is still going
+		if lastRunID != "" && status.IsActive(lastRunID) {
+			logrus.Warnf("Skipping schedule %q for %s: run %s still in progress", spec, repo.URL, lastRunID)
+			continue
+		}
+		lastRunID = s.trigger(repo, spec)
+	}
+}
+
+func (s *Scheduler) trigger(repo *config.RepositoryConfig, spec string) string {
+	// The sha is only needed for commit statuses, so a failed lookup is not fatal
+	sha, err := git.LsRemote(repo.URL, repo.Branch)
+	if err != nil {
+		logrus.Warnf("Could not resolve %s@%s for schedule %q: %v", repo.URL, repo.Branch, spec, err)
+	}
+	logrus.Infof("Schedule %q fired for %s (branch: %s)", spec, repo.URL, repo.Branch)
+	runID, err := s.start(s.cfg, git.RunRequest{
+		Repo:    repo,
+		Ref:     "refs/heads/" + repo.Branch,
+		SHA:     sha,
+		Trigger: git.TriggerSchedule,
+	})
+	if err != nil {
+		logrus.Errorf("Scheduled pipeline %s for %s could not start: %v", runID, repo.URL, err)
+	}
+	return runID
+}
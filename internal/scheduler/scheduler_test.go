@@ -0,0 +1,94 @@
+package scheduler
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/khaledibrahim1015/goFlow-cicd/internal/config"
+	"github.com/khaledibrahim1015/goFlow-cicd/internal/git"
+	"github.com/khaledibrahim1015/goFlow-cicd/internal/status"
+)
+
+// fakeClock hands out the waits of the loop and fires them when told to
+type fakeClock struct {
+	mu    sync.Mutex
+	now   time.Time
+	waits chan time.Duration
+	fire  chan time.Time
+}
+
+func (c *fakeClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+func (c *fakeClock) After(d time.Duration) <-chan time.Time {
+	c.waits <- d
+	return c.fire
+}
+
+// advance waits for the loop to sleep, checks for how long, then wakes it up
+func (c *fakeClock) advance(t *testing.T, want time.Duration) {
+	t.Helper()
+	select {
+	case d := <-c.waits:
+		if d != want {
+			t.Fatalf("waits %v, want %v", d, want)
+		}
+		c.mu.Lock()
+		c.now = c.now.Add(d)
+		c.mu.Unlock()
+		c.fire <- c.Now()
+	case <-time.After(5 * time.Second):
+		t.Fatal("loop is not waiting")
+	}
+}
+
+func TestScheduleFiresAndStops(t *testing.T) {
+	clock := &fakeClock{
+		now:   time.Date(2026, 10, 19, 1, 30, 0, 0, time.UTC),
+		waits: make(chan time.Duration),
+		fire:  make(chan time.Time),
+	}
+	cfg := &config.PipelineConfig{Repositories: []config.RepositoryConfig{{
+		URL: "http://127.0.0.1:1/app.git", Branch: "main",
+		Schedules: []config.ScheduleConfig{{Cron: "0 2 * * *", Timezone: "UTC"}},
+	}}}
+	s := New(cfg)
+	s.now, s.after = clock.Now, clock.After
+	started := make(chan git.RunRequest, 2)
+	s.start = func(_ *config.PipelineConfig, req git.RunRequest) (string, error) {
+		started <- req
+		status.Register(status.PipelineStatus{ID: "nightly1", Status: "running"})
+		return "nightly1", nil
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	s.Start(ctx)
+
+	clock.advance(t, 30*time.Minute)
+	clock.advance(t, 24*time.Hour) // waiting for the next night means the first run started
+	if req := <-started; req.Trigger != git.TriggerSchedule || req.Ref != "refs/heads/main" {
+		t.Errorf("started %+v", req)
+	}
+	// The first run is still going, so the second night is skipped
+	clock.advance(t, 24*time.Hour)
+	cancel()
+	if d := <-clock.waits; d != 24*time.Hour {
+		t.Errorf("waits %v for the third night", d)
+	}
+	select {
+	case req := <-started:
+		t.Errorf("started %+v while the previous run was active", req)
+	default:
+	}
+
+	// Cancelled while waiting, the loop stops instead of waiting again
+	select {
+	case d := <-clock.waits:
+		t.Errorf("loop kept waiting (%v) after cancel", d)
+	case <-time.After(100 * time.Millisecond):
+	}
+}
@@ -0,0 +1,124 @@
+package server
+
+import (
+	"bytes"
+	"compress/gzip"
+	"compress/zlib"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// compressMinSize keeps small responses uncompressed, the headers would outweigh the gain
+const compressMinSize = 1024
+
+// Compress gzips or deflates response bodies for clients that accept it.
+// Only textual content types are compressed, partial content never is.
+func Compress(ctx *HttpContext, next HandlerFunc) {
+	next(ctx)
+
+	res := ctx.Response
+	addVary(res, "Accept-Encoding")
+	if len(res.Body) < compressMinSize || !bodyAllowed(res.StatusCode) || res.StatusCode == StatusPartialContent {
+		return
+	}
+	if _, ok := res.Headers["Content-Encoding"]; ok || !compressible(res.Headers["Content-Type"]) {
+		return
+	}
+	acceptEncoding, _ := ctx.Request.GetHeader("Accept-Encoding")
+	encoding := negotiateEncoding(acceptEncoding)
+	if encoding == "" {
+		return
+	}
+
+	var buf bytes.Buffer
+	var w io.WriteCloser
+	if encoding == "gzip" {
+		w = gzip.NewWriter(&buf)
+	} else {
+		w = zlib.NewWriter(&buf) // "deflate" in HTTP is the zlib format (RFC 9110)
+	}
+	if _, err := w.Write(res.Body); err != nil {
+		return
+	}
+	if err := w.Close(); err != nil {
+		return
+	}
+	res.Body = buf.Bytes()
+	res.Headers["Content-Encoding"] = encoding
+	delete(res.Headers, "Content-Length")
+	if etag, ok := res.Headers["ETag"]; ok && !strings.HasPrefix(etag, "W/") {
+		res.Headers["ETag"] = "W/" + etag // the bytes differ from the identity representation
+	}
+}
+
+// negotiateEncoding picks gzip or deflate from an Accept-Encoding header, "" for neither
+func negotiateEncoding(header string) string {
+	best, bestQ := "", 0.0
+	for _, offer := range []string{"gzip", "deflate"} {
+		if q := acceptQuality(header, offer, "*"); q > bestQ {
+			best, bestQ = offer, q
+		}
+	}
+	return best
+}
+
+func compressible(contentType string) bool {
+	mediaType := strings.ToLower(strings.TrimSpace(strings.Split(contentType, ";")[0]))
+	switch {
+	case strings.HasPrefix(mediaType, "text/"):
+		return true
+	case mediaType == APPLICATION_JSON, mediaType == "application/javascript",
+		mediaType == "application/xml", mediaType == "image/svg+xml":
+		return true
+	}
+	return false
+}
+
+// addVary appends a header name to the Vary header of the response
+func addVary(res *HttpResponse, name string) {
+	vary, ok := res.Headers["Vary"]
+	if !ok || vary == "" {
+		res.Headers["Vary"] = name
+		return
+	}
+	for _, existing := range strings.Split(vary, ",") {
+		if strings.EqualFold(strings.TrimSpace(existing), name) {
+			return
+		}
+	}
+	res.Headers["Vary"] = vary + ", " + name
+}
+
+// acceptQuality returns the q-value a comma separated Accept-style header gives
+// to value. wildcards are the broader patterns also covering value, most
+// specific first (e.g. "text/*", "*/*"); the most specific one listed wins.
+func acceptQuality(header, value string, wildcards ...string) float64 {
+	patterns := append([]string{value}, wildcards...)
+	qualities := map[string]float64{}
+	for _, part := range strings.Split(header, ",") {
+		fields := strings.Split(part, ";")
+		name := strings.ToLower(strings.TrimSpace(fields[0]))
+		if name == "" {
+			continue
+		}
+		q := 1.0
+		for _, param := range fields[1:] {
+			key, val, _ := strings.Cut(strings.TrimSpace(param), "=")
+			if strings.EqualFold(strings.TrimSpace(key), "q") {
+				if parsed, err := strconv.ParseFloat(strings.TrimSpace(val), 64); err == nil {
+					q = parsed
+				}
+			}
+		}
+		if existing, ok := qualities[name]; !ok || q > existing {
+			qualities[name] = q
+		}
+	}
+	for _, pattern := range patterns {
+		if q, ok := qualities[pattern]; ok {
+			return q
+		}
+	}
+	return 0
+}
@@ -5,38 +5,167 @@ const (
 	PUT_METHOD       = "PUT"
 	GET_METHOD       = "GET"
 	DELETE_METHOD    = "DELETE"
+	PATCH_METHOD     = "PATCH"
+	HEAD_METHOD      = "HEAD"
+	OPTIONS_METHOD   = "OPTIONS"
 	APPLICATION_JSON = "application/json"
 	TEXT_PLAIN       = "text/plain"
+	TEXT_HTML        = "text/html"
 )
 
-// Status codes as constants
+// Status codes as constants (IANA HTTP status code registry)
 const (
-	StatusOK                  = 200
-	StatusCreated             = 201
-	StatusBadRequest          = 400
-	StatusNotFound            = 404
-	StatusInternalServerError = 500
-	StatusMethodNotAllowed    = 405
+	StatusContinue           = 100
+	StatusSwitchingProtocols = 101
+	StatusProcessing         = 102
+	StatusEarlyHints         = 103
+
+	StatusOK                   = 200
+	StatusCreated              = 201
+	StatusAccepted             = 202
+	StatusNonAuthoritativeInfo = 203
+	StatusNoContent            = 204
+	StatusResetContent         = 205
+	StatusPartialContent       = 206
+	StatusMultiStatus          = 207
+	StatusAlreadyReported      = 208
+	StatusIMUsed               = 226
+
+	StatusMultipleChoices   = 300
+	StatusMovedPermanently  = 301
+	StatusFound             = 302
+	StatusSeeOther          = 303
+	StatusNotModified       = 304
+	StatusUseProxy          = 305
+	StatusTemporaryRedirect = 307
+	StatusPermanentRedirect = 308
+
+	StatusBadRequest                   = 400
+	StatusUnauthorized                 = 401
+	StatusPaymentRequired              = 402
+	StatusForbidden                    = 403
+	StatusNotFound                     = 404
+	StatusMethodNotAllowed             = 405
+	StatusNotAcceptable                = 406
+	StatusProxyAuthRequired            = 407
+	StatusRequestTimeout               = 408
+	StatusConflict                     = 409
+	StatusGone                         = 410
+	StatusLengthRequired               = 411
+	StatusPreconditionFailed           = 412
+	StatusRequestEntityTooLarge        = 413
+	StatusRequestURITooLong            = 414
+	StatusUnsupportedMediaType         = 415
+	StatusRequestedRangeNotSatisfiable = 416
+	StatusExpectationFailed            = 417
+	StatusTeapot                       = 418
+	StatusMisdirectedRequest           = 421
+	StatusUnprocessableEntity          = 422
+	StatusLocked                       = 423
+	StatusFailedDependency             = 424
+	StatusTooEarly                     = 425
+	StatusUpgradeRequired              = 426
+	StatusPreconditionRequired         = 428
+	StatusTooManyRequests              = 429
+	StatusRequestHeaderFieldsTooLarge  = 431
+	StatusUnavailableForLegalReasons   = 451
+
+	StatusInternalServerError           = 500
+	StatusNotImplemented                = 501
+	StatusBadGateway                    = 502
+	StatusServiceUnavailable            = 503
+	StatusGatewayTimeout                = 504
+	StatusHTTPVersionNotSupported       = 505
+	StatusVariantAlsoNegotiates         = 506
+	StatusInsufficientStorage           = 507
+	StatusLoopDetected                  = 508
+	StatusNotExtended                   = 510
+	StatusNetworkAuthenticationRequired = 511
 )
 
 // Status text as constants
 const (
-	StatusTextOK                  = "OK"
-	StatusTextCreated             = "Created"
-	StatusTextBadRequest          = "Bad Request"
-	StatusTextNotFound            = "Not Found"
-	StatusTextInternalServerError = "Internal Server Error"
-	StatusTextMethodNotAllowed    = "Method Not Allowed"
+	StatusTextOK                          = "OK"
+	StatusTextCreated                     = "Created"
+	StatusTextNoContent                   = "No Content"
+	StatusTextBadRequest                  = "Bad Request"
+	StatusTextUnauthorized                = "Unauthorized"
+	StatusTextNotFound                    = "Not Found"
+	StatusTextRequestTimeout              = "Request Timeout"
+	StatusTextRequestEntityTooLarge       = "Request Entity Too Large"
+	StatusTextRequestHeaderFieldsTooLarge = "Request Header Fields Too Large"
+	StatusTextInternalServerError         = "Internal Server Error"
+	StatusTextMethodNotAllowed            = "Method Not Allowed"
 )
 
-// StatusCodeText maps status codes to their text (initialized with constants)
+// StatusCodeText maps status codes to their reason phrase (initialized with constants)
 var StatusCodeText = map[int]string{
-	StatusOK:                  StatusTextOK,
-	StatusCreated:             StatusTextCreated,
-	StatusBadRequest:          StatusTextBadRequest,
-	StatusNotFound:            StatusTextNotFound,
-	StatusInternalServerError: StatusTextInternalServerError,
-	StatusMethodNotAllowed:    StatusTextMethodNotAllowed,
+	StatusContinue:           "Continue",
+	StatusSwitchingProtocols: "Switching Protocols",
+	StatusProcessing:         "Processing",
+	StatusEarlyHints:         "Early Hints",
+
+	StatusOK:                   StatusTextOK,
+	StatusCreated:              StatusTextCreated,
+	StatusAccepted:             "Accepted",
+	StatusNonAuthoritativeInfo: "Non-Authoritative Information",
+	StatusNoContent:            StatusTextNoContent,
+	StatusResetContent:         "Reset Content",
+	StatusPartialContent:       "Partial Content",
+	StatusMultiStatus:          "Multi-Status",
+	StatusAlreadyReported:      "Already Reported",
+	StatusIMUsed:               "IM Used",
+
+	StatusMultipleChoices:   "Multiple Choices",
+	StatusMovedPermanently:  "Moved Permanently",
+	StatusFound:             "Found",
+	StatusSeeOther:          "See Other",
+	StatusNotModified:       "Not Modified",
+	StatusUseProxy:          "Use Proxy",
+	StatusTemporaryRedirect: "Temporary Redirect",
+	StatusPermanentRedirect: "Permanent Redirect",
+
+	StatusBadRequest:                   StatusTextBadRequest,
+	StatusUnauthorized:                 StatusTextUnauthorized,
+	StatusPaymentRequired:              "Payment Required",
+	StatusForbidden:                    "Forbidden",
+	StatusNotFound:                     StatusTextNotFound,
+	StatusMethodNotAllowed:             StatusTextMethodNotAllowed,
+	StatusNotAcceptable:                "Not Acceptable",
+	StatusProxyAuthRequired:            "Proxy Authentication Required",
+	StatusRequestTimeout:               StatusTextRequestTimeout,
+	StatusConflict:                     "Conflict",
+	StatusGone:                         "Gone",
+	StatusLengthRequired:               "Length Required",
+	StatusPreconditionFailed:           "Precondition Failed",
+	StatusRequestEntityTooLarge:        StatusTextRequestEntityTooLarge,
+	StatusRequestURITooLong:            "Request URI Too Long",
+	StatusUnsupportedMediaType:         "Unsupported Media Type",
+	StatusRequestedRangeNotSatisfiable: "Requested Range Not Satisfiable",
+	StatusExpectationFailed:            "Expectation Failed",
+	StatusTeapot:                       "I'm a teapot",
+	StatusMisdirectedRequest:           "Misdirected Request",
+	StatusUnprocessableEntity:          "Unprocessable Entity",
+	StatusLocked:                       "Locked",
+	StatusFailedDependency:             "Failed Dependency",
+	StatusTooEarly:                     "Too Early",
+	StatusUpgradeRequired:              "Upgrade Required",
+	StatusPreconditionRequired:         "Precondition Required",
+	StatusTooManyRequests:              "Too Many Requests",
+	StatusRequestHeaderFieldsTooLarge:  "Request Header Fields Too Large",
+	StatusUnavailableForLegalReasons:   "Unavailable For Legal Reasons",
+
+	StatusInternalServerError:           StatusTextInternalServerError,
+	StatusNotImplemented:                "Not Implemented",
+	StatusBadGateway:                    "Bad Gateway",
+	StatusServiceUnavailable:            "Service Unavailable",
+	StatusGatewayTimeout:                "Gateway Timeout",
+	StatusHTTPVersionNotSupported:       "HTTP Version Not Supported",
+	StatusVariantAlsoNegotiates:         "Variant Also Negotiates",
+	StatusInsufficientStorage:           "Insufficient Storage",
+	StatusLoopDetected:                  "Loop Detected",
+	StatusNotExtended:                   "Not Extended",
+	StatusNetworkAuthenticationRequired: "Network Authentication Required",
 }
 
 // ResponseMessage provides common response messages
@@ -1,6 +1,7 @@
 package server
 
 import (
+	"crypto/tls"
 	"encoding/json"
 	"fmt"
 	"net"
@@ -10,8 +11,16 @@ type HttpContext struct {
 	Request  *HttpRequest
 	Response *HttpResponse
 	conn     net.Conn // Private, used to write the response
+	values   map[string]interface{}
+	tlsState *tls.ConnectionState // set when the request came through net/http
 }
 
+// Context keys set by the built-in middleware
+const (
+	ContextKeyRequestID = "request_id"
+	ContextKeyUser      = "user"
+)
+
 func NewHttpContext(conn net.Conn, req *HttpRequest) *HttpContext {
 	return &HttpContext{
 		Request:  req,
@@ -26,7 +35,6 @@ func (ctx *HttpContext) JSON(statusCode int, obj interface{}) error {
 	}
 	ctx.Response.StatusCode = statusCode
 	ctx.Response.Body = data
-	// if ctx.Request.GetHeader("accept-")
 	ctx.Response.Headers["Content-Type"] = APPLICATION_JSON
 	return nil
 
@@ -42,10 +50,48 @@ func (ctx *HttpContext) Query(key string) (string, error) {
 	return ctx.Request.GetQueryParam(key)
 }
 
+// QueryArray returns every value of a repeated query parameter, e.g. ?status=failed&status=cancelled
+func (ctx *HttpContext) QueryArray(key string) []string {
+	return ctx.Request.GetQueryParams(key)
+}
+
 func (ctx *HttpContext) Param(key string) (string, error) {
 	return ctx.Request.GetPathParam(key)
 }
 
+// TLSState returns the TLS connection state, or nil for plain connections
+func (ctx *HttpContext) TLSState() *tls.ConnectionState {
+	if ctx.tlsState != nil {
+		return ctx.tlsState
+	}
+	tlsConn, ok := ctx.conn.(*tls.Conn)
+	if !ok {
+		return nil
+	}
+	state := tlsConn.ConnectionState()
+	return &state
+}
+
+// Set stores a value for later middleware and handlers of the same request
+func (ctx *HttpContext) Set(key string, value interface{}) {
+	if ctx.values == nil {
+		ctx.values = make(map[string]interface{})
+	}
+	ctx.values[key] = value
+}
+
+// Get returns a value stored with Set
+func (ctx *HttpContext) Get(key string) (interface{}, bool) {
+	value, ok := ctx.values[key]
+	return value, ok
+}
+
+// GetString returns a string value stored with Set, or "" when missing
+func (ctx *HttpContext) GetString(key string) string {
+	value, _ := ctx.values[key].(string)
+	return value
+}
+
 func (ctx *HttpContext) WriteResponse() error {
 	return ctx.Response.Write(ctx.conn)
 }
@@ -0,0 +1,74 @@
+package server
+
+import "strings"
+
+// RouteGroup registers routes under a common path prefix with shared middleware:
+//
+//	api := serv.Group("/api/v1", auth)
+//	api.GET("/runs/:id", handler) // GET /api/v1/runs/:id through auth
+type RouteGroup struct {
+	router     *Router
+	prefix     string
+	middleware []MiddlewareFunc
+}
+
+// Group returns a group of routes under prefix, running middleware before the route middleware
+func (r *Router) Group(prefix string, middleware ...MiddlewareFunc) *RouteGroup {
+	return &RouteGroup{router: r, prefix: strings.TrimRight(prefix, "/"), middleware: middleware}
+}
+
+func (s *Server) Group(prefix string, middleware ...MiddlewareFunc) *RouteGroup {
+	return s.Router.Group(prefix, middleware...)
+}
+
+// Group returns a nested group, inheriting the prefix and middleware of g
+func (g *RouteGroup) Group(prefix string, middleware ...MiddlewareFunc) *RouteGroup {
+	return &RouteGroup{
+		router:     g.router,
+		prefix:     g.prefix + strings.TrimRight(prefix, "/"),
+		middleware: append(append([]MiddlewareFunc{}, g.middleware...), middleware...),
+	}
+}
+
+// Use adds middleware to the routes registered on the group afterwards
+func (g *RouteGroup) Use(middleware ...MiddlewareFunc) {
+	g.middleware = append(g.middleware, middleware...)
+}
+
+func (g *RouteGroup) handle(method, path string, handler HandlerFunc, middleware []MiddlewareFunc) {
+	all := append(append([]MiddlewareFunc{}, g.middleware...), middleware...)
+	g.router.handle(method, g.prefix+path, handler, all)
+}
+
+func (g *RouteGroup) GET(path string, handler HandlerFunc, middleware ...MiddlewareFunc) {
+	g.handle(GET_METHOD, path, handler, middleware)
+}
+
+func (g *RouteGroup) POST(path string, handler HandlerFunc, middleware ...MiddlewareFunc) {
+	g.handle(POST_METHOD, path, handler, middleware)
+}
+
+func (g *RouteGroup) PUT(path string, handler HandlerFunc, middleware ...MiddlewareFunc) {
+	g.handle(PUT_METHOD, path, handler, middleware)
+}
+
+func (g *RouteGroup) DELETE(path string, handler HandlerFunc, middleware ...MiddlewareFunc) {
+	g.handle(DELETE_METHOD, path, handler, middleware)
+}
+
+func (g *RouteGroup) PATCH(path string, handler HandlerFunc, middleware ...MiddlewareFunc) {
+	g.handle(PATCH_METHOD, path, handler, middleware)
+}
+
+func (g *RouteGroup) HEAD(path string, handler HandlerFunc, middleware ...MiddlewareFunc) {
+	g.handle(HEAD_METHOD, path, handler, middleware)
+}
+
+func (g *RouteGroup) OPTIONS(path string, handler HandlerFunc, middleware ...MiddlewareFunc) {
+	g.handle(OPTIONS_METHOD, path, handler, middleware)
+}
+
+// Static serves the files under root at prefix within the group, see Router.Static
+func (g *RouteGroup) Static(prefix, root string, middleware ...MiddlewareFunc) {
+	g.GET(strings.TrimRight(prefix, "/")+"/*"+staticPathParam, StaticFiles(root), middleware...)
+}
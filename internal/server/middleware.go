@@ -0,0 +1,108 @@
+package server
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"runtime/debug"
+	"strings"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// RequestID tags every request with an id, reusing the client's X-Request-ID when present
+func RequestID(ctx *HttpContext, next HandlerFunc) {
+	id, err := ctx.Request.GetHeader("X-Request-ID")
+	if err != nil || id == "" {
+		buf := make([]byte, 8)
+		rand.Read(buf)
+		id = hex.EncodeToString(buf)
+	}
+	ctx.Set(ContextKeyRequestID, id)
+	ctx.Response.Headers["X-Request-ID"] = id
+	next(ctx)
+}
+
+// AccessLog logs method, path, status and duration of every request
+func AccessLog(ctx *HttpContext, next HandlerFunc) {
+	start := time.Now()
+	next(ctx)
+	logrus.WithFields(logrus.Fields{
+		"request_id": ctx.GetString(ContextKeyRequestID),
+		"user":       ctx.GetString(ContextKeyUser),
+		"duration":   time.Since(start).String(),
+	}).Infof("%s %s %d", ctx.Request.Method, ctx.Request.Path, ctx.Response.StatusCode)
+}
+
+// Recovery turns a panicking handler into a 500 response instead of a dropped connection
+func Recovery(ctx *HttpContext, next HandlerFunc) {
+	defer func() {
+		if rec := recover(); rec != nil {
+			logrus.WithField("request_id", ctx.GetString(ContextKeyRequestID)).
+				Errorf("Panic serving %s %s: %v\n%s", ctx.Request.Method, ctx.Request.Path, rec, debug.Stack())
+			// The panic value stays in the log, the client gets the id to find it there
+			id := ctx.GetString(ContextKeyRequestID)
+			ctx.Response = NewResponse(StatusInternalServerError, nil)
+			if id != "" {
+				ctx.Response.Headers["X-Request-ID"] = id
+			}
+			ctx.JSON(StatusInternalServerError, Generalesponse{
+				"error":      "Internal server error",
+				"request_id": id,
+				"message":    StatusCodeText[StatusInternalServerError],
+			})
+		}
+	}()
+	next(ctx)
+}
+
+// CORS allows browsers on the given origins ("*" for any) to call the API
+// and answers preflight OPTIONS requests directly
+func CORS(allowedOrigins ...string) MiddlewareFunc {
+	return func(ctx *HttpContext, next HandlerFunc) {
+		origin, err := ctx.Request.GetHeader("Origin")
+		if err != nil || !originAllowed(origin, allowedOrigins) {
+			next(ctx)
+			return
+		}
+		ctx.Response.Headers["Access-Control-Allow-Origin"] = origin
+		ctx.Response.Headers["Vary"] = "Origin"
+
+		if ctx.Request.Method == OPTIONS_METHOD {
+			ctx.Response.Headers["Access-Control-Allow-Methods"] = "GET, HEAD, POST, PUT, PATCH, DELETE, OPTIONS"
+			ctx.Response.Headers["Access-Control-Allow-Headers"] = "Authorization, Content-Type, X-Request-ID"
+			ctx.Response.Headers["Access-Control-Max-Age"] = "600"
+			ctx.Response.StatusCode = StatusNoContent
+			return
+		}
+		next(ctx)
+	}
+}
+
+func originAllowed(origin string, allowedOrigins []string) bool {
+	for _, allowed := range allowedOrigins {
+		if allowed == "*" || strings.EqualFold(allowed, origin) {
+			return true
+		}
+	}
+	return false
+}
+
+// BearerAuth rejects requests without a valid "Authorization: Bearer <token>" header.
+// validate returns the user owning the token; it is stored under ContextKeyUser.
+func BearerAuth(validate func(token string) (string, bool)) MiddlewareFunc {
+	return func(ctx *HttpContext, next HandlerFunc) {
+		header, err := ctx.Request.GetHeader("Authorization")
+		if err == nil && strings.HasPrefix(header, "Bearer ") {
+			if user, ok := validate(strings.TrimPrefix(header, "Bearer ")); ok {
+				ctx.Set(ContextKeyUser, user)
+				next(ctx)
+				return
+			}
+		}
+		ctx.JSON(StatusUnauthorized, Generalesponse{
+			"error":   "Invalid or missing API token",
+			"message": StatusCodeText[StatusUnauthorized],
+		})
+	}
+}
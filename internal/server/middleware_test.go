@@ -0,0 +1,98 @@
+package server
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func middlewareServer(t *testing.T) *httptest.Server {
+	serv := NewHttpServer(":0")
+	serv.Use(RequestID, Recovery, CORS("https://app.example.com"))
+	serv.GET("/panic", func(ctx *HttpContext) {
+		panic("db password is hunter2")
+	})
+	serv.GET("/me", func(ctx *HttpContext) {
+		ctx.JSON(StatusOK, Generalesponse{"user": ctx.GetString(ContextKeyUser)})
+	}, BearerAuth(func(token string) (string, bool) {
+		return "alice", token == "secret"
+	}))
+	ts := httptest.NewServer(serv)
+	t.Cleanup(ts.Close)
+	return ts
+}
+
+func doRequest(t *testing.T, method, url string, headers map[string]string) (*http.Response, string) {
+	t.Helper()
+	req, _ := http.NewRequest(method, url, nil)
+	for key, value := range headers {
+		req.Header.Set(key, value)
+	}
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, _ := io.ReadAll(res.Body)
+	res.Body.Close()
+	return res, string(body)
+}
+
+func TestRecoveryHidesPanic(t *testing.T) {
+	ts := middlewareServer(t)
+	res, body := doRequest(t, "GET", ts.URL+"/panic", map[string]string{"X-Request-ID": "req-42"})
+	if res.StatusCode != StatusInternalServerError || strings.Contains(body, "hunter2") {
+		t.Fatalf("code = %d, body = %s", res.StatusCode, body)
+	}
+	var payload map[string]string
+	if err := json.Unmarshal([]byte(body), &payload); err != nil || payload["request_id"] != "req-42" {
+		t.Errorf("body = %s, %v", body, err)
+	}
+	if res.Header.Get("X-Request-ID") != "req-42" {
+		t.Errorf("X-Request-ID = %q", res.Header.Get("X-Request-ID"))
+	}
+}
+
+func TestRequestIDGenerated(t *testing.T) {
+	ts := middlewareServer(t)
+	first, _ := doRequest(t, "GET", ts.URL+"/me", nil)
+	second, _ := doRequest(t, "GET", ts.URL+"/me", nil)
+	id := first.Header.Get("X-Request-ID")
+	if len(id) != 16 || id == second.Header.Get("X-Request-ID") {
+		t.Errorf("request ids = %q, %q", id, second.Header.Get("X-Request-ID"))
+	}
+}
+
+func TestCORS(t *testing.T) {
+	ts := middlewareServer(t)
+	res, body := doRequest(t, "OPTIONS", ts.URL+"/me", map[string]string{
+		"Origin": "https://app.example.com", "Access-Control-Request-Method": "GET",
+	})
+	if res.StatusCode != StatusNoContent || body != "" {
+		t.Errorf("preflight: code = %d, body = %q", res.StatusCode, body)
+	}
+	if res.Header.Get("Access-Control-Allow-Origin") != "https://app.example.com" ||
+		!strings.Contains(res.Header.Get("Access-Control-Allow-Headers"), "Authorization") {
+		t.Errorf("preflight headers = %v", res.Header)
+	}
+
+	res, _ = doRequest(t, "GET", ts.URL+"/me", map[string]string{"Origin": "https://evil.example.com"})
+	if got := res.Header.Get("Access-Control-Allow-Origin"); got != "" {
+		t.Errorf("other origin allowed: %q", got)
+	}
+}
+
+func TestBearerAuth(t *testing.T) {
+	ts := middlewareServer(t)
+	for _, header := range []string{"", "Bearer wrong", "Basic secret"} {
+		if res, _ := doRequest(t, "GET", ts.URL+"/me", map[string]string{"Authorization": header}); res.StatusCode != StatusUnauthorized {
+			t.Errorf("Authorization %q: code = %d", header, res.StatusCode)
+		}
+	}
+	res, body := doRequest(t, "GET", ts.URL+"/me", map[string]string{"Authorization": "Bearer secret"})
+	if res.StatusCode != StatusOK || body != `{"user":"alice"}` {
+		t.Errorf("code = %d, body = %s", res.StatusCode, body)
+	}
+}
@@ -0,0 +1,233 @@
+package server
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+// Bridge between goFlow handlers and net/http, in both directions:
+//
+//	http.ListenAndServe(addr, serv)          // goFlow routes and middleware under net/http
+//	httptest.NewRecorder() + router.ServeHTTP // handler tests
+//	router.Handle("GET", "/metrics", h)       // net/http handler on a goFlow route
+//	serv.Use(WrapMiddleware(mw))              // net/http middleware in the goFlow chain
+
+// ServeHTTP serves the routes with the server middleware, so the Server can
+// run under net/http (http.ListenAndServe(addr, serv)) or httptest.NewServer
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	serveHTTP(w, r, s.MaxBodySize, s.serve)
+}
+
+// ServeHTTP serves the routes without any server middleware
+func (r *Router) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	serveHTTP(w, req, DefaultMaxBodySize, r.Dispatch)
+}
+
+func serveHTTP(w http.ResponseWriter, r *http.Request, maxBodySize int64, serve HandlerFunc) {
+	req, err := NewRequestFromHTTP(r, maxBodySize)
+	if err != nil {
+		code := StatusBadRequest
+		var maxErr *http.MaxBytesError
+		if errors.As(err, &maxErr) {
+			code = StatusRequestEntityTooLarge
+		}
+		http.Error(w, StatusCodeText[code], code)
+		return
+	}
+	ctx := &HttpContext{Request: req, Response: NewResponse(StatusOK, nil), tlsState: r.TLS}
+	serve(ctx)
+	writeHTTPResponse(w, ctx.Response)
+}
+
+// NewRequestFromHTTP converts a net/http request, reading its body up to
+// maxBodySize bytes (0 means no limit)
+func NewRequestFromHTTP(r *http.Request, maxBodySize int64) (*HttpRequest, error) {
+	var body []byte
+	if r.Body != nil {
+		reader := io.Reader(r.Body)
+		if maxBodySize > 0 {
+			reader = http.MaxBytesReader(nil, r.Body, maxBodySize)
+		}
+		var err error
+		if body, err = io.ReadAll(reader); err != nil {
+			return nil, fmt.Errorf("error reading request body: %w", err)
+		}
+	}
+	headers := headersFromHTTP(r.Header)
+	if r.Host != "" {
+		headers["Host"] = r.Host
+	}
+	return &HttpRequest{
+		Method:      r.Method,
+		Path:        r.URL.Path,
+		RawPath:     r.URL.EscapedPath(),
+		Proto:       r.Proto,
+		QueryParms:  QueryParms(r.URL.Query()),
+		PathParms:   make(PathParams),
+		Headers:     headers,
+		ContentType: r.Header.Get("Content-Type"),
+		Body:        body,
+	}, nil
+}
+
+// writeHTTPResponse copies a goFlow response to a net/http response writer
+func writeHTTPResponse(w http.ResponseWriter, res *HttpResponse) {
+	defer res.closeBody()
+	for key, value := range res.Headers {
+		if strings.EqualFold(key, "Connection") {
+			continue // net/http manages the connection itself
+		}
+		w.Header().Set(key, value)
+	}
+	if bodyAllowed(res.StatusCode) && w.Header().Get("Content-Length") == "" {
+		w.Header().Set("Content-Length", strconv.Itoa(len(res.Body)))
+	}
+	w.WriteHeader(res.StatusCode)
+	if res.omitBody {
+		return
+	}
+	if len(res.Body) > 0 {
+		w.Write(res.Body)
+	}
+	if res.BodyReader != nil {
+		io.Copy(w, res.BodyReader)
+	}
+}
+
+// Handle mounts a net/http handler on a goFlow route. Path parameters are
+// available to it through r.PathValue("id").
+func (r *Router) Handle(method, path string, handler http.Handler, middleware ...MiddlewareFunc) {
+	r.handle(method, path, WrapHandler(handler), middleware)
+}
+
+func (s *Server) Handle(method, path string, handler http.Handler, middleware ...MiddlewareFunc) {
+	s.Router.Handle(method, path, handler, middleware...)
+}
+
+// WrapHandler runs a net/http handler as a goFlow handler
+func WrapHandler(handler http.Handler) HandlerFunc {
+	return func(ctx *HttpContext) {
+		rec := newResponseRecorder(ctx.Response)
+		handler.ServeHTTP(rec, ctx.httpRequest())
+		rec.apply(ctx.Response)
+	}
+}
+
+// WrapMiddleware runs a net/http middleware in the goFlow chain. Changes it
+// makes to the request headers are seen by the rest of the chain, and it may
+// answer the request itself without calling the next handler.
+func WrapMiddleware(mw func(http.Handler) http.Handler) MiddlewareFunc {
+	return func(ctx *HttpContext, next HandlerFunc) {
+		inner := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			ctx.Request.Headers = headersFromHTTP(r.Header)
+			ctx.Response.Headers = headersFromHTTP(w.Header())
+			next(ctx)
+			writeHTTPResponse(w, ctx.Response)
+		})
+		WrapHandler(mw(inner))(ctx)
+	}
+}
+
+// httpRequest converts the request for a net/http handler
+func (ctx *HttpContext) httpRequest() *http.Request {
+	req := ctx.Request
+	target := req.escapedPath()
+	if len(req.QueryParms) > 0 {
+		target += "?" + url.Values(req.QueryParms).Encode()
+	}
+	u, err := url.ParseRequestURI(target)
+	if err != nil {
+		u = &url.URL{Path: req.Path}
+	}
+	proto := req.Proto
+	if proto == "" {
+		proto = "HTTP/1.1"
+	}
+	major, minor, _ := http.ParseHTTPVersion(proto)
+
+	header := make(http.Header, len(req.Headers))
+	for key, value := range req.Headers {
+		header.Set(key, value)
+	}
+	host := header.Get("Host")
+	header.Del("Host") // net/http keeps it in r.Host
+
+	r := &http.Request{
+		Method:        req.Method,
+		URL:           u,
+		Proto:         proto,
+		ProtoMajor:    major,
+		ProtoMinor:    minor,
+		Header:        header,
+		Body:          io.NopCloser(bytes.NewReader(req.Body)),
+		ContentLength: int64(len(req.Body)),
+		Host:          host,
+		RequestURI:    target,
+		TLS:           ctx.TLSState(),
+	}
+	if ctx.conn != nil {
+		r.RemoteAddr = ctx.conn.RemoteAddr().String()
+	}
+	for name, value := range req.PathParms {
+		r.SetPathValue(name, value)
+	}
+	return r
+}
+
+// headersFromHTTP flattens net/http headers, repeated values are joined with ", "
+func headersFromHTTP(header http.Header) Headers {
+	headers := make(Headers, len(header))
+	for key, values := range header {
+		headers[key] = strings.Join(values, ", ")
+	}
+	return headers
+}
+
+// responseRecorder collects what a net/http handler writes
+type responseRecorder struct {
+	header     http.Header
+	statusCode int
+	body       bytes.Buffer
+}
+
+// newResponseRecorder starts from the headers already set by earlier middleware
+func newResponseRecorder(res *HttpResponse) *responseRecorder {
+	header := make(http.Header, len(res.Headers))
+	for key, value := range res.Headers {
+		header.Set(key, value)
+	}
+	return &responseRecorder{header: header}
+}
+
+func (rec *responseRecorder) Header() http.Header {
+	return rec.header
+}
+
+func (rec *responseRecorder) WriteHeader(statusCode int) {
+	if rec.statusCode == 0 {
+		rec.statusCode = statusCode
+	}
+}
+
+func (rec *responseRecorder) Write(b []byte) (int, error) {
+	rec.WriteHeader(StatusOK)
+	return rec.body.Write(b)
+}
+
+// apply replaces status, headers and body of res with the recorded response
+func (rec *responseRecorder) apply(res *HttpResponse) {
+	if rec.statusCode == 0 {
+		rec.statusCode = StatusOK
+	}
+	rec.header.Del("Content-Length") // recomputed when the response is written
+	res.StatusCode = rec.statusCode
+	res.Headers = headersFromHTTP(rec.header)
+	res.Body = rec.body.Bytes()
+	res.BodyReader = nil // copied into the recorder and closed already
+}
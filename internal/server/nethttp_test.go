@@ -0,0 +1,121 @@
+package server
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestRouterServeHTTP(t *testing.T) {
+	r := NewRouter()
+	r.POST("/runs/:id", func(ctx *HttpContext) {
+		id, _ := ctx.Param("id")
+		event, _ := ctx.Request.GetHeader("X-GitHub-Event")
+		ctx.JSON(StatusCreated, Generalesponse{"id": id, "event": event, "body": string(ctx.Request.Body)})
+	})
+
+	req := httptest.NewRequest("POST", "/runs/42", strings.NewReader("hello"))
+	req.Header.Set("X-Github-Event", "push")
+	rec := httptest.NewRecorder()
+	r.ServeHTTP(rec, req)
+
+	if rec.Code != StatusCreated {
+		t.Fatalf("code = %d", rec.Code)
+	}
+	if got := rec.Body.String(); got != `{"body":"hello","event":"push","id":"42"}` {
+		t.Errorf("body = %s", got)
+	}
+
+	rec = httptest.NewRecorder()
+	r.ServeHTTP(rec, httptest.NewRequest("GET", "/runs/42", nil))
+	if rec.Code != StatusMethodNotAllowed || rec.Header().Get("Allow") != "POST, OPTIONS" {
+		t.Errorf("code = %d, allow = %q", rec.Code, rec.Header().Get("Allow"))
+	}
+}
+
+func TestServerServeHTTPWithMountedHandler(t *testing.T) {
+	serv := NewHttpServer(":0")
+	serv.Use(RequestID)
+	serv.Use(WrapMiddleware(func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.Header.Get("Authorization") == "" {
+				http.Error(w, "denied", http.StatusUnauthorized)
+				return
+			}
+			r.Header.Set("X-Checked", "yes")
+			next.ServeHTTP(w, r)
+		})
+	}))
+	serv.Handle(GET_METHOD, "/items/:name", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", TEXT_PLAIN)
+		io.WriteString(w, r.PathValue("name")+" "+r.Header.Get("X-Checked")+" "+r.URL.Query().Get("q"))
+	}))
+
+	ts := httptest.NewServer(serv)
+	defer ts.Close()
+
+	res, err := http.Get(ts.URL + "/items/a%20b?q=x")
+	if err != nil {
+		t.Fatal(err)
+	}
+	res.Body.Close()
+	if res.StatusCode != StatusUnauthorized {
+		t.Errorf("without auth: code = %d", res.StatusCode)
+	}
+
+	req, _ := http.NewRequest("GET", ts.URL+"/items/a%20b?q=x", nil)
+	req.Header.Set("Authorization", "Bearer t")
+	res, err = http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, _ := io.ReadAll(res.Body)
+	res.Body.Close()
+	if res.StatusCode != StatusOK || string(body) != "a b yes x" {
+		t.Errorf("code = %d, body = %q", res.StatusCode, body)
+	}
+	if res.Header.Get("X-Request-ID") == "" {
+		t.Error("server middleware did not run")
+	}
+}
+
+func TestWrapMiddlewareServesStaticFiles(t *testing.T) {
+	root := t.TempDir()
+	os.WriteFile(filepath.Join(root, "app.txt"), []byte("v2"), 0644)
+	s := NewHttpServer("")
+	// The file is copied into the recorder and closed, it must not be streamed again
+	streams := make(chan bool, 2)
+	s.Use(func(ctx *HttpContext, next HandlerFunc) {
+		next(ctx)
+		streams <- ctx.Response.BodyReader != nil
+	}, WrapMiddleware(func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("X-Wrapped", "yes")
+			next.ServeHTTP(w, r)
+		})
+	}))
+	s.Static("/artifacts", root)
+	addr := startServer(t, s)
+
+	// The connection stays usable for the next request
+	conn, reader := dial(t, addr)
+	conn.Write([]byte("GET /artifacts/app.txt HTTP/1.1\r\n\r\nGET /artifacts/app.txt HTTP/1.1\r\n\r\n"))
+	for i := range 2 {
+		res, err := http.ReadResponse(reader, nil)
+		if err != nil {
+			t.Fatalf("response %d: %v", i, err)
+		}
+		body, _ := io.ReadAll(res.Body)
+		res.Body.Close()
+		if res.StatusCode != StatusOK || string(body) != "v2" || res.Header.Get("X-Wrapped") != "yes" || res.Close {
+			t.Errorf("response %d: code = %d, body = %q, headers = %v", i, res.StatusCode, body, res.Header)
+		}
+		if <-streams {
+			t.Errorf("response %d: closed file left to stream", i)
+		}
+	}
+}
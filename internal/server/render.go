@@ -0,0 +1,91 @@
+package server
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"html/template"
+	"io"
+	"strings"
+)
+
+// TextRenderer is implemented by values with a plain text form for Render
+type TextRenderer interface {
+	RenderText(w io.Writer) error
+}
+
+// HTMLRenderer is implemented by values with an HTML form for Render
+type HTMLRenderer interface {
+	RenderHTML(w io.Writer) error
+}
+
+// Negotiate returns the offered media type the Accept header prefers. Ties go
+// to the earlier offer, a missing or unmatched Accept gets the first one.
+func (ctx *HttpContext) Negotiate(offers ...string) string {
+	accept, err := ctx.Request.GetHeader("Accept")
+	if err != nil || strings.TrimSpace(accept) == "" {
+		return offers[0]
+	}
+	best, bestQ := offers[0], 0.0
+	for _, offer := range offers {
+		mainType, _, _ := strings.Cut(offer, "/")
+		if q := acceptQuality(accept, offer, mainType+"/*", "*/*"); q > bestQ {
+			best, bestQ = offer, q
+		}
+	}
+	return best
+}
+
+// Render writes obj as JSON, plain text or HTML, whichever the client's Accept
+// header prefers; scripts sending "*/*" get JSON. Values implementing
+// TextRenderer or HTMLRenderer control their form, others are shown as indented JSON.
+func (ctx *HttpContext) Render(statusCode int, obj interface{}) error {
+	format := ctx.Negotiate(APPLICATION_JSON, TEXT_PLAIN, TEXT_HTML)
+	addVary(ctx.Response, "Accept")
+	if format == APPLICATION_JSON {
+		return ctx.JSON(statusCode, obj)
+	}
+
+	var buf bytes.Buffer
+	switch {
+	case format == TEXT_HTML:
+		if r, ok := obj.(HTMLRenderer); ok {
+			if err := r.RenderHTML(&buf); err != nil {
+				return fmt.Errorf("error rendering HTML: %v", err)
+			}
+		} else if err := renderJSONPage(&buf, obj); err != nil {
+			return err
+		}
+	default:
+		if r, ok := obj.(TextRenderer); ok {
+			if err := r.RenderText(&buf); err != nil {
+				return fmt.Errorf("error rendering text: %v", err)
+			}
+		} else {
+			data, err := json.MarshalIndent(obj, "", "  ")
+			if err != nil {
+				return fmt.Errorf("error marshaling JSON: %v", err)
+			}
+			buf.Write(append(data, '\n'))
+		}
+	}
+
+	ctx.Response.StatusCode = statusCode
+	ctx.Response.Body = buf.Bytes()
+	ctx.Response.Headers["Content-Type"] = format + "; charset=utf-8"
+	return nil
+}
+
+var jsonPage = template.Must(template.New("json").Parse(`<!DOCTYPE html>
+<html><head><meta charset="utf-8"><title>goFlow</title></head>
+<body><pre>{{.}}</pre></body></html>
+`))
+
+// renderJSONPage shows values without an HTML form as indented JSON in a page
+func renderJSONPage(w io.Writer, obj interface{}) error {
+	data, err := json.MarshalIndent(obj, "", "  ")
+	if err != nil {
+		return fmt.Errorf("error marshaling JSON: %v", err)
+	}
+	return jsonPage.Execute(w, string(data))
+}
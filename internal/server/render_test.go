@@ -0,0 +1,57 @@
+package server
+
+import (
+	"compress/gzip"
+	"io"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestRenderNegotiatesAndCompresses(t *testing.T) {
+	r := NewRouter()
+	r.GET("/status", func(ctx *HttpContext) {
+		ctx.Render(StatusOK, Generalesponse{"data": strings.Repeat("run ", 500)})
+	}, Compress)
+
+	cases := []struct {
+		accept, contentType string
+	}{
+		{"", APPLICATION_JSON},
+		{"*/*", APPLICATION_JSON},
+		{"text/html,application/xhtml+xml,application/xml;q=0.9,*/*;q=0.8", "text/html; charset=utf-8"},
+		{"text/plain", "text/plain; charset=utf-8"},
+		{"application/json;q=0.5, text/*", "text/plain; charset=utf-8"},
+	}
+	for _, c := range cases {
+		req := httptest.NewRequest("GET", "/status", nil)
+		req.Header.Set("Accept", c.accept)
+		rec := httptest.NewRecorder()
+		r.ServeHTTP(rec, req)
+		if got := rec.Header().Get("Content-Type"); got != c.contentType {
+			t.Errorf("Accept %q: content type = %q, want %q", c.accept, got, c.contentType)
+		}
+		if rec.Header().Get("Content-Encoding") != "" {
+			t.Errorf("Accept %q: compressed without Accept-Encoding", c.accept)
+		}
+	}
+
+	req := httptest.NewRequest("GET", "/status", nil)
+	req.Header.Set("Accept-Encoding", "deflate;q=0.5, gzip")
+	rec := httptest.NewRecorder()
+	r.ServeHTTP(rec, req)
+	if rec.Header().Get("Content-Encoding") != "gzip" {
+		t.Fatalf("content encoding = %q", rec.Header().Get("Content-Encoding"))
+	}
+	zr, err := gzip.NewReader(rec.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, _ := io.ReadAll(zr)
+	if !strings.Contains(string(body), `"data":"run run`) {
+		t.Errorf("body = %.40q", body)
+	}
+	if vary := rec.Header().Get("Vary"); vary != "Accept, Accept-Encoding" {
+		t.Errorf("vary = %q", vary)
+	}
+}
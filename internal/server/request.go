@@ -2,20 +2,28 @@ package server
 
 import (
 	"bufio"
+	"bytes"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
 	"net"
+	"net/textproto"
+	"net/url"
+	"strconv"
 	"strings"
 )
 
 // Custom Data TYpes for QueryParameters and Headers
-type QueryParms map[string]string // e.g., {"productid": "1"}
-type Headers map[string]string    // e.g., {"Content-Type": "application/json"}
-type PathParams map[string]string // e.g., {"id": "123"}
+type QueryParms map[string][]string // e.g., {"status": ["failed", "cancelled"]}
+type Headers map[string]string      // e.g., {"Content-Type": "application/json"}
+type PathParams map[string]string   // e.g., {"id": "123"}
 
 type HttpRequest struct {
 	Method      string
-	Path        string
+	Path        string // decoded, e.g. "/files/a b"
+	RawPath     string // as sent, e.g. "/files/a%20b"; routing splits this one so "%2F" stays inside a segment
+	Proto       string // e.g., "HTTP/1.1"
 	QueryParms  QueryParms
 	PathParms   PathParams
 	Headers     Headers
@@ -24,31 +32,59 @@ type HttpRequest struct {
 }
 
 func ParseRequest(conn net.Conn) (*HttpRequest, error) {
-
-	// Read request
 	reader := bufio.NewReader(conn)
+	req, err := readRequestHead(reader, DefaultMaxHeaderBytes)
+	if err != nil {
+		return nil, err
+	}
+	if err := req.readBody(reader, DefaultMaxBodySize); err != nil {
+		return nil, err
+	}
+	return req, nil
+}
+
+// readRequestHead reads the request line and headers of the next request from
+// a connection reader. The same reader is used for every request of a persistent
+// connection, so pipelined requests that are already buffered are not lost.
+// The request line and headers together may take up to maxHeaderBytes.
+func readRequestHead(reader *bufio.Reader, maxHeaderBytes int) (*HttpRequest, error) {
+	remaining := maxHeaderBytes
 	// Parse request line (e.g., "GET /users/123?key=value HTTP/1.1")
 	// Read RequestLine
-	requestLine, err := reader.ReadString('\n')
+	requestLine, err := readLine(reader, remaining)
+	if errors.Is(err, errHeaderTooLarge) {
+		return nil, err
+	}
+	remaining -= len(requestLine)
 	if err != nil {
-		return nil, fmt.Errorf("error reading request line %v", err)
+		if requestLine == "" {
+			return nil, fmt.Errorf("%w: %v", errNoRequest, err)
+		}
+		return nil, fmt.Errorf("error reading request line %w", err)
 	}
 	// parse request line
-	requestLineParts := strings.Split(requestLine, " ")
+	requestLineParts := strings.Split(strings.TrimRight(requestLine, "\r\n"), " ")
 
 	if len(requestLineParts) != 3 {
 		return nil, fmt.Errorf("invalid HTTP request")
 	}
-	method, path, _ := requestLineParts[0], requestLineParts[1], requestLineParts[2]
+	method, target, proto := requestLineParts[0], requestLineParts[1], requestLineParts[2]
 
-	// Parse Header
+	// Parse Header, keys are stored canonicalized ("x-github-event" -> "X-Github-Event")
 	headers := make(Headers)
 	var contentType string
-	for {
-		line, err := reader.ReadString('\n')
-		if err != nil || line == "\r\n" || line == "\n" { // that mean end of headers part
+	for count := 0; ; count++ {
+		line, err := readLine(reader, remaining)
+		if err != nil {
+			return nil, fmt.Errorf("error reading headers: %w", err)
+		}
+		remaining -= len(line)
+		if line == "\r\n" || line == "\n" { // that mean end of headers part
 			break // End of headers
 		}
+		if count == maxHeaderCount {
+			return nil, fmt.Errorf("more than %d headers: %w", maxHeaderCount, errHeaderTooLarge)
+		}
 
 		if strings.TrimSpace(line) == "" {
 			continue
@@ -56,8 +92,11 @@ func ParseRequest(conn net.Conn) (*HttpRequest, error) {
 		// parse header data
 		headerPrts := strings.SplitN(line, ":", 2)
 		if len(headerPrts) == 2 {
-			key := strings.TrimSpace(headerPrts[0])
+			key := textproto.CanonicalMIMEHeaderKey(strings.TrimSpace(headerPrts[0]))
 			value := strings.TrimSpace(headerPrts[1])
+			if previous, ok := headers[key]; ok {
+				value = previous + ", " + value // repeated headers are combined, as RFC 9110 allows
+			}
 			headers[key] = value
 			if key == "Content-Type" {
 				contentType = value
@@ -65,50 +104,196 @@ func ParseRequest(conn net.Conn) (*HttpRequest, error) {
 		}
 
 	}
-	// Parse QueryParameters it exist
-	// ex: /product?productid=1&productname=iphone
-	// it contain path and querystrings keypairs separte with ? and keypairs it self separtae with &
-	queryParms := make(QueryParms)
-	if strings.Contains(path, "?") {
-		parts := strings.SplitN(path, "?", 2)
-		path = parts[0]
-		queryStr := parts[1]
-		queryParis := strings.Split(queryStr, "&")
-		for _, pairs := range queryParis {
-			parts := strings.Split(pairs, "=")
-			if len(parts) == 2 {
-				queryParms[parts[0]] = parts[1]
-			}
-		}
+	// Parse path and QueryParameters it exist
+	// ex: /product?productid=1&productname=iphone%2015&tag=a&tag=b
+	// percent-encoding is decoded (RFC 3986), "+" in the query means a space
+	// and repeated keys keep all their values
+	rawPath, queryParms, err := parseTarget(target)
+	if err != nil {
+		return nil, err
 	}
-
-	// Parse Body
-	var body []byte
-	if method == POST_METHOD || method == PUT_METHOD {
-		contentLength := 0
-		if cl, ok := headers["Content-Length"]; ok {
-			fmt.Sscanf(cl, "%d", &contentLength)
-		}
-		body = make([]byte, contentLength)
-		_, err = reader.Read(body) // fill body
-		if err != nil {
-			return nil, fmt.Errorf("error reading request body: %v", err)
-		}
-
+	path, err := url.PathUnescape(rawPath)
+	if err != nil {
+		return nil, fmt.Errorf("invalid request path %q: %v", rawPath, err)
 	}
 
 	return &HttpRequest{
 		Method:      method,
 		Path:        path,
+		RawPath:     rawPath,
+		Proto:       proto,
 		Headers:     headers,
 		QueryParms:  queryParms,
 		PathParms:   make(PathParams), // Initialize path parameters , Will be populated by router
-		Body:        body,
 		ContentType: contentType,
 	}, nil
 
 }
 
+// parseTarget splits the request target into its escaped path and decoded query.
+// Absolute targets ("http://host/path?q") are accepted as well.
+func parseTarget(target string) (string, QueryParms, error) {
+	if target == "*" { // OPTIONS * HTTP/1.1
+		return target, make(QueryParms), nil
+	}
+	u, err := url.ParseRequestURI(target)
+	if err != nil {
+		return "", nil, fmt.Errorf("invalid request target %q: %v", target, err)
+	}
+	query, err := url.ParseQuery(u.RawQuery)
+	if err != nil {
+		return "", nil, fmt.Errorf("invalid query string %q: %v", u.RawQuery, err)
+	}
+	return u.EscapedPath(), QueryParms(query), nil
+}
+
+// escapedPath is the path used for routing, RawPath when the request was parsed from the wire
+func (req *HttpRequest) escapedPath() string {
+	if req.RawPath != "" {
+		return req.RawPath
+	}
+	return req.Path
+}
+
+// readBody reads the request body framed by Transfer-Encoding: chunked or
+// Content-Length, refusing bodies larger than maxBodySize (0 means no limit)
+func (req *HttpRequest) readBody(reader *bufio.Reader, maxBodySize int64) error {
+	if te, err := req.GetHeader("Transfer-Encoding"); err == nil {
+		if !strings.EqualFold(strings.TrimSpace(te), "chunked") {
+			return fmt.Errorf("unsupported Transfer-Encoding: %s", te)
+		}
+		body, err := readChunked(reader, maxBodySize)
+		if err != nil {
+			return err
+		}
+		req.Body = body
+		return nil
+	}
+
+	cl, err := req.GetHeader("Content-Length")
+	if err != nil {
+		return nil
+	}
+	contentLength, err := strconv.ParseInt(strings.TrimSpace(cl), 10, 64)
+	if err != nil || contentLength < 0 {
+		return fmt.Errorf("invalid Content-Length: %q", cl)
+	}
+	if maxBodySize > 0 && contentLength > maxBodySize {
+		return errBodyTooLarge
+	}
+	// Grow with the data actually sent rather than trusting Content-Length up front
+	var body bytes.Buffer
+	if _, err := io.CopyN(&body, reader, contentLength); err != nil {
+		return fmt.Errorf("error reading request body: %w", unexpectedEOF(err))
+	}
+	req.Body = body.Bytes()
+	return nil
+}
+
+// readChunked decodes a chunked request body:
+// <hex size>[;ext]\r\n<data>\r\n ... 0\r\n[trailers]\r\n
+func readChunked(reader *bufio.Reader, maxBodySize int64) ([]byte, error) {
+	var body bytes.Buffer
+	for {
+		line, err := readLine(reader, maxChunkLineSize)
+		if errors.Is(err, errHeaderTooLarge) {
+			return nil, fmt.Errorf("chunk size line longer than %d bytes", maxChunkLineSize)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("error reading chunk size: %w", err)
+		}
+		sizeStr := strings.TrimSpace(line)
+		if i := strings.Index(sizeStr, ";"); i >= 0 {
+			sizeStr = sizeStr[:i] // ignore chunk extensions
+		}
+		size, err := strconv.ParseInt(strings.TrimSpace(sizeStr), 16, 64)
+		if err != nil || size < 0 {
+			return nil, fmt.Errorf("invalid chunk size: %q", line)
+		}
+
+		if size == 0 {
+			// Skip optional trailers up to the final empty line
+			for count := 0; ; count++ {
+				trailer, err := readLine(reader, maxChunkLineSize)
+				if err != nil {
+					return nil, fmt.Errorf("error reading chunk trailer: %w", err)
+				}
+				if trailer == "\r\n" || trailer == "\n" {
+					return body.Bytes(), nil
+				}
+				if count == maxHeaderCount {
+					return nil, fmt.Errorf("more than %d trailers: %w", maxHeaderCount, errHeaderTooLarge)
+				}
+			}
+		}
+
+		if maxBodySize > 0 && int64(body.Len())+size > maxBodySize {
+			return nil, errBodyTooLarge
+		}
+		// The size is only a claim, copy what arrives instead of allocating it up front
+		if _, err := io.CopyN(&body, reader, size); err != nil {
+			return nil, fmt.Errorf("error reading chunk: %w", unexpectedEOF(err))
+		}
+
+		crlf, err := readLine(reader, maxChunkLineSize)
+		if err != nil || strings.TrimSpace(crlf) != "" {
+			return nil, fmt.Errorf("malformed chunk terminator")
+		}
+	}
+}
+
+// Limits on the lines of a request head and of a chunked body
+const (
+	maxHeaderCount   = 100  // headers, and trailers of a chunked body
+	maxChunkLineSize = 4096 // chunk size lines and trailers
+)
+
+// readLine reads a line up to and including '\n', failing with
+// errHeaderTooLarge once it grows past limit bytes instead of buffering
+// whatever the client keeps sending
+func readLine(reader *bufio.Reader, limit int) (string, error) {
+	var line []byte
+	for {
+		part, err := reader.ReadSlice('\n')
+		if len(line)+len(part) > limit {
+			return "", errHeaderTooLarge
+		}
+		line = append(line, part...)
+		if err != bufio.ErrBufferFull {
+			return string(line), err
+		}
+	}
+}
+
+// unexpectedEOF reports a body that ended early like io.ReadFull does
+func unexpectedEOF(err error) error {
+	if err == io.EOF {
+		return io.ErrUnexpectedEOF
+	}
+	return err
+}
+
+// errNoRequest means the client closed or idled out the connection before sending a new request
+var errNoRequest = errors.New("no request")
+
+// errBodyTooLarge means the request body exceeds the server's MaxBodySize
+var errBodyTooLarge = errors.New("request body too large")
+
+// errHeaderTooLarge means the request head exceeds the server's MaxHeaderBytes
+// or maxHeaderCount, or a chunked body has oversized trailers
+var errHeaderTooLarge = errors.New("request header fields too large")
+
+// wantsKeepAlive reports whether the client asked to keep the connection open:
+// the default for HTTP/1.1, opt-in for HTTP/1.0
+func (req *HttpRequest) wantsKeepAlive() bool {
+	connection, _ := req.GetHeader("Connection")
+	connection = strings.ToLower(connection)
+	if req.Proto == "HTTP/1.0" {
+		return strings.Contains(connection, "keep-alive")
+	}
+	return !strings.Contains(connection, "close")
+}
+
 // ParseBody parse requestbody based on Content-Type header
 func (req *HttpRequest) ParseBody() (interface{}, error) {
 
@@ -129,24 +314,40 @@ func (req *HttpRequest) ParseBody() (interface{}, error) {
 }
 
 func (req *HttpRequest) GetBody() ([]byte, error) {
-	if req.Method == POST_METHOD || req.Method == PUT_METHOD {
+	if req.Method == POST_METHOD || req.Method == PUT_METHOD || req.Method == PATCH_METHOD {
 		return req.Body, nil
 	}
 	return nil, fmt.Errorf("not supported body data for method :%v", req.Method)
 }
 
+// GetHeader returns the header value, the key is matched case-insensitively
 func (req *HttpRequest) GetHeader(key string) (string, error) {
 	if cl, ok := req.Headers[key]; ok {
 		return cl, nil
 	}
+	if cl, ok := req.Headers[textproto.CanonicalMIMEHeaderKey(key)]; ok {
+		return cl, nil
+	}
+	for name, value := range req.Headers { // headers set by hand may not be canonical
+		if strings.EqualFold(name, key) {
+			return value, nil
+		}
+	}
 	return "", fmt.Errorf("key NOt exist :%v", key)
 }
+
+// GetQueryParam returns the first value of the query parameter
 func (req *HttpRequest) GetQueryParam(key string) (string, error) {
-	if cl, ok := req.QueryParms[key]; ok {
-		return cl, nil
+	if values, ok := req.QueryParms[key]; ok && len(values) > 0 {
+		return values[0], nil
 	}
 	return "", fmt.Errorf("key NOt exist :%v", key)
 }
+
+// GetQueryParams returns all values of a repeated query parameter
+func (req *HttpRequest) GetQueryParams(key string) []string {
+	return req.QueryParms[key]
+}
 func (req *HttpRequest) GetPathParam(key string) (string, error) {
 	if cl, ok := req.PathParms[key]; ok {
 		return cl, nil
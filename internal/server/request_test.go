@@ -0,0 +1,137 @@
+package server
+
+import (
+	"bufio"
+	"errors"
+	"io"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestReadRequestHeadDecodesTarget(t *testing.T) {
+	raw := "GET /files/a%20b%2Fc?status=failed&status=cancelled&q=x%3Dy&name=iphone+15 HTTP/1.1\r\n" +
+		"x-github-event: push\r\n\r\n"
+	req, err := readRequestHead(bufio.NewReader(strings.NewReader(raw)), DefaultMaxHeaderBytes)
+	if err != nil {
+		t.Fatalf("readRequestHead: %v", err)
+	}
+
+	if req.Path != "/files/a b/c" || req.RawPath != "/files/a%20b%2Fc" {
+		t.Errorf("path = %q, raw path = %q", req.Path, req.RawPath)
+	}
+	if got := req.GetQueryParams("status"); !reflect.DeepEqual(got, []string{"failed", "cancelled"}) {
+		t.Errorf("status = %v", got)
+	}
+	if got, _ := req.GetQueryParam("q"); got != "x=y" {
+		t.Errorf("q = %q", got)
+	}
+	if got, _ := req.GetQueryParam("name"); got != "iphone 15" {
+		t.Errorf("name = %q", got)
+	}
+	for _, key := range []string{"X-GitHub-Event", "X-Github-Event", "x-github-event"} {
+		if got, err := req.GetHeader(key); err != nil || got != "push" {
+			t.Errorf("GetHeader(%q) = %q, %v", key, got, err)
+		}
+	}
+}
+
+func TestReadRequestHeadRejectsBadEscapes(t *testing.T) {
+	for _, target := range []string{"/a%zz", "/a?b=%zz"} {
+		raw := "GET " + target + " HTTP/1.1\r\n\r\n"
+		if _, err := readRequestHead(bufio.NewReader(strings.NewReader(raw)), DefaultMaxHeaderBytes); err == nil {
+			t.Errorf("%s: expected an error", target)
+		}
+	}
+}
+
+func TestReadRequestHeadLimits(t *testing.T) {
+	cases := map[string]string{
+		"long request line": "GET /" + strings.Repeat("a", 2048) + " HTTP/1.1\r\n\r\n",
+		"long header":       "GET / HTTP/1.1\r\nX-Pad: " + strings.Repeat("a", 2048) + "\r\n\r\n",
+		"headers in total":  "GET / HTTP/1.1\r\n" + strings.Repeat("X-Pad: "+strings.Repeat("a", 100)+"\r\n", 20) + "\r\n",
+		"header count":      "GET / HTTP/1.1\r\n" + strings.Repeat("X-Pad: 1\r\n", maxHeaderCount+1) + "\r\n",
+	}
+	for name, raw := range cases {
+		if _, err := readRequestHead(bufio.NewReader(strings.NewReader(raw)), 1024); !errors.Is(err, errHeaderTooLarge) {
+			t.Errorf("%s: err = %v", name, err)
+		}
+	}
+	raw := "GET / HTTP/1.1\r\n" + strings.Repeat("X-Pad: 1\r\n", maxHeaderCount) + "\r\n"
+	if _, err := readRequestHead(bufio.NewReader(strings.NewReader(raw)), DefaultMaxHeaderBytes); err != nil {
+		t.Errorf("%d headers: %v", maxHeaderCount, err)
+	}
+}
+
+func TestRouterMatchesEscapedSegments(t *testing.T) {
+	r := NewRouter()
+	r.GET("/status/:id", func(*HttpContext) {})
+	req := &HttpRequest{Method: HEAD_METHOD, Path: "/status/a/b", RawPath: "/status/a%2Fb"}
+	if _, found := r.FindHandler(req); !found {
+		t.Fatal("expected HEAD to match the GET route")
+	}
+	if req.PathParms["id"] != "a/b" {
+		t.Errorf("id = %q", req.PathParms["id"])
+	}
+	if got := r.AllowedMethods("/status/x"); !reflect.DeepEqual(got, []string{"GET", "HEAD", "OPTIONS"}) {
+		t.Errorf("allowed = %v", got)
+	}
+}
+
+func TestReadBodyChunked(t *testing.T) {
+	cases := []struct {
+		name, body string
+		limit      int64
+		want       string
+		err        string // empty when the body is valid
+	}{
+		{"chunks", "5\r\nhello\r\n7;ext=1\r\n, world\r\n0\r\n\r\n", 0, "hello, world", ""},
+		{"trailers", "3\r\nabc\r\n0\r\nX-Checksum: 1\r\nX-Other: 2\r\n\r\n", 0, "abc", ""},
+		{"within limit", "5\r\nhello\r\n0\r\n\r\n", 5, "hello", ""},
+		{"over limit", "5\r\nhello\r\n1\r\n!\r\n0\r\n\r\n", 5, "", "too large"},
+		{"bad size", "zz\r\nhello\r\n0\r\n\r\n", 0, "", "invalid chunk size"},
+		{"negative size", "-1\r\nhello\r\n0\r\n\r\n", 0, "", "invalid chunk size"},
+		{"missing terminator", "5\r\nhelloX0\r\n\r\n", 0, "", "malformed chunk terminator"},
+		{"long size line", "5;" + strings.Repeat("x", maxChunkLineSize) + "\r\nhello\r\n0\r\n\r\n", 0, "", "chunk size line longer"},
+		{"long trailer", "0\r\nX-Pad: " + strings.Repeat("x", maxChunkLineSize) + "\r\n\r\n", 0, "", "too large"},
+		{"many trailers", "0\r\n" + strings.Repeat("X-Pad: 1\r\n", maxHeaderCount+1) + "\r\n", 0, "", "more than"},
+		// A huge claimed size must not be allocated up front, even without a limit
+		{"huge size", "7fffffffffffffff\r\nshort", 0, "", "unexpected EOF"},
+	}
+	for _, c := range cases {
+		req := &HttpRequest{Headers: Headers{"Transfer-Encoding": "chunked"}}
+		err := req.readBody(bufio.NewReader(strings.NewReader(c.body)), c.limit)
+		if c.err == "" && (err != nil || string(req.Body) != c.want) {
+			t.Errorf("%s: body = %q, err = %v", c.name, req.Body, err)
+		}
+		if c.err != "" && (err == nil || !strings.Contains(err.Error(), c.err)) {
+			t.Errorf("%s: err = %v, want %q", c.name, err, c.err)
+		}
+	}
+}
+
+func TestReadBodyContentLength(t *testing.T) {
+	req := &HttpRequest{Headers: Headers{"Content-Length": "11"}}
+	if err := req.readBody(bufio.NewReader(strings.NewReader("hello world")), 11); err != nil || string(req.Body) != "hello world" {
+		t.Errorf("body = %q, err = %v", req.Body, err)
+	}
+	if err := req.readBody(bufio.NewReader(strings.NewReader("hello world")), 10); !errors.Is(err, errBodyTooLarge) {
+		t.Errorf("over limit: err = %v", err)
+	}
+	req.Headers["Content-Length"] = "9223372036854775807"
+	if err := req.readBody(bufio.NewReader(strings.NewReader("short")), 0); !errors.Is(err, io.ErrUnexpectedEOF) {
+		t.Errorf("short body: err = %v", err)
+	}
+}
+
+func TestGetBody(t *testing.T) {
+	for _, method := range []string{POST_METHOD, PUT_METHOD, PATCH_METHOD} {
+		req := &HttpRequest{Method: method, Body: []byte(`{"paused":true}`)}
+		if body, err := req.GetBody(); err != nil || string(body) != `{"paused":true}` {
+			t.Errorf("%s: body = %q, err = %v", method, body, err)
+		}
+	}
+	if _, err := (&HttpRequest{Method: GET_METHOD}).GetBody(); err == nil {
+		t.Error("GET: expected an error")
+	}
+}
@@ -2,6 +2,7 @@ package server
 
 import (
 	"fmt"
+	"io"
 	"net"
 )
 
@@ -10,6 +11,10 @@ type HttpResponse struct {
 	StatusCode int
 	Headers    Headers
 	Body       []byte
+	// BodyReader is streamed instead of Body when set, e.g. a file. Content-Length
+	// must be set by the handler; it is closed after writing when it is an io.Closer.
+	BodyReader io.Reader
+	omitBody   bool // HEAD requests get the headers of the GET response only
 }
 
 func NewResponse(statusCode int, body []byte) *HttpResponse {
@@ -21,15 +26,16 @@ func NewResponse(statusCode int, body []byte) *HttpResponse {
 }
 
 func (res *HttpResponse) Write(conn net.Conn) error {
+	defer res.closeBody()
 
 	statusText := getStatusText(res.StatusCode)
 	response := fmt.Sprintf("HTTP/1.1 %d %s\r\n", res.StatusCode, statusText)
 
-	// Set Content-Length if body exists and not already set
-	if res.Body != nil && len(res.Body) <= 0 {
-		if _, ok := res.Headers["Content-Length"]; !ok {
-			res.Headers["Content-Length"] = fmt.Sprintf("%d", len(res.Body))
-		}
+	// Always set Content-Length, clients on a persistent connection need it to find the end of the body.
+	// 1xx, 204 and 304 responses have no body and do not announce one.
+	noBody := !bodyAllowed(res.StatusCode)
+	if _, ok := res.Headers["Content-Length"]; !ok && !noBody {
+		res.Headers["Content-Length"] = fmt.Sprintf("%d", len(res.Body))
 	}
 	// Write headers
 	for key, value := range res.Headers {
@@ -38,7 +44,7 @@ func (res *HttpResponse) Write(conn net.Conn) error {
 	response += "\r\n" // End headers
 
 	var fullResponse []byte
-	if res.Body != nil {
+	if res.Body != nil && !res.omitBody && !noBody {
 		fullResponse = append([]byte(response), res.Body...)
 	} else {
 		fullResponse = []byte(response)
@@ -47,20 +53,29 @@ func (res *HttpResponse) Write(conn net.Conn) error {
 	if err != nil {
 		return fmt.Errorf("error writing response: %v", err)
 	}
+	if res.BodyReader != nil && !res.omitBody && !noBody {
+		if _, err := io.Copy(conn, res.BodyReader); err != nil {
+			return fmt.Errorf("error writing response body: %v", err)
+		}
+	}
 	return nil
 }
 
+// closeBody closes BodyReader once the response is written or dropped
+func (res *HttpResponse) closeBody() {
+	if closer, ok := res.BodyReader.(io.Closer); ok {
+		closer.Close()
+	}
+}
+
+// bodyAllowed reports whether a response with this status code carries a body
+func bodyAllowed(statusCode int) bool {
+	return statusCode >= 200 && statusCode != StatusNoContent && statusCode != StatusNotModified
+}
+
 func getStatusText(statusCode int) string {
-	switch statusCode {
-	case 200:
-		return "OK"
-	case 400:
-		return "Bad Request"
-	case 404:
-		return "Not Found"
-	case 500:
-		return "Internal Server Error"
-	default:
-		return "Unknown"
+	if text, ok := StatusCodeText[statusCode]; ok {
+		return text
 	}
+	return "Unknown"
 }
@@ -1,15 +1,24 @@
 package server
 
-import "strings"
+import (
+	"fmt"
+	"net/url"
+	"strings"
+)
 
 // Custom Data types
 type HandlerFunc func(*HttpContext)
 
+// MiddlewareFunc wraps a handler; it calls next(ctx) to continue the chain
+// or returns without calling it to answer the request itself
+type MiddlewareFunc func(ctx *HttpContext, next HandlerFunc)
+
 type RouteEntry struct {
-	Method  string
-	Path    string
-	Handler HandlerFunc
-	Params  []string // Parameter names (e.g., ["id"])
+	Method   string
+	Path     string
+	Handler  HandlerFunc // already wrapped with the route middleware
+	Params   []string    // Parameter names (e.g., ["id"], or ["filepath"] for "/static/*filepath")
+	Wildcard bool        // the last segment is a "*name" catch-all
 }
 
 type Router struct {
@@ -22,92 +31,203 @@ func NewRouter() *Router {
 	}
 }
 
-func (r *Router) handle(method, path string, handler HandlerFunc) {
+func (r *Router) handle(method, path string, handler HandlerFunc, middleware []MiddlewareFunc) {
 	params := []string{}
+	wildcard := false
 	parts := strings.Split(strings.Trim(path, "/"), "/")
-	for _, part := range parts {
+	for i, part := range parts {
 		if strings.HasPrefix(part, ":") {
 			params = append(params, strings.TrimPrefix(part, ":"))
 		}
+		if strings.HasPrefix(part, "*") {
+			if i != len(parts)-1 {
+				panic(fmt.Sprintf("catch-all %s must be the last segment of route %s", part, path))
+			}
+			params = append(params, strings.TrimPrefix(part, "*"))
+			wildcard = true
+		}
 	}
 	r.routes = append(r.routes, RouteEntry{
-		Method:  method,
-		Path:    path,
-		Handler: handler,
-		Params:  params,
+		Method:   method,
+		Path:     path,
+		Handler:  Chain(handler, middleware...),
+		Params:   params,
+		Wildcard: wildcard,
 	})
 
 }
-func (r *Router) GET(path string, handler HandlerFunc) {
-	r.handle(GET_METHOD, path, handler)
+func (r *Router) GET(path string, handler HandlerFunc, middleware ...MiddlewareFunc) {
+	r.handle(GET_METHOD, path, handler, middleware)
+}
+
+func (r *Router) POST(path string, handler HandlerFunc, middleware ...MiddlewareFunc) {
+	r.handle(POST_METHOD, path, handler, middleware)
+}
+
+func (r *Router) PUT(path string, handler HandlerFunc, middleware ...MiddlewareFunc) {
+	r.handle(PUT_METHOD, path, handler, middleware)
+}
+
+func (r *Router) DELETE(path string, handler HandlerFunc, middleware ...MiddlewareFunc) {
+	r.handle(DELETE_METHOD, path, handler, middleware)
 }
 
-func (r *Router) POST(path string, handler HandlerFunc) {
-	r.handle(POST_METHOD, path, handler)
+func (r *Router) PATCH(path string, handler HandlerFunc, middleware ...MiddlewareFunc) {
+	r.handle(PATCH_METHOD, path, handler, middleware)
 }
 
-func (r *Router) PUT(path string, handler HandlerFunc) {
-	r.handle(PUT_METHOD, path, handler)
+// HEAD overrides the automatic HEAD handling derived from the GET route
+func (r *Router) HEAD(path string, handler HandlerFunc, middleware ...MiddlewareFunc) {
+	r.handle(HEAD_METHOD, path, handler, middleware)
 }
 
-func (r *Router) DELETE(path string, handler HandlerFunc) {
-	r.handle(DELETE_METHOD, path, handler)
+// OPTIONS overrides the automatic OPTIONS answer listing the allowed methods
+func (r *Router) OPTIONS(path string, handler HandlerFunc, middleware ...MiddlewareFunc) {
+	r.handle(OPTIONS_METHOD, path, handler, middleware)
 }
 
+// Chain wraps handler so the middleware run in order before it
+func Chain(handler HandlerFunc, middleware ...MiddlewareFunc) HandlerFunc {
+	for i := len(middleware) - 1; i >= 0; i-- {
+		mw, next := middleware[i], handler
+		handler = func(ctx *HttpContext) {
+			mw(ctx, next)
+		}
+	}
+	return handler
+}
+
+// Dispatch runs the handler matching the request. Unknown paths get 404, known
+// paths with another method 405 with an Allow header, OPTIONS lists the methods.
+func (r *Router) Dispatch(ctx *HttpContext) {
+	handler, found := r.FindHandler(ctx.Request)
+	if !found {
+		allowed := r.AllowedMethods(ctx.Request.escapedPath())
+		switch {
+		case len(allowed) == 0:
+			ctx.Text(StatusNotFound, StatusTextNotFound)
+		case ctx.Request.Method == OPTIONS_METHOD:
+			ctx.Response.Headers["Allow"] = strings.Join(allowed, ", ")
+			ctx.Response.StatusCode = StatusNoContent
+		default:
+			ctx.Response.Headers["Allow"] = strings.Join(allowed, ", ")
+			ctx.JSON(StatusMethodNotAllowed, Generalesponse{
+				"error":   fmt.Sprintf("method %s not allowed on %s", ctx.Request.Method, ctx.Request.Path),
+				"message": StatusCodeText[StatusMethodNotAllowed],
+			})
+		}
+		return
+	}
+	// invoke handler
+	handler(ctx)
+}
+
+// FindHandler returns the handler registered for the request method and path.
+// HEAD requests fall back to the GET route of the path.
 func (r *Router) FindHandler(req *HttpRequest) (HandlerFunc, bool) {
-	reqPathParts := strings.Split(strings.Trim(req.Path, "/"), "/")
+	if handler, found := r.findHandler(req.Method, req); found {
+		return handler, true
+	}
+	if req.Method == HEAD_METHOD {
+		return r.findHandler(GET_METHOD, req)
+	}
+	return nil, false
+}
+
+func (r *Router) findHandler(method string, req *HttpRequest) (HandlerFunc, bool) {
+	reqPathParts := splitPath(req.escapedPath())
 
 	// First pass: Look for exact matches
 	for _, route := range r.routes {
-		if route.Method != req.Method {
-			continue
-		}
-		routePathParts := strings.Split(strings.Trim(route.Path, "/"), "/")
-		if len(routePathParts) != len(reqPathParts) {
+		if route.Method != method {
 			continue
 		}
-		isExactMatch := true
-		for i, routePart := range routePathParts {
-			if strings.HasPrefix(routePart, ":") {
-				isExactMatch = false // Contains a parameter, not an exact match
-				break
-			}
-			if routePart != reqPathParts[i] {
-				isExactMatch = false
-				break
-			}
-		}
-		if isExactMatch {
+		if len(route.Params) == 0 && matchPath(splitPath(route.Path), reqPathParts, nil) {
 			req.PathParms = make(PathParams) // No params for exact match
 			return route.Handler, true
 		}
 	}
 
-	// Second pass: Look for parameterized matches
-	for _, route := range r.routes {
-		if route.Method != req.Method {
-			continue
+	// Second pass: Look for parameterized matches, then for catch-all ones
+	for _, wildcard := range []bool{false, true} {
+		for _, route := range r.routes {
+			if route.Method != method || len(route.Params) == 0 || route.Wildcard != wildcard {
+				continue
+			}
+			params := make(PathParams)
+			if matchPath(splitPath(route.Path), reqPathParts, params) {
+				req.PathParms = params
+				return route.Handler, true
+			}
 		}
-		routePathParts := strings.Split(strings.Trim(route.Path, "/"), "/")
-		if len(routePathParts) != len(reqPathParts) {
-			continue
+	}
+
+	return nil, false
+}
+
+// AllowedMethods lists the methods registered for the escaped path, for the Allow header.
+// HEAD is included when GET is, OPTIONS is always answered.
+func (r *Router) AllowedMethods(path string) []string {
+	reqPathParts := splitPath(path)
+	seen := map[string]bool{}
+	methods := []string{}
+	add := func(method string) {
+		if !seen[method] {
+			seen[method] = true
+			methods = append(methods, method)
 		}
-		matches := true
-		req.PathParms = make(PathParams)
-		for i, routePart := range routePathParts {
-			reqPart := reqPathParts[i]
-			if strings.HasPrefix(routePart, ":") {
-				paramName := strings.TrimPrefix(routePart, ":")
-				req.PathParms[paramName] = reqPart
-			} else if routePart != reqPart {
-				matches = false
-				break
+	}
+	for _, route := range r.routes {
+		if matchPath(splitPath(route.Path), reqPathParts, nil) {
+			add(route.Method)
+			if route.Method == GET_METHOD {
+				add(HEAD_METHOD)
 			}
 		}
-		if matches {
-			return route.Handler, true
+	}
+	if len(methods) > 0 {
+		add(OPTIONS_METHOD)
+	}
+	return methods
+}
+
+// splitPath splits an escaped path into its decoded segments
+func splitPath(path string) []string {
+	parts := strings.Split(strings.Trim(path, "/"), "/")
+	for i, part := range parts {
+		if decoded, err := url.PathUnescape(part); err == nil {
+			parts[i] = decoded
 		}
 	}
+	return parts
+}
 
-	return nil, false
+// matchPath reports whether the request path parts match the route parts,
+// filling params (when not nil) with the values of ":name" segments and the
+// rest of the path for a final "*name" segment (possibly empty)
+func matchPath(routePathParts, reqPathParts []string, params PathParams) bool {
+	last := len(routePathParts) - 1
+	if strings.HasPrefix(routePathParts[last], "*") {
+		if len(reqPathParts) < last {
+			return false
+		}
+		if params != nil {
+			params[strings.TrimPrefix(routePathParts[last], "*")] = strings.Join(reqPathParts[last:], "/")
+		}
+		routePathParts, reqPathParts = routePathParts[:last], reqPathParts[:last]
+	}
+	if len(routePathParts) != len(reqPathParts) {
+		return false
+	}
+	for i, routePart := range routePathParts {
+		reqPart := reqPathParts[i]
+		if strings.HasPrefix(routePart, ":") {
+			if params != nil {
+				params[strings.TrimPrefix(routePart, ":")] = reqPart
+			}
+		} else if routePart != reqPart {
+			return false
+		}
+	}
+	return true
 }
@@ -0,0 +1,56 @@
+package server
+
+import (
+	"io"
+	"net/http"
+	"testing"
+)
+
+func TestRouterHeadAndOptions(t *testing.T) {
+	s := NewHttpServer("")
+	s.GET("/runs/:id", func(ctx *HttpContext) { ctx.Text(StatusOK, "run details") })
+	s.POST("/runs/:id", func(ctx *HttpContext) { ctx.Text(StatusCreated, "created") })
+	s.DELETE("/runs/:id", func(ctx *HttpContext) { ctx.Text(StatusNoContent, "") })
+	addr := startServer(t, s)
+
+	// HEAD answers like GET without the body; the GET pipelined after it
+	// only parses if no body bytes were sent
+	conn, reader := dial(t, addr)
+	conn.Write([]byte("HEAD /runs/42 HTTP/1.1\r\n\r\nGET /runs/42 HTTP/1.1\r\n\r\n"))
+	head, err := http.ReadResponse(reader, &http.Request{Method: "HEAD"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if head.Status != "200 OK" || head.ContentLength != int64(len("run details")) {
+		t.Errorf("HEAD: status = %q, content length = %d", head.Status, head.ContentLength)
+	}
+	get, err := http.ReadResponse(reader, nil)
+	if err != nil {
+		t.Fatalf("response after HEAD: %v", err)
+	}
+	body, _ := io.ReadAll(get.Body)
+	get.Body.Close()
+	if string(body) != "run details" {
+		t.Errorf("GET after HEAD: body = %q", body)
+	}
+
+	conn.Write([]byte("OPTIONS /runs/42 HTTP/1.1\r\n\r\n"))
+	options, err := http.ReadResponse(reader, &http.Request{Method: "OPTIONS"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	options.Body.Close()
+	if options.Status != "204 No Content" || options.Header.Get("Allow") != "GET, HEAD, POST, DELETE, OPTIONS" {
+		t.Errorf("OPTIONS: status = %q, allow = %q", options.Status, options.Header.Get("Allow"))
+	}
+
+	conn.Write([]byte("PUT /runs/42 HTTP/1.1\r\nContent-Length: 0\r\n\r\n"))
+	put, err := http.ReadResponse(reader, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	put.Body.Close()
+	if put.Status != "405 Method Not Allowed" || put.Header.Get("Allow") != "GET, HEAD, POST, DELETE, OPTIONS" {
+		t.Errorf("PUT: status = %q, allow = %q", put.Status, put.Header.Get("Allow"))
+	}
+}
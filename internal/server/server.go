@@ -1,22 +1,67 @@
 package server
 
 import (
+	"bufio"
+	"context"
+	"crypto/tls"
+	"errors"
 	"fmt"
 	"net"
+	"sync"
+	"time"
 )
 
 // Custom Datatypes
 type Generalesponse map[string]interface{}
 
+// Defaults for persistent connections and request limits
+const (
+	DefaultIdleTimeout        = 60 * time.Second
+	DefaultMaxRequestsPerConn = 100
+	DefaultReadHeaderTimeout  = 10 * time.Second
+	DefaultReadTimeout        = 30 * time.Second
+	DefaultMaxBodySize        = 10 << 20 // 10 MB, large GitHub push payloads stay well below
+	DefaultMaxHeaderBytes     = 1 << 20  // 1 MB for the request line and headers
+)
+
 type Server struct {
 	Addr   string
 	Router *Router
+	// Persistent connections
+	IdleTimeout        time.Duration // how long to wait for the next request on a kept-alive connection
+	MaxRequestsPerConn int           // close the connection after this many requests, 0 means no limit
+	// Request limits, so slow or oversized clients cannot hold connections forever
+	ReadHeaderTimeout time.Duration // time allowed to send the request line and headers
+	ReadTimeout       time.Duration // time allowed to send the body
+	MaxBodySize       int64         // larger bodies are answered with 413, 0 means no limit
+	MaxHeaderBytes    int           // larger request heads are answered with 431, 0 means DefaultMaxHeaderBytes
+
+	// TLS serves HTTPS when set, see NewTLSConfig
+	TLSConfig *tls.Config
+
+	middleware []MiddlewareFunc // run for every request, including unmatched ones
+
+	// Graceful shutdown
+	mu           sync.Mutex
+	listener     net.Listener
+	conns        map[net.Conn]bool // true while a request is being served on the connection
+	shuttingDown bool
 }
 
+// ErrServerClosed is returned by Start after Shutdown
+var ErrServerClosed = errors.New("server closed")
+
 func NewHttpServer(addr string) *Server {
 	return &Server{
-		Addr:   addr,
-		Router: NewRouter(),
+		Addr:               addr,
+		Router:             NewRouter(),
+		IdleTimeout:        DefaultIdleTimeout,
+		MaxRequestsPerConn: DefaultMaxRequestsPerConn,
+		ReadHeaderTimeout:  DefaultReadHeaderTimeout,
+		ReadTimeout:        DefaultReadTimeout,
+		MaxBodySize:        DefaultMaxBodySize,
+		MaxHeaderBytes:     DefaultMaxHeaderBytes,
+		conns:              make(map[net.Conn]bool),
 	}
 }
 
@@ -25,12 +70,26 @@ func (s *Server) Start() error {
 	if err != nil {
 		return fmt.Errorf("error starting server: %v", err)
 	}
+	if s.TLSConfig != nil {
+		listener = tls.NewListener(listener, s.TLSConfig)
+	}
 	defer listener.Close()
 
-	fmt.Printf("Server listening on %s\n", s.Addr)
+	s.mu.Lock()
+	if s.shuttingDown {
+		s.mu.Unlock()
+		return ErrServerClosed
+	}
+	s.listener = listener
+	s.mu.Unlock()
+
+	fmt.Printf("Server listening on %s (tls: %v)\n", s.Addr, s.TLSConfig != nil)
 	for {
 		conn, err := listener.Accept()
 		if err != nil {
+			if s.isShuttingDown() {
+				return ErrServerClosed
+			}
 			fmt.Printf("Error accepting connection: %v\n", err)
 			continue
 		}
@@ -38,43 +97,195 @@ func (s *Server) Start() error {
 	}
 }
 
+// Shutdown stops accepting connections, closes idle ones and waits for the
+// requests in flight to finish. Connections still busy when ctx is done are closed.
+func (s *Server) Shutdown(ctx context.Context) error {
+	s.mu.Lock()
+	s.shuttingDown = true
+	if s.listener != nil {
+		s.listener.Close()
+	}
+	for conn, busy := range s.conns {
+		if !busy {
+			conn.Close()
+		}
+	}
+	s.mu.Unlock()
+
+	ticker := time.NewTicker(50 * time.Millisecond)
+	defer ticker.Stop()
+	for {
+		s.mu.Lock()
+		remaining := len(s.conns)
+		s.mu.Unlock()
+		if remaining == 0 {
+			return nil
+		}
+		select {
+		case <-ctx.Done():
+			s.mu.Lock()
+			for conn := range s.conns {
+				conn.Close()
+			}
+			s.mu.Unlock()
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
+
+func (s *Server) isShuttingDown() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.shuttingDown
+}
+
+// setConnBusy tracks whether a request is being served on conn. It returns
+// false when the server is shutting down and the connection should be closed.
+func (s *Server) setConnBusy(conn net.Conn, busy bool) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.shuttingDown && !busy {
+		return false
+	}
+	s.conns[conn] = busy
+	return true
+}
+
+func (s *Server) forgetConn(conn net.Conn) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.conns, conn)
+}
+
+// handleIncomingConnection serves requests on the connection until the client
+// closes it, asks for Connection: close, idles out or reaches MaxRequestsPerConn
 func (s *Server) handleIncomingConnection(conn net.Conn) {
 	defer conn.Close()
-	request, err := ParseRequest(conn)
+	defer s.forgetConn(conn)
+	reader := bufio.NewReader(conn)
+	for served := 1; ; served++ {
+		if !s.setConnBusy(conn, false) {
+			return
+		}
+		request, err := s.readRequest(conn, reader)
+		if err != nil {
+			if errors.Is(err, errNoRequest) {
+				return // client went away or stayed idle, nothing to answer
+			}
+			ctx := NewHttpContext(conn, &HttpRequest{})
+			switch {
+			case errors.Is(err, errBodyTooLarge):
+				ctx.Text(StatusRequestEntityTooLarge, StatusTextRequestEntityTooLarge)
+			case errors.Is(err, errHeaderTooLarge):
+				ctx.Text(StatusRequestHeaderFieldsTooLarge, StatusTextRequestHeaderFieldsTooLarge)
+			case isTimeout(err):
+				ctx.Text(StatusRequestTimeout, StatusTextRequestTimeout)
+			default:
+				ctx.Text(StatusBadRequest, StatusTextBadRequest)
+			}
+			ctx.Response.Headers["Connection"] = "close"
+			ctx.WriteResponse()
+			return
+		}
+
+		keepAlive := request.wantsKeepAlive() && (s.MaxRequestsPerConn <= 0 || served < s.MaxRequestsPerConn) && !s.isShuttingDown()
+		ctx := NewHttpContext(conn, request)
+		s.serve(ctx)
+		ctx.Response.omitBody = request.Method == HEAD_METHOD
+		if keepAlive {
+			ctx.Response.Headers["Connection"] = "keep-alive"
+		} else {
+			ctx.Response.Headers["Connection"] = "close"
+		}
+		if err := ctx.WriteResponse(); err != nil {
+			fmt.Printf("Error writing response: %v\n", err)
+			return
+		}
+		if !keepAlive {
+			return
+		}
+	}
+}
+
+// readRequest waits up to IdleTimeout for the next request, then applies
+// ReadHeaderTimeout to the request head and ReadTimeout to the body
+func (s *Server) readRequest(conn net.Conn, reader *bufio.Reader) (*HttpRequest, error) {
+	setDeadline(conn, s.IdleTimeout)
+	if _, err := reader.Peek(1); err != nil {
+		return nil, fmt.Errorf("%w: %v", errNoRequest, err)
+	}
+	s.setConnBusy(conn, true) // bytes arrived, serve this request even if shutdown started meanwhile
+
+	setDeadline(conn, s.ReadHeaderTimeout)
+	maxHeaderBytes := s.MaxHeaderBytes
+	if maxHeaderBytes <= 0 {
+		maxHeaderBytes = DefaultMaxHeaderBytes
+	}
+	request, err := readRequestHead(reader, maxHeaderBytes)
 	if err != nil {
-		ctx := NewHttpContext(conn, &HttpRequest{})
-		ctx.Text(400, "Bad Request")
-		ctx.WriteResponse()
-		return
+		return nil, err
 	}
 
-	handler, found := s.Router.FindHandler(request)
-	if !found {
-		ctx := NewHttpContext(conn, request)
-		ctx.Text(404, "Not Found")
-		ctx.WriteResponse()
-		return
+	setDeadline(conn, s.ReadTimeout)
+	if err := request.readBody(reader, s.MaxBodySize); err != nil {
+		return nil, err
 	}
-	ctx := NewHttpContext(conn, request)
-	// invoke handler
-	handler(ctx)
+	conn.SetReadDeadline(time.Time{})
+	return request, nil
+}
 
-	if err := ctx.WriteResponse(); err != nil {
-		fmt.Printf("Error writing response: %v\n", err)
+// setDeadline limits the next reads to timeout, or lifts the limit when timeout is 0
+func setDeadline(conn net.Conn, timeout time.Duration) {
+	if timeout > 0 {
+		conn.SetReadDeadline(time.Now().Add(timeout))
+	} else {
+		conn.SetReadDeadline(time.Time{})
 	}
+}
+
+func isTimeout(err error) bool {
+	var netErr net.Error
+	return errors.As(err, &netErr) && netErr.Timeout()
+}
+
+// Use adds middleware that runs for every request, before the route middleware
+func (s *Server) Use(middleware ...MiddlewareFunc) {
+	s.middleware = append(s.middleware, middleware...)
+}
+
+// serve dispatches a single request through the server middleware to its handler
+func (s *Server) serve(ctx *HttpContext) {
+	Chain(s.dispatch, s.middleware...)(ctx)
+}
 
+func (s *Server) dispatch(ctx *HttpContext) {
+	s.Router.Dispatch(ctx)
 }
-func (s *Server) GET(path string, handler HandlerFunc) {
-	s.Router.GET(path, handler)
+
+func (s *Server) GET(path string, handler HandlerFunc, middleware ...MiddlewareFunc) {
+	s.Router.GET(path, handler, middleware...)
+}
+func (s *Server) POST(path string, handler HandlerFunc, middleware ...MiddlewareFunc) {
+	s.Router.POST(path, handler, middleware...)
+}
+
+func (s *Server) PUT(path string, handler HandlerFunc, middleware ...MiddlewareFunc) {
+	s.Router.PUT(path, handler, middleware...)
 }
-func (s *Server) POST(path string, handler HandlerFunc) {
-	s.Router.POST(path, handler)
+
+func (s *Server) DELETE(path string, handler HandlerFunc, middleware ...MiddlewareFunc) {
+	s.Router.DELETE(path, handler, middleware...)
+}
+
+func (s *Server) PATCH(path string, handler HandlerFunc, middleware ...MiddlewareFunc) {
+	s.Router.PATCH(path, handler, middleware...)
 }
 
-func (s *Server) PUT(path string, handler HandlerFunc) {
-	s.Router.PUT(path, handler)
+func (s *Server) HEAD(path string, handler HandlerFunc, middleware ...MiddlewareFunc) {
+	s.Router.HEAD(path, handler, middleware...)
 }
 
-func (s *Server) DELETE(path string, handler HandlerFunc) {
-	s.Router.DELETE(path, handler)
+func (s *Server) OPTIONS(path string, handler HandlerFunc, middleware ...MiddlewareFunc) {
+	s.Router.OPTIONS(path, handler, middleware...)
 }
@@ -0,0 +1,167 @@
+package server
+
+import (
+	"bufio"
+	"context"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+// startServer serves s on a loopback port until the test ends and returns its address
+func startServer(t *testing.T, s *Server) string {
+	t.Helper()
+	s.Addr = "127.0.0.1:0"
+	go s.Start()
+	t.Cleanup(func() {
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		defer cancel()
+		s.Shutdown(ctx)
+	})
+	for range 100 {
+		s.mu.Lock()
+		listener := s.listener
+		s.mu.Unlock()
+		if listener != nil {
+			return listener.Addr().String()
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatal("server did not start")
+	return ""
+}
+
+func dial(t *testing.T, addr string) (net.Conn, *bufio.Reader) {
+	t.Helper()
+	conn, err := net.Dial("tcp", addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	conn.SetDeadline(time.Now().Add(5 * time.Second))
+	return conn, bufio.NewReader(conn)
+}
+
+func TestServerRejectsOversizedBodies(t *testing.T) {
+	s := NewHttpServer("")
+	s.MaxBodySize = 8
+	s.POST("/hooks", func(ctx *HttpContext) { ctx.Text(StatusOK, string(ctx.Request.Body)) })
+	addr := startServer(t, s)
+
+	for name, raw := range map[string]string{
+		"content-length": "POST /hooks HTTP/1.1\r\nContent-Length: 9\r\n\r\n123456789",
+		"chunked":        "POST /hooks HTTP/1.1\r\nTransfer-Encoding: chunked\r\n\r\n5\r\n12345\r\n4\r\n6789\r\n0\r\n\r\n",
+	} {
+		conn, reader := dial(t, addr)
+		conn.Write([]byte(raw))
+		res, err := http.ReadResponse(reader, nil)
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		res.Body.Close()
+		if res.StatusCode != StatusRequestEntityTooLarge || !res.Close {
+			t.Errorf("%s: code = %d, close = %v", name, res.StatusCode, res.Close)
+		}
+	}
+
+	conn, reader := dial(t, addr)
+	conn.Write([]byte("POST /hooks HTTP/1.1\r\nTransfer-Encoding: chunked\r\n\r\n4\r\n1234\r\n4\r\n5678\r\n0\r\n\r\n"))
+	res, err := http.ReadResponse(reader, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, _ := io.ReadAll(res.Body)
+	res.Body.Close()
+	if res.StatusCode != StatusOK || string(body) != "12345678" {
+		t.Errorf("within limit: code = %d, body = %q", res.StatusCode, body)
+	}
+}
+
+func TestServerRejectsOversizedHeaders(t *testing.T) {
+	s := NewHttpServer("")
+	s.MaxHeaderBytes = 1024
+	s.GET("/", func(ctx *HttpContext) { ctx.Text(StatusOK, "ok") })
+	addr := startServer(t, s)
+
+	conn, reader := dial(t, addr)
+	conn.Write([]byte("GET / HTTP/1.1\r\nX-Pad: " + strings.Repeat("a", 4096) + "\r\n\r\n"))
+	res, err := http.ReadResponse(reader, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	res.Body.Close()
+	if res.StatusCode != StatusRequestHeaderFieldsTooLarge || !res.Close {
+		t.Errorf("code = %d, close = %v", res.StatusCode, res.Close)
+	}
+}
+
+func TestServerKeepAlive(t *testing.T) {
+	s := NewHttpServer("")
+	s.IdleTimeout = 100 * time.Millisecond
+	s.GET("/ping/:n", func(ctx *HttpContext) {
+		n, _ := ctx.Param("n")
+		ctx.Text(StatusOK, "pong "+n)
+	})
+	addr := startServer(t, s)
+	read := func(reader *bufio.Reader) (*http.Response, string) {
+		t.Helper()
+		res, err := http.ReadResponse(reader, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		body, _ := io.ReadAll(res.Body)
+		res.Body.Close()
+		return res, string(body)
+	}
+
+	// Two requests one after the other, then two pipelined ones, on the same connection
+	conn, reader := dial(t, addr)
+	conn.Write([]byte("GET /ping/1 HTTP/1.1\r\n\r\n"))
+	if res, body := read(reader); res.Close || body != "pong 1" {
+		t.Fatalf("first: close = %v, body = %q", res.Close, body)
+	}
+	conn.Write([]byte("GET /ping/2 HTTP/1.1\r\n\r\nGET /ping/3 HTTP/1.1\r\nConnection: close\r\n\r\n"))
+	if _, body := read(reader); body != "pong 2" {
+		t.Errorf("second: body = %q", body)
+	}
+	if res, body := read(reader); !res.Close || body != "pong 3" {
+		t.Errorf("third: close = %v, body = %q", res.Close, body)
+	}
+	if _, err := reader.ReadByte(); err != io.EOF {
+		t.Errorf("connection still open after Connection: close: %v", err)
+	}
+
+	// An idle connection is closed once IdleTimeout passes
+	conn, reader = dial(t, addr)
+	conn.Write([]byte("GET /ping/4 HTTP/1.1\r\n\r\n"))
+	read(reader)
+	start := time.Now()
+	if _, err := reader.ReadByte(); err != io.EOF {
+		t.Errorf("idle connection: %v", err)
+	}
+	if waited := time.Since(start); waited < 50*time.Millisecond || waited > 2*time.Second {
+		t.Errorf("closed after %v, want about %v", waited, s.IdleTimeout)
+	}
+}
+
+func TestServerReadTimeout(t *testing.T) {
+	s := NewHttpServer("")
+	s.ReadHeaderTimeout = 100 * time.Millisecond
+	s.GET("/", func(ctx *HttpContext) { ctx.Text(StatusOK, "ok") })
+	addr := startServer(t, s)
+
+	// The head never ends, the server answers 408 and hangs up
+	conn, reader := dial(t, addr)
+	conn.Write([]byte("GET / HTTP/1.1\r\nX-Slow: 1\r\n"))
+	res, err := http.ReadResponse(reader, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	res.Body.Close()
+	if res.StatusCode != StatusRequestTimeout || !res.Close {
+		t.Errorf("code = %d, close = %v", res.StatusCode, res.Close)
+	}
+}
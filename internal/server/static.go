@@ -0,0 +1,227 @@
+package server
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"mime"
+	"net/http"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// staticPathParam is the catch-all parameter holding the requested file path
+const staticPathParam = "filepath"
+
+// errRangeNotSatisfiable means the Range header asks for bytes outside the file
+var errRangeNotSatisfiable = errors.New("range not satisfiable")
+
+// Static serves the files under root at prefix, e.g. Static("/artifacts", "/var/goflow/out")
+func (r *Router) Static(prefix, root string, middleware ...MiddlewareFunc) {
+	r.GET(strings.TrimRight(prefix, "/")+"/*"+staticPathParam, StaticFiles(root), middleware...)
+}
+
+func (s *Server) Static(prefix, root string, middleware ...MiddlewareFunc) {
+	s.Router.Static(prefix, root, middleware...)
+}
+
+// StaticFiles serves the file named by the "*filepath" route parameter from root.
+// Directories serve their index.html. Responses carry Content-Type, ETag and
+// Last-Modified, answer If-None-Match with 304 and single byte ranges with 206.
+func StaticFiles(root string) HandlerFunc {
+	fsys := os.DirFS(root)
+	return func(ctx *HttpContext) {
+		name, _ := ctx.Param(staticPathParam)
+		serveFile(ctx, fsys, name)
+	}
+}
+
+func serveFile(ctx *HttpContext, fsys fs.FS, name string) {
+	name = strings.TrimPrefix(path.Clean("/"+name), "/") // no way out of root through ".."
+	if name == "" {
+		name = "."
+	}
+	file, info, err := openFile(fsys, name)
+	if err != nil {
+		switch {
+		case errors.Is(err, fs.ErrNotExist), errors.Is(err, fs.ErrInvalid):
+			ctx.Text(StatusNotFound, StatusTextNotFound)
+		case errors.Is(err, fs.ErrPermission):
+			ctx.Text(StatusForbidden, StatusCodeText[StatusForbidden])
+		default:
+			ctx.Text(StatusInternalServerError, StatusTextInternalServerError)
+		}
+		return
+	}
+	// Closed here unless the response streams it
+	streaming := false
+	defer func() {
+		if !streaming {
+			file.Close()
+		}
+	}()
+
+	size := info.Size()
+	etag := fmt.Sprintf(`"%x-%x"`, info.ModTime().UnixNano(), size)
+	lastModified := info.ModTime().UTC().Format(http.TimeFormat)
+	headers := ctx.Response.Headers
+	headers["ETag"] = etag
+	headers["Last-Modified"] = lastModified
+	headers["Accept-Ranges"] = "bytes"
+
+	if match, err := ctx.Request.GetHeader("If-None-Match"); err == nil && etagMatches(match, etag) {
+		ctx.Response.StatusCode = StatusNotModified
+		return
+	}
+
+	start, length := int64(0), size
+	status := StatusOK
+	if rangeHeader, err := ctx.Request.GetHeader("Range"); err == nil && ifRangeMatches(ctx.Request, etag, lastModified) {
+		rangeStart, rangeEnd, ok, err := parseRange(rangeHeader, size)
+		if err != nil {
+			headers["Content-Range"] = fmt.Sprintf("bytes */%d", size)
+			ctx.Text(StatusRequestedRangeNotSatisfiable, StatusCodeText[StatusRequestedRangeNotSatisfiable])
+			return
+		}
+		if ok {
+			start, length = rangeStart, rangeEnd-rangeStart+1
+			status = StatusPartialContent
+			headers["Content-Range"] = fmt.Sprintf("bytes %d-%d/%d", rangeStart, rangeEnd, size)
+		}
+	}
+
+	contentType := mime.TypeByExtension(path.Ext(info.Name()))
+	if contentType == "" {
+		contentType = sniffContentType(file, size)
+	}
+	body, err := fileSection(file, start, length)
+	if err != nil {
+		ctx.Text(StatusInternalServerError, StatusTextInternalServerError)
+		return
+	}
+	headers["Content-Type"] = contentType
+	headers["Content-Length"] = strconv.FormatInt(length, 10)
+	ctx.Response.StatusCode = status
+	ctx.Response.BodyReader = struct {
+		io.Reader
+		io.Closer
+	}{body, file}
+	streaming = true
+}
+
+// openFile opens name, or the index.html of a directory
+func openFile(fsys fs.FS, name string) (fs.File, fs.FileInfo, error) {
+	file, err := fsys.Open(name)
+	if err != nil {
+		return nil, nil, err
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return nil, nil, err
+	}
+	if info.IsDir() {
+		file.Close()
+		return openFile(fsys, path.Join(name, "index.html"))
+	}
+	return file, info, nil
+}
+
+// fileSection returns a reader of length bytes of the file starting at offset
+// start, streaming them rather than reading them into memory
+func fileSection(file fs.File, start, length int64) (io.Reader, error) {
+	if ra, ok := file.(io.ReaderAt); ok {
+		return io.NewSectionReader(ra, start, length), nil
+	}
+	if seeker, ok := file.(io.Seeker); ok {
+		if _, err := seeker.Seek(start, io.SeekStart); err != nil {
+			return nil, err
+		}
+	} else if _, err := io.CopyN(io.Discard, file, start); err != nil {
+		return nil, err
+	}
+	return io.LimitReader(file, length), nil
+}
+
+// sniffContentType detects the content type from the first bytes of the file
+func sniffContentType(file fs.File, size int64) string {
+	ra, ok := file.(io.ReaderAt)
+	if !ok {
+		return "application/octet-stream"
+	}
+	head := make([]byte, min(size, 512))
+	n, _ := ra.ReadAt(head, 0)
+	return http.DetectContentType(head[:n])
+}
+
+// etagMatches checks an If-None-Match list ("*" or comma separated, weak tags compare equal)
+func etagMatches(header, etag string) bool {
+	for _, candidate := range strings.Split(header, ",") {
+		candidate = strings.TrimSpace(candidate)
+		if candidate == "*" || strings.TrimPrefix(candidate, "W/") == etag {
+			return true
+		}
+	}
+	return false
+}
+
+// ifRangeMatches reports whether a Range header applies: without If-Range it
+// always does, otherwise only while the file still has the given ETag or date
+func ifRangeMatches(req *HttpRequest, etag, lastModified string) bool {
+	ifRange, err := req.GetHeader("If-Range")
+	if err != nil {
+		return true
+	}
+	if strings.HasPrefix(ifRange, `"`) {
+		return ifRange == etag
+	}
+	since, err := time.Parse(http.TimeFormat, ifRange)
+	modified, _ := time.Parse(http.TimeFormat, lastModified)
+	return err == nil && !modified.After(since)
+}
+
+// parseRange parses a single "bytes=start-end", "bytes=start-" or "bytes=-suffix"
+// range. ok is false when the header should be ignored and the whole file
+// served, e.g. for multiple ranges or other units.
+func parseRange(header string, size int64) (start, end int64, ok bool, err error) {
+	spec, found := strings.CutPrefix(header, "bytes=")
+	if !found || strings.Contains(spec, ",") {
+		return 0, 0, false, nil
+	}
+	first, last, found := strings.Cut(strings.TrimSpace(spec), "-")
+	if !found {
+		return 0, 0, false, nil
+	}
+
+	if first == "" { // suffix range: the last n bytes
+		n, parseErr := strconv.ParseInt(last, 10, 64)
+		if parseErr != nil || n < 0 {
+			return 0, 0, false, nil
+		}
+		if n == 0 || size == 0 {
+			return 0, 0, false, errRangeNotSatisfiable
+		}
+		return max(size-n, 0), size - 1, true, nil
+	}
+
+	start, parseErr := strconv.ParseInt(first, 10, 64)
+	if parseErr != nil || start < 0 {
+		return 0, 0, false, nil
+	}
+	if start >= size {
+		return 0, 0, false, errRangeNotSatisfiable
+	}
+	end = size - 1
+	if last != "" {
+		requested, parseErr := strconv.ParseInt(last, 10, 64)
+		if parseErr != nil || requested < start {
+			return 0, 0, false, nil
+		}
+		end = min(requested, size-1)
+	}
+	return start, end, true, nil
+}
@@ -0,0 +1,103 @@
+package server
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestGroupStaticFiles(t *testing.T) {
+	root := t.TempDir()
+	os.MkdirAll(filepath.Join(root, "logs"), 0755)
+	os.WriteFile(filepath.Join(root, "logs", "build.txt"), []byte("0123456789"), 0644)
+	os.WriteFile(filepath.Join(root, "index.html"), []byte("<html>dashboard</html>"), 0644)
+
+	r := NewRouter()
+	calls := 0
+	api := r.Group("/api/v1", func(ctx *HttpContext, next HandlerFunc) {
+		calls++
+		next(ctx)
+	})
+	api.Static("/files", root)
+
+	get := func(path string, headers map[string]string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("GET", path, nil)
+		for k, v := range headers {
+			req.Header.Set(k, v)
+		}
+		rec := httptest.NewRecorder()
+		r.ServeHTTP(rec, req)
+		return rec
+	}
+
+	rec := get("/api/v1/files/logs/build.txt", nil)
+	if rec.Code != StatusOK || rec.Body.String() != "0123456789" {
+		t.Fatalf("code = %d, body = %q", rec.Code, rec.Body.String())
+	}
+	if ct := rec.Header().Get("Content-Type"); ct != "text/plain; charset=utf-8" {
+		t.Errorf("content type = %q", ct)
+	}
+	etag := rec.Header().Get("ETag")
+
+	if rec := get("/api/v1/files/logs/build.txt", map[string]string{"If-None-Match": etag}); rec.Code != StatusNotModified {
+		t.Errorf("If-None-Match: code = %d", rec.Code)
+	}
+
+	rec = get("/api/v1/files/logs/build.txt", map[string]string{"Range": "bytes=2-4"})
+	if rec.Code != StatusPartialContent || rec.Body.String() != "234" || rec.Header().Get("Content-Range") != "bytes 2-4/10" {
+		t.Errorf("range: code = %d, body = %q, content range = %q", rec.Code, rec.Body.String(), rec.Header().Get("Content-Range"))
+	}
+	if rec := get("/api/v1/files/logs/build.txt", map[string]string{"Range": "bytes=-3"}); rec.Body.String() != "789" {
+		t.Errorf("suffix range: body = %q", rec.Body.String())
+	}
+	if rec := get("/api/v1/files/logs/build.txt", map[string]string{"Range": "bytes=20-"}); rec.Code != StatusRequestedRangeNotSatisfiable {
+		t.Errorf("unsatisfiable range: code = %d", rec.Code)
+	}
+
+	if rec := get("/api/v1/files/", nil); rec.Body.String() != "<html>dashboard</html>" {
+		t.Errorf("index: code = %d, body = %q", rec.Code, rec.Body.String())
+	}
+	if rec := get("/api/v1/files/../../etc/passwd", nil); rec.Code != StatusNotFound {
+		t.Errorf("traversal: code = %d", rec.Code)
+	}
+	if calls == 0 {
+		t.Error("group middleware did not run")
+	}
+}
+
+func TestStaticFilesStreamOverConnection(t *testing.T) {
+	root := t.TempDir()
+	data := bytes.Repeat([]byte("0123456789abcdef"), 256<<10) // 4 MB
+	os.WriteFile(filepath.Join(root, "app.bin"), data, 0644)
+	s := NewHttpServer("")
+	s.Use(Compress)
+	s.Static("/artifacts", root)
+	addr := startServer(t, s)
+
+	conn, reader := dial(t, addr)
+	conn.Write([]byte("HEAD /artifacts/app.bin HTTP/1.1\r\n\r\n" +
+		"GET /artifacts/app.bin HTTP/1.1\r\nRange: bytes=1000000-1999999\r\nAccept-Encoding: gzip\r\n\r\n" +
+		"GET /artifacts/app.bin HTTP/1.1\r\n\r\n"))
+	head, err := http.ReadResponse(reader, &http.Request{Method: "HEAD"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if head.ContentLength != int64(len(data)) {
+		t.Errorf("HEAD: content length = %d", head.ContentLength)
+	}
+	for _, want := range [][]byte{data[1000000:2000000], data} {
+		res, err := http.ReadResponse(reader, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		body, _ := io.ReadAll(res.Body)
+		res.Body.Close()
+		if !bytes.Equal(body, want) || res.Header.Get("Content-Type") != "application/octet-stream" {
+			t.Errorf("code = %d, %d bytes, want %d, content type %q", res.StatusCode, len(body), len(want), res.Header.Get("Content-Type"))
+		}
+	}
+}
@@ -0,0 +1,140 @@
+package server
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// certCheckInterval limits how often the certificate files are checked for changes
+const certCheckInterval = 5 * time.Second
+
+// NewTLSConfig builds the listener TLS configuration from PEM files. The
+// certificate is reloaded when the files change, so renewals need no restart.
+// When clientCAFile is set, client certificates signed by it are verified
+// when presented; RequireClientCert enforces them per route.
+func NewTLSConfig(certFile, keyFile, clientCAFile string) (*tls.Config, error) {
+	reloader := &certReloader{certFile: certFile, keyFile: keyFile}
+	if err := reloader.load(); err != nil {
+		return nil, err
+	}
+	tlsConfig := &tls.Config{
+		MinVersion:     tls.VersionTLS12,
+		GetCertificate: reloader.getCertificate,
+	}
+
+	if clientCAFile != "" {
+		pem, err := os.ReadFile(clientCAFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read client CA %s: %v", clientCAFile, err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificates found in client CA %s", clientCAFile)
+		}
+		tlsConfig.ClientCAs = pool
+		tlsConfig.ClientAuth = tls.VerifyClientCertIfGiven
+	}
+	return tlsConfig, nil
+}
+
+// certReloader serves the current certificate and reloads it when the files change
+type certReloader struct {
+	certFile, keyFile string
+
+	mu          sync.Mutex
+	cert        *tls.Certificate
+	certModTime time.Time
+	keyModTime  time.Time
+	lastCheck   time.Time
+}
+
+func (r *certReloader) getCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if time.Since(r.lastCheck) >= certCheckInterval {
+		r.lastCheck = time.Now()
+		if r.changed() {
+			if err := r.loadLocked(); err != nil {
+				// Keep serving the previous certificate until the new files are valid
+				logrus.Errorf("Failed to reload TLS certificate: %v", err)
+			} else {
+				logrus.Infof("Reloaded TLS certificate from %s", r.certFile)
+			}
+		}
+	}
+	return r.cert, nil
+}
+
+func (r *certReloader) load() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.lastCheck = time.Now()
+	return r.loadLocked()
+}
+
+func (r *certReloader) loadLocked() error {
+	cert, err := tls.LoadX509KeyPair(r.certFile, r.keyFile)
+	if err != nil {
+		return fmt.Errorf("failed to load TLS certificate: %v", err)
+	}
+	r.cert = &cert
+	r.certModTime = modTime(r.certFile)
+	r.keyModTime = modTime(r.keyFile)
+	return nil
+}
+
+func (r *certReloader) changed() bool {
+	return !modTime(r.certFile).Equal(r.certModTime) || !modTime(r.keyFile).Equal(r.keyModTime)
+}
+
+func modTime(path string) time.Time {
+	info, err := os.Stat(path)
+	if err != nil {
+		return time.Time{}
+	}
+	return info.ModTime()
+}
+
+// RequireClientCert rejects requests that did not present a client certificate
+// verified against the server's client CA. When names are given, the
+// certificate common name or one of its DNS names must be in the list.
+func RequireClientCert(names ...string) MiddlewareFunc {
+	return func(ctx *HttpContext, next HandlerFunc) {
+		state := ctx.TLSState()
+		if state == nil || len(state.VerifiedChains) == 0 {
+			ctx.JSON(StatusUnauthorized, Generalesponse{
+				"error":   "Client certificate required",
+				"message": StatusCodeText[StatusUnauthorized],
+			})
+			return
+		}
+		if len(names) > 0 && !certNameAllowed(state.VerifiedChains[0][0], names) {
+			ctx.JSON(StatusUnauthorized, Generalesponse{
+				"error":   "Client certificate not allowed",
+				"message": StatusCodeText[StatusUnauthorized],
+			})
+			return
+		}
+		next(ctx)
+	}
+}
+
+func certNameAllowed(cert *x509.Certificate, names []string) bool {
+	for _, name := range names {
+		if cert.Subject.CommonName == name {
+			return true
+		}
+		for _, dnsName := range cert.DNSNames {
+			if dnsName == name {
+				return true
+			}
+		}
+	}
+	return false
+}
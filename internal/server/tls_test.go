@@ -0,0 +1,183 @@
+package server
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// testCA issues certificates for the TLS tests
+type testCA struct {
+	cert   *x509.Certificate
+	key    *ecdsa.PrivateKey
+	pem    []byte
+	serial int64
+}
+
+func newTestCA(t *testing.T) *testCA {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "goFlow test CA"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, _ := x509.ParseCertificate(der)
+	return &testCA{cert: cert, key: key, pem: pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), serial: 1}
+}
+
+// issue writes a certificate and key signed by the CA and returns their paths
+func (ca *testCA) issue(t *testing.T, dir, name string, usage x509.ExtKeyUsage) (string, string) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ca.serial++
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(ca.serial),
+		Subject:      pkix.Name{CommonName: name},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{usage},
+		IPAddresses:  []net.IP{net.ParseIP("127.0.0.1")},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, ca.cert, &key.PublicKey, ca.key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	certFile, keyFile := filepath.Join(dir, name+".crt"), filepath.Join(dir, name+".key")
+	os.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0644)
+	os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), 0600)
+	return certFile, keyFile
+}
+
+func TestTLSClientCertificates(t *testing.T) {
+	ca, dir := newTestCA(t), t.TempDir()
+	caFile := filepath.Join(dir, "ca.crt")
+	os.WriteFile(caFile, ca.pem, 0644)
+	certFile, keyFile := ca.issue(t, dir, "server", x509.ExtKeyUsageServerAuth)
+	tlsConfig, err := NewTLSConfig(certFile, keyFile, caFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s := NewHttpServer("")
+	s.TLSConfig = tlsConfig
+	s.GET("/open", func(ctx *HttpContext) { ctx.Text(StatusOK, "open") })
+	s.GET("/deploy", func(ctx *HttpContext) { ctx.Text(StatusOK, "deploy") }, RequireClientCert("deployer"))
+	addr := startServer(t, s)
+
+	roots := x509.NewCertPool()
+	roots.AppendCertsFromPEM(ca.pem)
+	client := func(name string) *http.Client {
+		config := &tls.Config{RootCAs: roots}
+		if name != "" {
+			cert, err := tls.LoadX509KeyPair(ca.issue(t, dir, name, x509.ExtKeyUsageClientAuth))
+			if err != nil {
+				t.Fatal(err)
+			}
+			config.Certificates = []tls.Certificate{cert}
+		}
+		return &http.Client{Transport: &http.Transport{TLSClientConfig: config}, Timeout: 5 * time.Second}
+	}
+
+	cases := []struct {
+		client, path string
+		code         int
+	}{
+		{"", "/open", StatusOK},
+		{"", "/deploy", StatusUnauthorized},
+		{"intruder", "/deploy", StatusUnauthorized},
+		{"deployer", "/deploy", StatusOK},
+	}
+	for _, c := range cases {
+		res, err := client(c.client).Get("https://" + addr + c.path)
+		if err != nil {
+			t.Fatalf("client %q, %s: %v", c.client, c.path, err)
+		}
+		res.Body.Close()
+		if res.StatusCode != c.code {
+			t.Errorf("client %q, %s: code = %d, want %d", c.client, c.path, res.StatusCode, c.code)
+		}
+	}
+
+	// Certificates from another CA are refused during the handshake
+	other := newTestCA(t)
+	cert, _ := tls.LoadX509KeyPair(other.issue(t, t.TempDir(), "deployer", x509.ExtKeyUsageClientAuth))
+	foreign := &http.Client{Transport: &http.Transport{TLSClientConfig: &tls.Config{
+		RootCAs: roots, Certificates: []tls.Certificate{cert},
+	}}}
+	if res, err := foreign.Get("https://" + addr + "/deploy"); err == nil {
+		res.Body.Close()
+		t.Errorf("certificate of another CA accepted: code = %d", res.StatusCode)
+	}
+}
+
+func TestCertReloader(t *testing.T) {
+	ca, dir := newTestCA(t), t.TempDir()
+	certFile, keyFile := ca.issue(t, dir, "server", x509.ExtKeyUsageServerAuth)
+	r := &certReloader{certFile: certFile, keyFile: keyFile}
+	if err := r.load(); err != nil {
+		t.Fatal(err)
+	}
+	serial := func() int64 {
+		t.Helper()
+		cert, err := r.getCertificate(nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		leaf, _ := x509.ParseCertificate(cert.Certificate[0])
+		return leaf.SerialNumber.Int64()
+	}
+	first := serial()
+
+	// A renewal is picked up at the next check
+	ca.issue(t, dir, "server", x509.ExtKeyUsageServerAuth)
+	later := time.Now().Add(time.Minute)
+	os.Chtimes(certFile, later, later)
+	os.Chtimes(keyFile, later, later)
+	if serial() != first {
+		t.Error("certificate reloaded before the check interval passed")
+	}
+	r.lastCheck = time.Time{}
+	renewed := serial()
+	if renewed == first {
+		t.Fatal("renewed certificate not loaded")
+	}
+
+	// Broken files keep the previous certificate in service
+	os.WriteFile(keyFile, []byte("garbage"), 0600)
+	os.Chtimes(keyFile, later.Add(time.Minute), later.Add(time.Minute))
+	r.lastCheck = time.Time{}
+	if serial() != renewed {
+		t.Error("broken renewal replaced the certificate")
+	}
+}
@@ -1,15 +1,35 @@
 package status
 
 import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
 	"sync"
+	"time"
 
+	"github.com/khaledibrahim1015/goFlow-cicd/internal/deployments"
 	"github.com/khaledibrahim1015/goFlow-cicd/internal/server"
+	"github.com/khaledibrahim1015/goFlow-cicd/internal/store"
 )
 
 type PipelineStatus struct {
-	ID     string `json:"id"`
-	Status string `json:"status"` // "running", "success", "failed"
-	Error  string `json:"error,omitempty"`
+	ID           string             `json:"id"`
+	Repository   string             `json:"repository,omitempty"`
+	Ref          string             `json:"ref,omitempty"`
+	Commit       string             `json:"commit,omitempty"`
+	Trigger      string             `json:"trigger,omitempty"` // "webhook", "poll", "schedule", "manual", "rerun", "promotion"
+	TriggeredBy  string             `json:"triggered_by,omitempty"`
+	RerunOf      string             `json:"rerun_of,omitempty"`
+	Environment  string             `json:"environment,omitempty"`
+	PromotedFrom string             `json:"promoted_from,omitempty"` // run whose commit was promoted to Environment
+	ApprovedBy   string             `json:"approved_by,omitempty"`
+	CancelledBy  string             `json:"cancelled_by,omitempty"`
+	Env          map[string]string  `json:"-"`      // manual overrides, persisted but kept out of responses
+	Status       string             `json:"status"` // "queued", "cloning", "running", "waiting_approval", "deploy_blocked", "cancelling", "success", "deploy_skipped", "failed", "cancelled", "interrupted"
+	Error        string             `json:"error,omitempty"`
+	Hosts        []deployments.Host `json:"hosts,omitempty"` // progress of ssh deploys, per host
+	// Why the deploy is held ("deploy_blocked") or was skipped ("deploy_skipped")
+	DeployBlocked string `json:"deploy_blocked,omitempty"`
 }
 
 var (
@@ -17,15 +37,137 @@ var (
 	mu       sync.Mutex
 )
 
+// NewID generates a unique run id
+func NewID() string {
+	buf := make([]byte, 6)
+	if _, err := rand.Read(buf); err != nil {
+		return fmt.Sprintf("%x", time.Now().UnixNano())
+	}
+	return hex.EncodeToString(buf)
+}
+
+// Register records a new run
+func Register(run PipelineStatus) {
+	mu.Lock()
+	defer mu.Unlock()
+	statuses[run.ID] = run
+}
+
+// Add updates the status of a run, keeping the details already registered for it
 func Add(id, status, errorMsg string) {
 	mu.Lock()
 	defer mu.Unlock()
-	statuses[id] = PipelineStatus{ID: id, Status: status, Error: errorMsg}
+	s := statuses[id]
+	s.ID = id
+	s.Status = status
+	s.Error = errorMsg
+	statuses[id] = s
+}
+
+// SetHosts records the per-host progress of the run's deploy
+func SetHosts(id string, hosts []deployments.Host) {
+	mu.Lock()
+	defer mu.Unlock()
+	s := statuses[id]
+	s.ID = id
+	s.Hosts = hosts
+	statuses[id] = s
+}
+
+// MarkApproved records that the deploy of a waiting run was approved by user
+func MarkApproved(id, user string) {
+	mu.Lock()
+	defer mu.Unlock()
+	s := statuses[id]
+	s.ID = id
+	s.Status = "running"
+	s.ApprovedBy = user
+	statuses[id] = s
+}
+
+// SetDeployBlocked records why the run's deploy is held or skipped, e.g. a freeze
+func SetDeployBlocked(id, reason string) {
+	mu.Lock()
+	defer mu.Unlock()
+	s := statuses[id]
+	s.ID = id
+	s.DeployBlocked = reason
+	statuses[id] = s
+}
+
+// MarkCancelled records that a run was cancelled by the given user
+func MarkCancelled(id, user string) {
+	mu.Lock()
+	defer mu.Unlock()
+	s := statuses[id]
+	s.ID = id
+	s.Status = "cancelled"
+	s.Error = ""
+	s.CancelledBy = user
+	statuses[id] = s
+}
+
+const statusesState = "statuses"
+
+// persistedStatus is a run status as saved by Persist, with the env overrides
+// that responses leave out, so reruns and promotions after a restart keep them
+type persistedStatus struct {
+	PipelineStatus
+	Env map[string]string `json:"env,omitempty"`
+}
+
+// Persist saves the run statuses so they survive a restart
+func Persist(st *store.Store) error {
+	mu.Lock()
+	defer mu.Unlock()
+	saved := make(map[string]persistedStatus, len(statuses))
+	for id, s := range statuses {
+		saved[id] = persistedStatus{PipelineStatus: s, Env: s.Env}
+	}
+	return st.Save(statusesState, saved)
+}
+
+// Restore loads the run statuses saved by Persist. Runs that were still
+// active when goFlow stopped without draining are marked interrupted.
+func Restore(st *store.Store) error {
+	saved := make(map[string]persistedStatus)
+	if err := st.Load(statusesState, &saved); err != nil {
+		return err
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	for id, p := range saved {
+		s := p.PipelineStatus
+		s.Env = p.Env
+		if isActive(s.Status) {
+			s.Status = "interrupted"
+		}
+		statuses[id] = s
+	}
+	return nil
+}
+
+// IsActive reports whether the run is still cloning, running or waiting for approval or a deploy window
+func IsActive(id string) bool {
+	s, ok := Get(id)
+	return ok && isActive(s.Status)
+}
+
+func isActive(status string) bool {
+	return status == "cloning" || status == "running" || status == "waiting_approval" || status == "deploy_blocked" || status == "cancelling"
+}
+
+// Get returns the status of a single run
+func Get(id string) (PipelineStatus, bool) {
+	mu.Lock()
+	defer mu.Unlock()
+	s, ok := statuses[id]
+	return s, ok
 }
 
 func StatusHandler(ctx *server.HttpContext) {
 
-	if ctx.Request.Method != "GET" {
+	if ctx.Request.Method != server.GET_METHOD && ctx.Request.Method != server.HEAD_METHOD {
 		ctx.JSON(server.StatusMethodNotAllowed, server.Generalesponse{
 			"error":   "Only GET allowed",
 			"message": server.StatusCodeText[server.StatusMethodNotAllowed],
@@ -33,10 +175,51 @@ func StatusHandler(ctx *server.HttpContext) {
 		return
 	}
 
+	// Optional filters, each may be repeated: ?status=failed&status=cancelled&repository=...
+	wantStatus := ctx.QueryArray("status")
+	wantRepo := ctx.QueryArray("repository")
+
 	mu.Lock()
 	defer mu.Unlock()
-	ctx.JSON(server.StatusOK, server.Generalesponse{
-		"data":    statuses,
-		"message": server.StatusCodeText[server.StatusOK],
-	})
+	data := make(map[string]PipelineStatus, len(statuses))
+	for id, s := range statuses {
+		if matchesAny(s.Status, wantStatus) && matchesAny(s.Repository, wantRepo) {
+			data[id] = s
+		}
+	}
+	ctx.Render(server.StatusOK, runList{Data: data, Message: server.StatusCodeText[server.StatusOK]})
+}
+
+// matchesAny reports whether value is one of wanted, an empty filter matches everything
+func matchesAny(value string, wanted []string) bool {
+	if len(wanted) == 0 {
+		return true
+	}
+	for _, w := range wanted {
+		if w == value {
+			return true
+		}
+	}
+	return false
+}
+
+// RunStatusHandler handles GET /status/:id
+func RunStatusHandler(ctx *server.HttpContext) {
+	id, err := ctx.Param("id")
+	if err != nil {
+		ctx.JSON(server.StatusBadRequest, server.Generalesponse{
+			"error":   server.ResponseMessage["invalid_id"],
+			"message": server.StatusCodeText[server.StatusBadRequest],
+		})
+		return
+	}
+	s, ok := Get(id)
+	if !ok {
+		ctx.JSON(server.StatusNotFound, server.Generalesponse{
+			"error":   fmt.Sprintf("run %s not found", id),
+			"message": server.StatusCodeText[server.StatusNotFound],
+		})
+		return
+	}
+	ctx.Render(server.StatusOK, runDetail{Data: s, Message: server.StatusCodeText[server.StatusOK]})
 }
@@ -0,0 +1,103 @@
+package status
+
+import (
+	"fmt"
+	"html/template"
+	"io"
+	"sort"
+	"text/tabwriter"
+)
+
+// runList is the /status response, rendered as a table for terminals and browsers
+type runList struct {
+	Data    map[string]PipelineStatus `json:"data"`
+	Message string                    `json:"message"`
+}
+
+// runDetail is the /status/:id response
+type runDetail struct {
+	Data    PipelineStatus `json:"data"`
+	Message string         `json:"message"`
+}
+
+func (l runList) sorted() []PipelineStatus {
+	runs := make([]PipelineStatus, 0, len(l.Data))
+	for _, run := range l.Data {
+		runs = append(runs, run)
+	}
+	sort.Slice(runs, func(i, j int) bool { return runs[i].ID < runs[j].ID })
+	return runs
+}
+
+func (l runList) RenderText(w io.Writer) error {
+	return writeRunTable(w, l.sorted())
+}
+
+func (l runList) RenderHTML(w io.Writer) error {
+	return runsPage.Execute(w, l.sorted())
+}
+
+func (d runDetail) RenderText(w io.Writer) error {
+	if err := writeRunTable(w, []PipelineStatus{d.Data}); err != nil || len(d.Data.Hosts) == 0 {
+		return err
+	}
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "\nHOST\tSTATUS\tRELEASE\tERROR")
+	for _, host := range d.Data.Hosts {
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\n", host.Host, host.Status, host.Release, host.Error)
+	}
+	return tw.Flush()
+}
+
+func (d runDetail) RenderHTML(w io.Writer) error {
+	return runsPage.Execute(w, []PipelineStatus{d.Data})
+}
+
+func writeRunTable(w io.Writer, runs []PipelineStatus) error {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "ID\tSTATUS\tREPOSITORY\tENVIRONMENT\tREF\tCOMMIT\tTRIGGER\tERROR")
+	for _, run := range runs {
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\t%s\t%s\t%s\n",
+			run.ID, run.Status, run.Repository, run.Environment, run.Ref, shortSHA(run.Commit), triggerOf(run), detailOf(run))
+	}
+	return tw.Flush()
+}
+
+func shortSHA(sha string) string {
+	if len(sha) > 8 {
+		return sha[:8]
+	}
+	return sha
+}
+
+// triggerOf describes how a run started, e.g. "manual (alice)"
+func triggerOf(run PipelineStatus) string {
+	if run.TriggeredBy != "" {
+		return fmt.Sprintf("%s (%s)", run.Trigger, run.TriggeredBy)
+	}
+	return run.Trigger
+}
+
+// detailOf returns the error of a run, or why its deploy is held or skipped
+func detailOf(run PipelineStatus) string {
+	if run.Error == "" {
+		return run.DeployBlocked
+	}
+	return run.Error
+}
+
+var runsPage = template.Must(template.New("runs").Funcs(template.FuncMap{
+	"short":   shortSHA,
+	"trigger": triggerOf,
+	"detail":  detailOf,
+}).Parse(`<!DOCTYPE html>
+<html><head><meta charset="utf-8"><title>goFlow runs</title>
+<style>body{font-family:sans-serif}td,th{padding:4px 10px;text-align:left}
+.success,.deployed{color:green}.failed,.interrupted{color:#b00}.cancelled,.skipped,.rolled_back,.deploy_skipped{color:gray}.waiting_approval,.deploy_blocked{color:#b60}</style></head>
+<body><h1>Pipeline runs</h1>
+<table><tr><th>ID</th><th>Status</th><th>Repository</th><th>Environment</th><th>Ref</th><th>Commit</th><th>Trigger</th><th>Error</th></tr>
+{{range .}}<tr><td><a href="/status/{{.ID}}">{{.ID}}</a></td><td class="{{.Status}}">{{.Status}}</td><td>{{.Repository}}</td><td>{{.Environment}}</td><td>{{.Ref}}</td><td>{{short .Commit}}</td><td>{{trigger .}}</td><td>{{detail .}}</td></tr>
+{{range .Hosts}}<tr><td></td><td class="{{.Status}}">{{.Status}}</td><td colspan="6">{{.Host}} {{.Release}} {{.Error}}</td></tr>
+{{end}}{{else}}<tr><td colspan="8">No runs yet</td></tr>
+{{end}}</table></body></html>
+`))
@@ -0,0 +1,62 @@
+package store
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// Store persists small pieces of state as JSON files in a directory,
+// so they survive restarts of goFlow
+type Store struct {
+	dir string
+	mu  sync.Mutex
+}
+
+func New(dir string) (*Store, error) {
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, fmt.Errorf("failed to create state directory %s: %v", dir, err)
+	}
+	return &Store{dir: dir}, nil
+}
+
+// Load reads the named state into v, leaving v untouched when nothing was saved yet
+func (s *Store) Load(name string, v interface{}) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	data, err := os.ReadFile(s.path(name))
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to read state %s: %v", name, err)
+	}
+	if err := json.Unmarshal(data, v); err != nil {
+		return fmt.Errorf("failed to parse state %s: %v", name, err)
+	}
+	return nil
+}
+
+// Save writes v as the named state, replacing the previous file atomically
+func (s *Store) Save(name string, v interface{}) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	data, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return fmt.Errorf("error marshaling state %s: %v", name, err)
+	}
+	tmp := s.path(name) + ".tmp"
+	if err := os.WriteFile(tmp, data, 0600); err != nil {
+		return fmt.Errorf("failed to write state %s: %v", name, err)
+	}
+	if err := os.Rename(tmp, s.path(name)); err != nil {
+		return fmt.Errorf("failed to write state %s: %v", name, err)
+	}
+	return nil
+}
+
+func (s *Store) path(name string) string {
+	return filepath.Join(s.dir, name+".json")
+}
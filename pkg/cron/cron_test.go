@@ -0,0 +1,46 @@
+package cron
+
+import (
+	"testing"
+	"time"
+)
+
+func TestNext(t *testing.T) {
+	berlin, err := time.LoadLocation("Europe/Berlin")
+	if err != nil {
+		t.Skipf("timezone data not available: %v", err)
+	}
+	from := time.Date(2024, 3, 15, 10, 30, 0, 0, time.UTC) // a Friday
+
+	tests := []struct {
+		expr string
+		from time.Time
+		want time.Time
+	}{
+		{"*/15 * * * *", from, time.Date(2024, 3, 15, 10, 45, 0, 0, time.UTC)},
+		{"0 2 * * *", from, time.Date(2024, 3, 16, 2, 0, 0, 0, time.UTC)},
+		{"@hourly", from, time.Date(2024, 3, 15, 11, 0, 0, 0, time.UTC)},
+		{"0 9 * * mon-fri", from, time.Date(2024, 3, 18, 9, 0, 0, 0, time.UTC)},
+		{"0 0 1 jan *", from, time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)},
+		{"0 0 13 * 5", from, time.Date(2024, 3, 22, 0, 0, 0, 0, time.UTC)}, // 13th or any Friday
+		{"30 3 * * 7", from, time.Date(2024, 3, 17, 3, 30, 0, 0, time.UTC)},
+		{"0 2 * * *", from.In(berlin), time.Date(2024, 3, 16, 2, 0, 0, 0, berlin)},
+	}
+	for _, tt := range tests {
+		s, err := Parse(tt.expr)
+		if err != nil {
+			t.Fatalf("Parse(%q): %v", tt.expr, err)
+		}
+		if got := s.Next(tt.from); !got.Equal(tt.want) {
+			t.Errorf("Next(%q) = %v, want %v", tt.expr, got, tt.want)
+		}
+	}
+}
+
+func TestParseInvalid(t *testing.T) {
+	for _, expr := range []string{"", "* * * *", "60 * * * *", "* * 0 * *", "5-1 * * * *", "*/0 * * * *", "* * * foo *"} {
+		if _, err := Parse(expr); err == nil {
+			t.Errorf("Parse(%q) succeeded, want error", expr)
+		}
+	}
+}
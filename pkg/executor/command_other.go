@@ -0,0 +1,13 @@
+//go:build !unix
+
+package executor
+
+import (
+	"context"
+	"os/exec"
+)
+
+// CommandContext is exec.CommandContext on platforms without process groups
+func CommandContext(ctx context.Context, name string, args ...string) *exec.Cmd {
+	return exec.CommandContext(ctx, name, args...)
+}
@@ -0,0 +1,20 @@
+//go:build unix
+
+package executor
+
+import (
+	"context"
+	"os/exec"
+	"syscall"
+)
+
+// CommandContext is like exec.CommandContext, but cancelling ctx kills the
+// whole process group, so children of "sh -c" or "ssh" are stopped too
+func CommandContext(ctx context.Context, name string, args ...string) *exec.Cmd {
+	cmd := exec.CommandContext(ctx, name, args...)
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+	cmd.Cancel = func() error {
+		return syscall.Kill(-cmd.Process.Pid, syscall.SIGKILL)
+	}
+	return cmd
+}
@@ -0,0 +1,212 @@
+package sshclient
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/pkg/sftp"
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/agent"
+	"golang.org/x/crypto/ssh/knownhosts"
+)
+
+const defaultTimeout = 15 * time.Second
+
+// Config describes how to reach and authenticate to a host
+type Config struct {
+	User    string
+	Addr    string // "host:port"
+	KeyPath string // private key file, optional when UseAgent is set
+	// Use the keys of the agent listening on SSH_AUTH_SOCK, also done when KeyPath is empty
+	UseAgent bool
+	// Host keys are checked against this file, defaults to ~/.ssh/known_hosts
+	KnownHosts            string
+	InsecureIgnoreHostKey bool          // skip host key verification, for throwaway hosts only
+	Timeout               time.Duration // for the connection and handshake, defaults to 15s
+}
+
+// Client is a connection to a host for running commands and copying files
+type Client struct {
+	conn *ssh.Client
+
+	sftpOnce sync.Once
+	sftp     *sftp.Client
+	sftpErr  error
+}
+
+// ExitError is returned by Run when the command exits with a non-zero status
+type ExitError struct {
+	Cmd    string
+	Code   int
+	Output string
+}
+
+func (e *ExitError) Error() string {
+	return fmt.Sprintf("command %q exited with status %d", e.Cmd, e.Code)
+}
+
+// Dial connects to the host and authenticates
+func Dial(ctx context.Context, cfg Config) (*Client, error) {
+	auth, err := authMethods(cfg)
+	if err != nil {
+		return nil, err
+	}
+	hostKeyCallback, err := hostKeyCallback(cfg)
+	if err != nil {
+		return nil, err
+	}
+	timeout := cfg.Timeout
+	if timeout == 0 {
+		timeout = defaultTimeout
+	}
+
+	dialer := net.Dialer{Timeout: timeout}
+	netConn, err := dialer.DialContext(ctx, "tcp", cfg.Addr)
+	if err != nil {
+		return nil, err
+	}
+	netConn.SetDeadline(time.Now().Add(timeout))
+	sshConn, chans, reqs, err := ssh.NewClientConn(netConn, cfg.Addr, &ssh.ClientConfig{
+		User:            cfg.User,
+		Auth:            auth,
+		HostKeyCallback: hostKeyCallback,
+		Timeout:         timeout,
+	})
+	if err != nil {
+		netConn.Close()
+		return nil, fmt.Errorf("ssh %s@%s: %w", cfg.User, cfg.Addr, err)
+	}
+	netConn.SetDeadline(time.Time{})
+	return &Client{conn: ssh.NewClient(sshConn, chans, reqs)}, nil
+}
+
+// authMethods returns the key file signer first, then the agent keys
+func authMethods(cfg Config) ([]ssh.AuthMethod, error) {
+	var signers []ssh.Signer
+	if cfg.KeyPath != "" {
+		pemBytes, err := os.ReadFile(cfg.KeyPath)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read ssh key: %v", err)
+		}
+		signer, err := ssh.ParsePrivateKey(pemBytes)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse ssh key %s: %v", cfg.KeyPath, err)
+		}
+		signers = append(signers, signer)
+	}
+	if cfg.UseAgent || cfg.KeyPath == "" {
+		socket := os.Getenv("SSH_AUTH_SOCK")
+		if socket == "" {
+			if len(signers) == 0 {
+				return nil, errors.New("no ssh key configured and SSH_AUTH_SOCK is not set")
+			}
+		} else {
+			agentConn, err := net.Dial("unix", socket)
+			if err != nil {
+				return nil, fmt.Errorf("failed to connect to ssh agent: %v", err)
+			}
+			agentSigners, err := agent.NewClient(agentConn).Signers()
+			agentConn.Close()
+			if err != nil {
+				return nil, fmt.Errorf("failed to list ssh agent keys: %v", err)
+			}
+			signers = append(signers, agentSigners...)
+		}
+	}
+	return []ssh.AuthMethod{ssh.PublicKeys(signers...)}, nil
+}
+
+func hostKeyCallback(cfg Config) (ssh.HostKeyCallback, error) {
+	if cfg.InsecureIgnoreHostKey {
+		return ssh.InsecureIgnoreHostKey(), nil
+	}
+	path := cfg.KnownHosts
+	if path == "" {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return nil, err
+		}
+		path = filepath.Join(home, ".ssh", "known_hosts")
+	}
+	callback, err := knownhosts.New(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load known hosts %s: %v", path, err)
+	}
+	return callback, nil
+}
+
+// Run executes cmd with the remote user's shell and returns its combined
+// output. A non-zero exit status is returned as *ExitError, carrying the output.
+func (c *Client) Run(ctx context.Context, cmd string) (string, error) {
+	session, err := c.conn.NewSession()
+	if err != nil {
+		return "", err
+	}
+	defer session.Close()
+
+	var output lockedBuffer
+	session.Stdout = &output
+	session.Stderr = &output
+
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		select {
+		case <-ctx.Done():
+			session.Signal(ssh.SIGKILL)
+			session.Close()
+		case <-done:
+		}
+	}()
+
+	err = session.Run(cmd)
+	if ctx.Err() != nil {
+		return output.String(), ctx.Err()
+	}
+	var exitErr *ssh.ExitError
+	if errors.As(err, &exitErr) {
+		return output.String(), &ExitError{Cmd: cmd, Code: exitErr.ExitStatus(), Output: output.String()}
+	}
+	return output.String(), err
+}
+
+// lockedBuffer collects stdout and stderr, which are copied concurrently
+type lockedBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *lockedBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *lockedBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.String()
+}
+
+// SFTP returns the file transfer session of the connection, opened on first use
+func (c *Client) SFTP() (*sftp.Client, error) {
+	c.sftpOnce.Do(func() {
+		c.sftp, c.sftpErr = sftp.NewClient(c.conn)
+	})
+	return c.sftp, c.sftpErr
+}
+
+// Close closes the connection
+func (c *Client) Close() error {
+	if c.sftp != nil {
+		c.sftp.Close()
+	}
+	return c.conn.Close()
+}
@@ -0,0 +1,120 @@
+package sshclient
+
+import (
+	"context"
+	"errors"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/khaledibrahim1015/goFlow-cicd/pkg/sshclient/sshtest"
+)
+
+func dial(t *testing.T) (*Client, *sshtest.Server) {
+	t.Helper()
+	keyPath, public := sshtest.NewKey(t)
+	srv := sshtest.NewServer(t, public)
+	client, err := Dial(context.Background(), Config{
+		User: "deploy", Addr: srv.Addr, KeyPath: keyPath, KnownHosts: sshtest.WriteKnownHosts(t, srv),
+	})
+	if err != nil {
+		t.Fatalf("Dial: %v", err)
+	}
+	t.Cleanup(func() { client.Close() })
+	return client, srv
+}
+
+func TestRunExitCodes(t *testing.T) {
+	client, _ := dial(t)
+	ctx := context.Background()
+
+	output, err := client.Run(ctx, "echo hello; echo oops >&2")
+	if err != nil || !strings.Contains(output, "hello\n") || !strings.Contains(output, "oops\n") {
+		t.Errorf("Run = %q, %v", output, err)
+	}
+
+	_, err = client.Run(ctx, "echo failing; exit 3")
+	var exitErr *ExitError
+	if !errors.As(err, &exitErr) || exitErr.Code != 3 || exitErr.Output != "failing\n" {
+		t.Errorf("err = %#v", err)
+	}
+
+	cancelCtx, cancel := context.WithTimeout(ctx, 50*time.Millisecond)
+	defer cancel()
+	if _, err := client.Run(cancelCtx, "sleep 5"); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("cancelled Run: %v", err)
+	}
+}
+
+func TestDialVerifiesHostKey(t *testing.T) {
+	keyPath, public := sshtest.NewKey(t)
+	srv := sshtest.NewServer(t, public)
+	other := sshtest.NewServer(t, public)
+
+	// known_hosts lists another host key for the address
+	knownHosts := sshtest.WriteKnownHosts(t, other)
+	_, otherPort, _ := net.SplitHostPort(other.Addr)
+	_, port, _ := net.SplitHostPort(srv.Addr)
+	os.WriteFile(knownHosts, []byte(strings.Replace(readFile(t, knownHosts), ":"+otherPort, ":"+port, 1)), 0600)
+	_, err := Dial(context.Background(), Config{User: "deploy", Addr: srv.Addr, KeyPath: keyPath, KnownHosts: knownHosts})
+	if err == nil || !strings.Contains(err.Error(), "key mismatch") {
+		t.Errorf("err = %v", err)
+	}
+
+	wrongKey, _ := sshtest.NewKey(t)
+	_, err = Dial(context.Background(), Config{User: "deploy", Addr: srv.Addr, KeyPath: wrongKey, KnownHosts: sshtest.WriteKnownHosts(t, srv)})
+	if err == nil {
+		t.Error("expected an unknown client key to be refused")
+	}
+}
+
+func TestSync(t *testing.T) {
+	client, srv := dial(t)
+	ctx := context.Background()
+	local := t.TempDir()
+	os.MkdirAll(filepath.Join(local, "wwwroot", "css"), 0755)
+	os.WriteFile(filepath.Join(local, "app.dll"), []byte("v1"), 0644)
+	os.WriteFile(filepath.Join(local, "run.sh"), []byte("#!/bin/sh"), 0755)
+	os.WriteFile(filepath.Join(local, "wwwroot", "css", "site.css"), []byte("body{}"), 0644)
+
+	stats, err := client.Sync(ctx, local, "releases/r1", SyncOptions{})
+	if err != nil || stats.Uploaded != 3 {
+		t.Fatalf("first sync = %+v, %v", stats, err)
+	}
+	info, err := os.Stat(filepath.Join(srv.Dir, "releases/r1/run.sh"))
+	if err != nil || info.Mode().Perm() != 0755 {
+		t.Errorf("run.sh = %v, %v", info, err)
+	}
+
+	// Second release: only the changed file is uploaded, the rest hard-linked
+	os.WriteFile(filepath.Join(local, "app.dll"), []byte("v2"), 0644)
+	later := time.Now().Add(time.Minute)
+	os.Chtimes(filepath.Join(local, "app.dll"), later, later)
+	stats, err = client.Sync(ctx, local, "releases/r2", SyncOptions{LinkDest: "releases/r1"})
+	if err != nil || stats.Uploaded != 1 || stats.Linked != 2 {
+		t.Fatalf("linked sync = %+v, %v", stats, err)
+	}
+	if got := readFile(t, filepath.Join(srv.Dir, "releases/r2/app.dll")); got != "v2" {
+		t.Errorf("r2 app.dll = %q", got)
+	}
+	if got := readFile(t, filepath.Join(srv.Dir, "releases/r1/app.dll")); got != "v1" {
+		t.Errorf("r1 app.dll changed to %q", got)
+	}
+
+	stats, err = client.Sync(ctx, local, "releases/r2", SyncOptions{})
+	if err != nil || stats.Unchanged != 3 || stats.Uploaded != 0 {
+		t.Errorf("repeated sync = %+v, %v", stats, err)
+	}
+}
+
+func readFile(t *testing.T, path string) string {
+	t.Helper()
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(data)
+}
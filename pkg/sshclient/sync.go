@@ -0,0 +1,146 @@
+package sshclient
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+
+	"github.com/pkg/sftp"
+)
+
+// SyncOptions tune Sync
+type SyncOptions struct {
+	// Remote directory holding a previous copy, e.g. the last release. Files
+	// unchanged since then are hard-linked from it instead of uploaded.
+	LinkDest string
+}
+
+// SyncStats counts what Sync did
+type SyncStats struct {
+	Uploaded  int
+	Linked    int
+	Unchanged int
+	Bytes     int64 // uploaded
+}
+
+// Sync copies the local directory into the remote one over SFTP, like
+// "rsync -a": files whose size and modification time match are skipped,
+// modes and times are preserved, and remote files missing locally are kept.
+func (c *Client) Sync(ctx context.Context, localDir, remoteDir string, opts SyncOptions) (SyncStats, error) {
+	var stats SyncStats
+	client, err := c.SFTP()
+	if err != nil {
+		return stats, fmt.Errorf("sftp: %v", err)
+	}
+	if err := client.MkdirAll(remoteDir); err != nil {
+		return stats, fmt.Errorf("failed to create %s: %v", remoteDir, err)
+	}
+
+	err = filepath.WalkDir(localDir, func(localPath string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(localDir, localPath)
+		if err != nil || rel == "." {
+			return err
+		}
+		rel = filepath.ToSlash(rel)
+		remotePath := path.Join(remoteDir, rel)
+
+		info, err := entry.Info()
+		if err != nil {
+			return err
+		}
+		switch {
+		case entry.IsDir():
+			if err := client.MkdirAll(remotePath); err != nil {
+				return fmt.Errorf("failed to create %s: %v", remotePath, err)
+			}
+			return client.Chmod(remotePath, info.Mode().Perm())
+		case info.Mode()&fs.ModeSymlink != 0:
+			target, err := os.Readlink(localPath)
+			if err != nil {
+				return err
+			}
+			if current, err := client.ReadLink(remotePath); err == nil && current == target {
+				stats.Unchanged++
+				return nil
+			}
+			client.Remove(remotePath)
+			return client.Symlink(target, remotePath)
+		case !info.Mode().IsRegular():
+			return nil // sockets, devices
+		}
+
+		if sameFile(client, remotePath, info) {
+			stats.Unchanged++
+			return nil
+		}
+		if opts.LinkDest != "" {
+			previous := path.Join(opts.LinkDest, rel)
+			if sameFile(client, previous, info) {
+				client.Remove(remotePath)
+				if err := client.Link(previous, remotePath); err == nil {
+					stats.Linked++
+					return nil
+				}
+			}
+		}
+		n, err := upload(client, localPath, remotePath, info)
+		if err != nil {
+			return fmt.Errorf("failed to upload %s: %v", rel, err)
+		}
+		stats.Uploaded++
+		stats.Bytes += n
+		return nil
+	})
+	return stats, err
+}
+
+// sameFile reports whether the remote file has the size and modification time of info
+func sameFile(client *sftp.Client, remotePath string, info fs.FileInfo) bool {
+	remote, err := client.Lstat(remotePath)
+	return err == nil && remote.Mode().IsRegular() &&
+		remote.Size() == info.Size() && remote.ModTime().Unix() == info.ModTime().Unix()
+}
+
+// upload writes the file next to its destination and renames it into place,
+// so readers never see a partial file
+func upload(client *sftp.Client, localPath, remotePath string, info fs.FileInfo) (int64, error) {
+	src, err := os.Open(localPath)
+	if err != nil {
+		return 0, err
+	}
+	defer src.Close()
+
+	tmpPath := path.Join(path.Dir(remotePath), ".goflow-"+path.Base(remotePath))
+	dst, err := client.OpenFile(tmpPath, os.O_WRONLY|os.O_CREATE|os.O_TRUNC)
+	if err != nil {
+		return 0, err
+	}
+	n, err := io.Copy(dst, src)
+	if closeErr := dst.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = client.Chmod(tmpPath, info.Mode().Perm())
+	}
+	if err == nil {
+		err = client.Chtimes(tmpPath, info.ModTime(), info.ModTime())
+	}
+	if err == nil {
+		err = client.PosixRename(tmpPath, remotePath)
+	}
+	if err != nil {
+		client.Remove(tmpPath)
+		return 0, err
+	}
+	return n, nil
+}